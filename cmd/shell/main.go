@@ -3,16 +3,23 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/Su5ubedi/advanced-shell/internal/shell"
 )
 
 func main() {
+	// The shell runs itself to start commands under resource limits
+	if len(os.Args) > 1 && os.Args[1] == shell.LimitHelperArg {
+		shell.RunLimitHelper(os.Args[2:])
+	}
+
 	// Command line flags
 	var (
 		version = flag.Bool("version", false, "Show version information")
 		help    = flag.Bool("help", false, "Show help information")
 		debug   = flag.Bool("debug", false, "Enable debug mode")
+		login   = flag.Bool("login", false, "Require a login before running commands")
 	)
 	flag.Parse()
 
@@ -28,6 +35,9 @@ func main() {
 
 	// Create and start the shell
 	sh := shell.NewShell()
+	if *login {
+		sh.RequireLogin()
+	}
 
 	if *debug {
 		fmt.Println("Debug mode enabled")
@@ -60,6 +70,7 @@ func showHelp() {
 	fmt.Println("  -version    Show version information")
 	fmt.Println("  -help       Show this help message")
 	fmt.Println("  -debug      Enable debug mode")
+	fmt.Println("  -login      Require a login before running commands (or ASH_LOGIN=on)")
 	fmt.Println()
 	fmt.Println("Once started, type 'help' for available shell commands")
 }
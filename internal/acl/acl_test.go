@@ -0,0 +1,188 @@
+package acl
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Su5ubedi/advanced-shell/internal/auth"
+)
+
+func openPolicy(t *testing.T) *Policy {
+	t.Helper()
+	p, err := Open(filepath.Join(t.TempDir(), "acl.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestUnder(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		want         bool
+	}{
+		{"/a", "/a", true},
+		{"/a/b", "/a", true},
+		{"/a/b/c", "/a", true},
+		{"/ab", "/a", false},
+		{"/a", "/a/b", false},
+		{"/anything", "/", true},
+	}
+	for _, tt := range tests {
+		if got := under(tt.path, tt.prefix); got != tt.want {
+			t.Errorf("under(%q, %q) = %v, want %v", tt.path, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	entries := []Entry{
+		{Prefix: "/a", Owner: "alice"},
+		{Prefix: "/a/b", Owner: "bob"},
+		{Prefix: "/ab", Owner: "carol"},
+	}
+	tests := []struct {
+		path, prefix string
+	}{
+		{"/a", "/a"},
+		{"/a/x", "/a"},
+		{"/a/b", "/a/b"},
+		{"/a/b/c", "/a/b"},
+		{"/a/bc", "/a"},
+		{"/ab/c", "/ab"},
+		{"/abc", "/"},
+		{"/z", "/"},
+	}
+	for _, tt := range tests {
+		if got := match(entries, tt.path); got.Prefix != tt.prefix {
+			t.Errorf("match(%q) = %s, want %s", tt.path, got.Prefix, tt.prefix)
+		}
+	}
+}
+
+func TestEntryFor(t *testing.T) {
+	e := Entry{Prefix: "/p", Owner: "alice", Perms: map[string]Perm{
+		ClassOwner: Read | Write, ClassUser: Read, ClassGuest: 0,
+	}}
+	tests := []struct {
+		name, role string
+		want       Perm
+	}{
+		{"root", auth.RoleAdmin, All},
+		{"alice", auth.RoleUser, Read | Write},
+		{"alice", auth.RoleGuest, Read | Write},
+		{"bob", auth.RoleUser, Read},
+		{"", auth.RoleGuest, 0},
+	}
+	for _, tt := range tests {
+		if got := e.For(tt.name, tt.role); got != tt.want {
+			t.Errorf("For(%q, %s) = %s, want %s", tt.name, tt.role, got, tt.want)
+		}
+	}
+
+	// Guests may read and traverse where no entry applies
+	if got := Default.For("", auth.RoleGuest); got != Read|Exec {
+		t.Errorf("default for a guest = %s, want r-x", got)
+	}
+}
+
+func TestApplyMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want [3]Perm // owner, user, guest
+		ok   bool
+	}{
+		{"750", [3]Perm{All, Read | Exec, 0}, true},
+		{"guest-x", [3]Perm{All, All, Read}, true},
+		{"user=r,guest=", [3]Perm{All, Read, 0}, true},
+		{"all-w", [3]Perm{Read | Exec, Read | Exec, Read | Exec}, true},
+		{"owners+r", [3]Perm{All, All, Read | Exec}, true},
+		{"789", [3]Perm{}, false},
+		{"guest", [3]Perm{}, false},
+		{"other+r", [3]Perm{}, false},
+		{"user+q", [3]Perm{}, false},
+	}
+	for _, tt := range tests {
+		perms := map[string]Perm{ClassOwner: All, ClassUser: All, ClassGuest: Read | Exec}
+		err := ApplyMode(perms, tt.mode)
+		if (err == nil) != tt.ok {
+			t.Errorf("ApplyMode(%q): error %v", tt.mode, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		got := [3]Perm{perms[ClassOwner], perms[ClassUser], perms[ClassGuest]}
+		if got != tt.want {
+			t.Errorf("ApplyMode(%q) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := openPolicy(t)
+	if _, err := p.Chmod("/data", "750"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chown("/data", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chmod("/data/secret", "700"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, role, path string
+		want             Perm
+		tree             bool
+		ok               bool
+	}{
+		{"alice", auth.RoleUser, "/data/file", Write, false, true},
+		{"bob", auth.RoleUser, "/data/file", Read, false, true},
+		{"bob", auth.RoleUser, "/data/file", Write, false, false},
+		{"", auth.RoleGuest, "/data/file", Read, false, false},
+		{"", auth.RoleGuest, "/database", Read, false, true},
+		{"bob", auth.RoleUser, "/data/secret/key", Read, false, false},
+		{"root", auth.RoleAdmin, "/data/secret/key", All, false, true},
+		// A tree check also needs the entries below the path to allow it
+		{"bob", auth.RoleUser, "/data", Read, true, false},
+		{"alice", auth.RoleUser, "/data", Write, true, true},
+	}
+	for _, tt := range tests {
+		_, err := p.Check(tt.name, tt.role, tt.path, tt.want, tt.tree)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s %q %s on %s (tree %v): error %v", tt.role, tt.name, tt.want, tt.path, tt.tree, err)
+		}
+	}
+}
+
+func TestChangeInherits(t *testing.T) {
+	p := openPolicy(t)
+	if _, err := p.Chmod("/data", "750"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chown("/data", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new entry starts as a copy of the one it was governed by
+	e, err := p.Chmod("/data/shared", "user+w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Owner != "alice" || e.Perms[ClassOwner] != All || e.Perms[ClassUser] != All || e.Perms[ClassGuest] != 0 {
+		t.Errorf("new entry %+v, want owner alice and rwx rwx ---", e)
+	}
+
+	// Removing it hands the path back to the entry above
+	if err := p.Remove("/data/shared"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := p.Match("/data/shared"); e.Prefix != "/data" {
+		t.Errorf("after removal governed by %s, want /data", e.Prefix)
+	}
+	if err := p.Remove("/data/shared"); err == nil || !strings.Contains(err.Error(), "no entry") {
+		t.Errorf("removing a missing entry: %v", err)
+	}
+}
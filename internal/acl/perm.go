@@ -0,0 +1,110 @@
+package acl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Perm is a set of read, write and execute permissions
+type Perm uint8
+
+const (
+	Read  Perm = 4
+	Write Perm = 2
+	Exec  Perm = 1
+	All        = Read | Write | Exec
+)
+
+// String formats a permission set the way ls does, e.g. r-x
+func (p Perm) String() string {
+	b := []byte("---")
+	if p&Read != 0 {
+		b[0] = 'r'
+	}
+	if p&Write != 0 {
+		b[1] = 'w'
+	}
+	if p&Exec != 0 {
+		b[2] = 'x'
+	}
+	return string(b)
+}
+
+// ParsePerm reads a set of letters from rwx; "-" is ignored
+func ParsePerm(s string) (Perm, error) {
+	var p Perm
+	for _, c := range s {
+		switch c {
+		case 'r':
+			p |= Read
+		case 'w':
+			p |= Write
+		case 'x':
+			p |= Exec
+		case '-':
+		default:
+			return 0, fmt.Errorf("%c: permissions are r, w and x", c)
+		}
+	}
+	return p, nil
+}
+
+// Classes the permissions of an entry are given for. The owner of an entry
+// gets the owner permissions; everyone else gets their role's.
+const (
+	ClassOwner = "owner"
+	ClassUser  = "user"
+	ClassGuest = "guest"
+)
+
+// Classes lists the classes in the order an octal mode gives them
+var Classes = []string{ClassOwner, ClassUser, ClassGuest}
+
+// ApplyMode changes perms, keyed by class, following a chmod-style mode:
+// three octal digits for owner, user and guest, or comma-separated clauses
+// such as guest-w, user=rx or all+r
+func ApplyMode(perms map[string]Perm, mode string) error {
+	if len(mode) == 3 && strings.Trim(mode, "01234567") == "" {
+		for i, class := range Classes {
+			perms[class] = Perm(mode[i] - '0')
+		}
+		return nil
+	}
+
+	for _, clause := range strings.Split(mode, ",") {
+		i := strings.IndexAny(clause, "=+-")
+		if i < 0 {
+			return fmt.Errorf("%s: expected class=perms, class+perms or class-perms", clause)
+		}
+		who, op := clause[:i], clause[i]
+		p, err := ParsePerm(clause[i+1:])
+		if err != nil {
+			return err
+		}
+
+		var classes []string
+		switch strings.TrimSuffix(who, "s") {
+		case "owner":
+			classes = []string{ClassOwner}
+		case "user":
+			classes = []string{ClassUser}
+		case "guest":
+			classes = []string{ClassGuest}
+		case "all", "a", "":
+			classes = Classes
+		default:
+			return fmt.Errorf("%s: classes are owner, user, guest and all", who)
+		}
+		for _, class := range classes {
+			switch op {
+			case '=':
+				perms[class] = p
+			case '+':
+				perms[class] |= p
+			case '-':
+				perms[class] &^= p
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Su5ubedi/advanced-shell/internal/auth"
+)
+
+// Entry gives the permissions for a path and everything below it, unless a
+// longer prefix has an entry of its own
+type Entry struct {
+	Prefix string          `json:"prefix"`
+	Owner  string          `json:"owner,omitempty"`
+	Perms  map[string]Perm `json:"perms"`
+}
+
+// Default applies where no entry does: users may do anything, guests may
+// only read and traverse
+var Default = Entry{
+	Prefix: "/",
+	Perms:  map[string]Perm{ClassOwner: All, ClassUser: All, ClassGuest: Read | Exec},
+}
+
+// For returns the permissions a user with a role has under the entry.
+// Administrators are allowed everything.
+func (e *Entry) For(name, role string) Perm {
+	switch {
+	case role == auth.RoleAdmin:
+		return All
+	case e.Owner != "" && e.Owner == name:
+		return e.Perms[ClassOwner]
+	case role == auth.RoleUser:
+		return e.Perms[ClassUser]
+	}
+	return e.Perms[ClassGuest]
+}
+
+// Covers reports whether path is the entry's prefix or lies below it
+func (e *Entry) Covers(path string) bool {
+	return under(path, e.Prefix)
+}
+
+// Policy is a set of entries kept in a JSON file. Every operation rereads
+// the file, so changes made by one shell apply in the others.
+type Policy struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns the policy stored at path. The file is created with the
+// first entry.
+func Open(path string) (*Policy, error) {
+	p := &Policy{path: path}
+	if _, err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Path is the file the policy is kept in
+func (p *Policy) Path() string {
+	return p.path
+}
+
+// Entries returns every entry, sorted by prefix
+func (p *Policy) Entries() ([]Entry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load()
+}
+
+// Match returns the entry that governs path: the one with the longest
+// prefix covering it, or Default
+func (p *Policy) Match(path string) (Entry, error) {
+	entries, err := p.Entries()
+	if err != nil {
+		return Entry{}, err
+	}
+	return match(entries, path), nil
+}
+
+// Check returns the entry governing path, and an error if a user with a
+// role lacks any of the wanted permissions there. With tree set, entries
+// for paths below it are checked as well.
+func (p *Policy) Check(name, role, path string, want Perm, tree bool) (Entry, error) {
+	entries, err := p.Entries()
+	if err != nil {
+		return Entry{}, err
+	}
+	governing := match(entries, path)
+	check := []Entry{governing}
+	if tree {
+		for _, e := range entries {
+			if e.Prefix != path && under(e.Prefix, path) {
+				check = append(check, e)
+			}
+		}
+	}
+
+	for _, e := range check {
+		if have := e.For(name, role); have&want != want {
+			who := role
+			if name != "" {
+				who = fmt.Sprintf("%s %s", role, name)
+			}
+			missing := strings.ReplaceAll((want &^ have).String(), "-", "")
+			return governing, fmt.Errorf("%s lacks %s under %s, which allows %s", who, missing, e.Prefix, have)
+		}
+	}
+	return governing, nil
+}
+
+// Chmod changes the permissions of the entry for prefix following a
+// chmod-style mode. A new entry starts from the permissions and owner that
+// applied to prefix before.
+func (p *Policy) Chmod(prefix, mode string) (Entry, error) {
+	return p.change(prefix, func(e *Entry) error {
+		return ApplyMode(e.Perms, mode)
+	})
+}
+
+// Chown makes user the owner of the entry for prefix
+func (p *Policy) Chown(prefix, user string) (Entry, error) {
+	return p.change(prefix, func(e *Entry) error {
+		e.Owner = user
+		return nil
+	})
+}
+
+// Remove deletes the entry for prefix, so the next prefix up governs it
+func (p *Policy) Remove(prefix string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries, err := p.load()
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.Prefix == prefix {
+			return p.save(append(entries[:i], entries[i+1:]...))
+		}
+	}
+	return fmt.Errorf("%s: no entry", prefix)
+}
+
+// change applies an edit to the entry for prefix, creating it if needed
+func (p *Policy) change(prefix string, edit func(e *Entry) error) (Entry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries, err := p.load()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Prefix >= prefix })
+	if i == len(entries) || entries[i].Prefix != prefix {
+		inherited := match(entries, prefix)
+		e := Entry{Prefix: prefix, Owner: inherited.Owner, Perms: make(map[string]Perm)}
+		for class, perm := range inherited.Perms {
+			e.Perms[class] = perm
+		}
+		entries = append(entries[:i], append([]Entry{e}, entries[i:]...)...)
+	}
+	if err := edit(&entries[i]); err != nil {
+		return Entry{}, err
+	}
+	return entries[i], p.save(entries)
+}
+
+// load reads the entries on disk; a missing file holds none
+func (p *Policy) load() ([]Entry, error) {
+	data, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", p.path, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Prefix < entries[j].Prefix })
+	return entries, nil
+}
+
+// save writes the entries to a temporary file and renames it into place
+func (p *Policy) save(entries []Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), ".acl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
+
+// match finds the entry with the longest prefix covering path
+func match(entries []Entry, path string) Entry {
+	best := Default
+	found := false
+	for _, e := range entries {
+		if e.Covers(path) && (!found || len(e.Prefix) > len(best.Prefix)) {
+			best, found = e, true
+		}
+	}
+	return best
+}
+
+// under reports whether path is prefix or lies below it
+func under(path, prefix string) bool {
+	if prefix == "/" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, prefix+string(filepath.Separator))
+}
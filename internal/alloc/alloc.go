@@ -0,0 +1,371 @@
+package alloc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Strategy is a contiguous allocation strategy
+type Strategy string
+
+const (
+	FirstFit Strategy = "first" // the lowest hole that is large enough
+	NextFit  Strategy = "next"  // the first large enough hole after the last allocation
+	BestFit  Strategy = "best"  // the smallest hole that is large enough
+	WorstFit Strategy = "worst" // the largest hole
+	Buddy    Strategy = "buddy" // power-of-two blocks split in halves and merged with their buddy
+)
+
+// Strategies lists every strategy, in the order comparisons show them
+var Strategies = []Strategy{FirstFit, NextFit, BestFit, WorstFit, Buddy}
+
+// ParseStrategy accepts a strategy's name or a common alias
+func ParseStrategy(name string) (Strategy, error) {
+	switch strings.ToLower(name) {
+	case "first", "first-fit", "ff":
+		return FirstFit, nil
+	case "next", "next-fit", "nf":
+		return NextFit, nil
+	case "best", "best-fit", "bf":
+		return BestFit, nil
+	case "worst", "worst-fit", "wf":
+		return WorstFit, nil
+	case "buddy":
+		return Buddy, nil
+	}
+	return "", fmt.Errorf("%s: unknown strategy", name)
+}
+
+// Title names a strategy
+func (s Strategy) Title() string {
+	switch s {
+	case FirstFit:
+		return "First fit"
+	case NextFit:
+		return "Next fit"
+	case BestFit:
+		return "Best fit"
+	case WorstFit:
+		return "Worst fit"
+	case Buddy:
+		return "Buddy system"
+	}
+	return string(s)
+}
+
+// Options tune a simulation
+type Options struct {
+	MinBlock    int  // smallest block the buddy allocator hands out
+	AutoCompact bool // compact and retry when an allocation finds no hole
+}
+
+// DefaultOptions are used when none are given
+var DefaultOptions = Options{MinBlock: 16}
+
+// Block is a run of memory, either a hole or an allocation. Requested is
+// what the allocation asked for; the rest of the block is internal
+// fragmentation.
+type Block struct {
+	Start     int
+	Size      int
+	Name      string // owner, empty for a hole
+	Requested int
+}
+
+// Hole reports whether the block is free
+func (b Block) Hole() bool {
+	return b.Name == ""
+}
+
+// End is the address just past the block
+func (b Block) End() int {
+	return b.Start + b.Size
+}
+
+// Event is the outcome of one request
+type Event struct {
+	Request
+	Block     Block   // the block allocated or freed
+	Err       error   // why the request failed
+	Compacted bool    // an automatic compaction made room for the request
+	Moved     int     // blocks moved by compaction
+	Blocks    []Block // the heap after the request
+}
+
+// Result is the outcome of running an allocation script
+type Result struct {
+	Strategy Strategy
+	Size     int
+	Options  Options
+	Events   []Event
+	Failed   int
+}
+
+// Blocks is the heap at the end of the script
+func (r *Result) Blocks() []Block {
+	if len(r.Events) == 0 {
+		return []Block{{Size: r.Size}}
+	}
+	return r.Events[len(r.Events)-1].Blocks
+}
+
+// Simulate runs an allocation script against a heap of size units
+func Simulate(size int, reqs []Request, strategy Strategy, opts Options) (*Result, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("the heap size must be positive")
+	}
+	if _, err := ParseStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+	if strategy == Buddy {
+		if size&(size-1) != 0 {
+			return nil, fmt.Errorf("the buddy system needs a power of two heap size, not %d", size)
+		}
+		if opts.MinBlock <= 0 || opts.MinBlock&(opts.MinBlock-1) != 0 || opts.MinBlock > size {
+			return nil, fmt.Errorf("the minimum block must be a power of two no larger than the heap")
+		}
+	}
+
+	h := &heap{strategy: strategy, size: size, minBlock: opts.MinBlock, blocks: []Block{{Size: size}}}
+	result := &Result{Strategy: strategy, Size: size, Options: opts}
+	for _, req := range reqs {
+		event := Event{Request: req}
+		switch req.Op {
+		case Alloc:
+			event.Block, event.Err = h.alloc(req.Name, req.Size)
+			if event.Err == errNoHole && opts.AutoCompact {
+				event.Compacted, event.Moved = true, h.compact()
+				event.Block, event.Err = h.alloc(req.Name, req.Size)
+			}
+		case Free:
+			event.Block, event.Err = h.free(req.Name)
+		case Compact:
+			event.Moved = h.compact()
+		}
+		if event.Err != nil {
+			result.Failed++
+		}
+		event.Blocks = append([]Block(nil), h.blocks...)
+		result.Events = append(result.Events, event)
+	}
+	return result, nil
+}
+
+// errNoHole means there is enough free memory in total but no single hole
+// holds the request
+var errNoHole = fmt.Errorf("no hole is large enough")
+
+// heap is the memory during a simulation, as blocks in address order
+type heap struct {
+	strategy Strategy
+	size     int
+	minBlock int
+	blocks   []Block
+	next     int // where next fit resumes its search
+}
+
+func (h *heap) alloc(name string, size int) (Block, error) {
+	for _, b := range h.blocks {
+		if b.Name == name {
+			return Block{}, fmt.Errorf("%s is already allocated", name)
+		}
+	}
+
+	need := size
+	if h.strategy == Buddy {
+		need = h.minBlock
+		for need < size {
+			need *= 2
+		}
+	}
+	if free := Stats(h.blocks).Free; need > free {
+		return Block{}, fmt.Errorf("not enough memory: %d needed, %d free", need, free)
+	}
+
+	i := h.choose(need)
+	if i < 0 {
+		return Block{}, errNoHole
+	}
+
+	// Split the hole, halving it repeatedly for the buddy system
+	for h.blocks[i].Size > need {
+		hole := h.blocks[i]
+		keep := need
+		if h.strategy == Buddy {
+			keep = hole.Size / 2
+		}
+		h.blocks[i].Size = keep
+		rest := Block{Start: hole.Start + keep, Size: hole.Size - keep}
+		h.blocks = append(h.blocks[:i+1], append([]Block{rest}, h.blocks[i+1:]...)...)
+	}
+	h.blocks[i].Name, h.blocks[i].Requested = name, size
+	h.next = h.blocks[i].End() % h.size
+	return h.blocks[i], nil
+}
+
+// choose picks the hole an allocation of need units goes in, or -1
+func (h *heap) choose(need int) int {
+	best := -1
+	for i, b := range h.blocks {
+		if !b.Hole() || b.Size < need {
+			continue
+		}
+		switch {
+		case best < 0:
+			best = i
+		case h.strategy == BestFit || h.strategy == Buddy:
+			if b.Size < h.blocks[best].Size {
+				best = i
+			}
+		case h.strategy == WorstFit:
+			if b.Size > h.blocks[best].Size {
+				best = i
+			}
+		case h.strategy == NextFit:
+			// The first hole at or after the resume point wins over
+			// those before it, which are only used after wrapping
+			if h.blocks[best].End() <= h.next && b.End() > h.next {
+				best = i
+			}
+		}
+	}
+	return best
+}
+
+func (h *heap) free(name string) (Block, error) {
+	i := -1
+	for j, b := range h.blocks {
+		if b.Name == name {
+			i = j
+		}
+	}
+	if i < 0 {
+		return Block{}, fmt.Errorf("%s is not allocated", name)
+	}
+	freed := h.blocks[i]
+	h.blocks[i].Name, h.blocks[i].Requested = "", 0
+
+	if h.strategy == Buddy {
+		h.mergeBuddies(i)
+	} else {
+		h.mergeHoles()
+	}
+	return freed, nil
+}
+
+// mergeHoles joins neighbouring holes
+func (h *heap) mergeHoles() {
+	merged := h.blocks[:1]
+	for _, b := range h.blocks[1:] {
+		last := &merged[len(merged)-1]
+		if b.Hole() && last.Hole() {
+			last.Size += b.Size
+			continue
+		}
+		merged = append(merged, b)
+	}
+	h.blocks = merged
+}
+
+// mergeBuddies joins the hole at i with its buddy for as long as the buddy
+// is a free block of the same size
+func (h *heap) mergeBuddies(i int) {
+	for {
+		b := h.blocks[i]
+		buddy := i + 1
+		if b.Start&b.Size != 0 {
+			buddy = i - 1
+		}
+		if buddy < 0 || buddy >= len(h.blocks) {
+			return
+		}
+		other := h.blocks[buddy]
+		if !other.Hole() || other.Size != b.Size || other.Start != b.Start^b.Size {
+			return
+		}
+		lo := min(i, buddy)
+		h.blocks[lo].Size *= 2
+		h.blocks = append(h.blocks[:lo+1], h.blocks[lo+2:]...)
+		i = lo
+	}
+}
+
+// compact moves every allocation down to leave a single hole at the top and
+// returns how many blocks moved. The buddy system can only place blocks at
+// multiples of their size, so it reallocates them largest first.
+func (h *heap) compact() int {
+	var used []Block
+	for _, b := range h.blocks {
+		if !b.Hole() {
+			used = append(used, b)
+		}
+	}
+
+	moved := 0
+	if h.strategy == Buddy {
+		sort.SliceStable(used, func(i, j int) bool { return used[i].Size > used[j].Size })
+		old := make(map[string]int, len(used))
+		h.blocks = []Block{{Size: h.size}}
+		for _, b := range used {
+			old[b.Name] = b.Start
+			h.alloc(b.Name, b.Requested)
+		}
+		for _, b := range h.blocks {
+			if !b.Hole() && b.Start != old[b.Name] {
+				moved++
+			}
+		}
+		return moved
+	}
+
+	h.blocks = h.blocks[:0]
+	addr := 0
+	for _, b := range used {
+		if b.Start != addr {
+			moved++
+		}
+		b.Start = addr
+		addr += b.Size
+		h.blocks = append(h.blocks, b)
+	}
+	if addr < h.size {
+		h.blocks = append(h.blocks, Block{Start: addr, Size: h.size - addr})
+	}
+	h.next = addr % h.size
+	return moved
+}
+
+// Fragmentation summarises how a heap's memory is used
+type Fragmentation struct {
+	Used     int // memory in allocated blocks
+	Free     int // memory in holes
+	Holes    int
+	Largest  int // the largest hole
+	Internal int // allocated but not requested
+}
+
+// External is the share of free memory outside the largest hole, which
+// requests larger than that hole cannot use
+func (f Fragmentation) External() float64 {
+	if f.Free == 0 {
+		return 0
+	}
+	return 1 - float64(f.Largest)/float64(f.Free)
+}
+
+// Stats measures the fragmentation of a heap
+func Stats(blocks []Block) Fragmentation {
+	var f Fragmentation
+	for _, b := range blocks {
+		if b.Hole() {
+			f.Free += b.Size
+			f.Holes++
+			f.Largest = max(f.Largest, b.Size)
+			continue
+		}
+		f.Used += b.Size
+		f.Internal += b.Size - b.Requested
+	}
+	return f
+}
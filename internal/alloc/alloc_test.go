@@ -0,0 +1,146 @@
+package alloc
+
+import (
+	"reflect"
+	"testing"
+)
+
+// script runs inline requests, failing the test on a bad one
+func script(t *testing.T, specs ...string) []Request {
+	t.Helper()
+	reqs := make([]Request, 0, len(specs))
+	for _, spec := range specs {
+		req, err := ParseRequest(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+// startOf returns where name was placed at the end of a simulation
+func startOf(r *Result, name string) int {
+	for _, b := range r.Blocks() {
+		if b.Name == name {
+			return b.Start
+		}
+	}
+	return -1
+}
+
+func TestStrategies(t *testing.T) {
+	// Leaves holes of 20 at 10, 5 at 65 and 20 at 80, with next fit
+	// resuming at 65
+	reqs := script(t, "a:10", "b:20", "c:10", "d:30", "e:10", "f:20",
+		"free:b", "free:d", "g:25", "free:f", "h:10", "i:5")
+
+	tests := []struct {
+		strategy Strategy
+		h, i     int
+	}{
+		{FirstFit, 10, 20},
+		{NextFit, 80, 90},
+		{BestFit, 10, 65},
+		{WorstFit, 10, 80},
+	}
+	for _, tt := range tests {
+		result, err := Simulate(100, reqs, tt.strategy, DefaultOptions)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.strategy, err)
+		}
+		if result.Failed != 0 {
+			t.Errorf("%s: %d requests failed", tt.strategy, result.Failed)
+		}
+		if h, i := startOf(result, "h"), startOf(result, "i"); h != tt.h || i != tt.i {
+			t.Errorf("%s: h at %d and i at %d, want %d and %d", tt.strategy, h, i, tt.h, tt.i)
+		}
+		if g := startOf(result, "g"); g != 40 {
+			t.Errorf("%s: g at %d, want 40", tt.strategy, g)
+		}
+	}
+}
+
+func TestBuddy(t *testing.T) {
+	result, err := Simulate(128, script(t, "a:20", "b:10", "c:40"), Buddy, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Block{
+		{Start: 0, Size: 32, Name: "a", Requested: 20},
+		{Start: 32, Size: 16, Name: "b", Requested: 10},
+		{Start: 48, Size: 16},
+		{Start: 64, Size: 64, Name: "c", Requested: 40},
+	}
+	if got := result.Blocks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks %+v, want %+v", got, want)
+	}
+	stats := Stats(result.Blocks())
+	if stats.Used != 112 || stats.Free != 16 || stats.Internal != 42 {
+		t.Errorf("stats %+v, want 112 used, 16 free, 42 internal", stats)
+	}
+
+	// Freeing both halves merges them back with their buddies
+	result, err = Simulate(128, script(t, "a:20", "b:10", "c:40", "free:a", "free:b"), Buddy, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []Block{{Start: 0, Size: 64}, {Start: 64, Size: 64, Name: "c", Requested: 40}}
+	if got := result.Blocks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after free: blocks %+v, want %+v", got, want)
+	}
+
+	if _, err := Simulate(100, nil, Buddy, DefaultOptions); err == nil {
+		t.Error("heap of 100: expected an error")
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	reqs := script(t, "a:40", "b:20", "c:40", "free:a", "free:c", "d:60")
+
+	result, err := Simulate(100, reqs, FirstFit, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 1 {
+		t.Errorf("without compaction %d requests failed, want 1", result.Failed)
+	}
+	if stats := Stats(result.Blocks()); stats.External() != 0.5 {
+		t.Errorf("external fragmentation %.2f, want 0.50", stats.External())
+	}
+
+	opts := DefaultOptions
+	opts.AutoCompact = true
+	result, err = Simulate(100, reqs, FirstFit, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := result.Events[len(result.Events)-1]
+	if last.Err != nil || !last.Compacted || last.Moved != 1 {
+		t.Errorf("with compaction: err %v, compacted %v, moved %d", last.Err, last.Compacted, last.Moved)
+	}
+	if b, d := startOf(result, "b"), startOf(result, "d"); b != 0 || d != 20 {
+		t.Errorf("b at %d and d at %d, want 0 and 20", b, d)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Request
+		ok   bool
+	}{
+		{"a:10", Request{Op: Alloc, Name: "a", Size: 10}, true},
+		{"free:a", Request{Op: Free, Name: "a"}, true},
+		{"compact", Request{Op: Compact}, true},
+		{"a:0", Request{}, false},
+		{"a:x", Request{}, false},
+		{"free", Request{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseRequest(tt.spec)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseRequest(%q) = %+v, %v", tt.spec, got, err)
+		}
+	}
+}
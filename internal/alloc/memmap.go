@@ -0,0 +1,74 @@
+package alloc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	holeMark  = '.'
+	wasteMark = '~' // allocated but not requested
+)
+
+// Symbols assigns each allocation in a script the character that stands
+// for it in memory maps. Single character names stand for themselves.
+func Symbols(reqs []Request) map[string]byte {
+	symbols := make(map[string]byte)
+	taken := make(map[byte]bool)
+	for _, req := range reqs {
+		if req.Op == Alloc && len(req.Name) == 1 && req.Name[0] > ' ' &&
+			req.Name[0] != holeMark && req.Name[0] != wasteMark {
+			symbols[req.Name] = req.Name[0]
+			taken[req.Name[0]] = true
+		}
+	}
+
+	pool := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	for _, req := range reqs {
+		if _, ok := symbols[req.Name]; ok || req.Op != Alloc {
+			continue
+		}
+		symbols[req.Name] = '#'
+		for i := 0; i < len(pool); i++ {
+			if !taken[pool[i]] {
+				symbols[req.Name] = pool[i]
+				taken[pool[i]] = true
+				break
+			}
+		}
+	}
+	return symbols
+}
+
+// Map draws a heap as a bar of at most width columns, each standing for an
+// equal share of memory. Holes are dots and internal fragmentation tildes:
+//
+//	|AAAABBBB~~~~....CCCCCCCC........|
+//	0                             1024
+func Map(blocks []Block, size, width int, symbols map[string]byte) string {
+	cells := min(size, max(1, width-2))
+
+	var bar strings.Builder
+	bar.WriteByte('|')
+	b := 0
+	for c := 0; c < cells; c++ {
+		// Each cell shows what is at its midpoint
+		addr := int((float64(c) + 0.5) * float64(size) / float64(cells))
+		for b < len(blocks)-1 && blocks[b].End() <= addr {
+			b++
+		}
+		block := blocks[b]
+		switch {
+		case block.Hole():
+			bar.WriteByte(holeMark)
+		case addr >= block.Start+block.Requested:
+			bar.WriteByte(wasteMark)
+		default:
+			bar.WriteByte(symbols[block.Name])
+		}
+	}
+	bar.WriteByte('|')
+
+	end := fmt.Sprint(size)
+	return fmt.Sprintf("%s\n0%*s", bar.String(), cells+1, end)
+}
@@ -0,0 +1,102 @@
+package alloc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Op is the kind of a request
+type Op int
+
+const (
+	Alloc Op = iota
+	Free
+	Compact
+)
+
+// Request is one step of an allocation script
+type Request struct {
+	Op   Op
+	Name string
+	Size int
+}
+
+func (r Request) String() string {
+	switch r.Op {
+	case Free:
+		return "free " + r.Name
+	case Compact:
+		return "compact"
+	}
+	return fmt.Sprintf("alloc %s %d", r.Name, r.Size)
+}
+
+// ParseRequest parses an inline request: name:size allocates, free:name
+// frees and compact compacts the heap
+func ParseRequest(spec string) (Request, error) {
+	return requestOf(strings.Split(spec, ":"), spec)
+}
+
+// ReadRequests reads an allocation script with one request per line:
+//
+//	alloc name size    (or just: name size)
+//	free name
+//	compact
+//
+// Blank lines and # comments are skipped.
+func ReadRequests(r io.Reader) ([]Request, error) {
+	var reqs []Request
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+
+		req, err := requestOf(fields, strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// requestOf builds a request from its fields
+func requestOf(fields []string, spec string) (Request, error) {
+	switch strings.ToLower(fields[0]) {
+	case "compact":
+		if len(fields) != 1 {
+			return Request{}, fmt.Errorf("%s: compact takes no arguments", spec)
+		}
+		return Request{Op: Compact}, nil
+	case "free":
+		if len(fields) != 2 {
+			return Request{}, fmt.Errorf("%s: expected free name", spec)
+		}
+		return Request{Op: Free, Name: fields[1]}, nil
+	case "alloc", "malloc":
+		fields = fields[1:]
+	}
+
+	if len(fields) != 2 {
+		return Request{}, fmt.Errorf("%s: expected [alloc] name size, free name or compact", spec)
+	}
+	size, err := strconv.Atoi(fields[1])
+	if err != nil || size <= 0 {
+		return Request{}, fmt.Errorf("%s: %s is not a valid size", spec, fields[1])
+	}
+	return Request{Op: Alloc, Name: fields[0], Size: size}, nil
+}
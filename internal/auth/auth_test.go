@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The production work factor makes every hash take a noticeable
+	// fraction of a second
+	Iterations = 1000
+	os.Exit(m.Run())
+}
+
+func TestPBKDF2(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 test vectors from RFC 7914, section 11
+	tests := []struct {
+		password, salt string
+		iterations     int
+		length         int
+		key            string
+	}{
+		{"passwd", "salt", 1, 64,
+			"55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+				"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64,
+			"4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+				"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.length))
+		if got != tt.key {
+			t.Errorf("pbkdf2(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, tt.length, got, tt.key)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts := strings.Split(hash, "$"); len(parts) != 4 || parts[0] != "pbkdf2-sha256" || parts[1] != strconv.Itoa(Iterations) {
+		t.Errorf("hash %q is not pbkdf2-sha256$%d$salt$key", hash, Iterations)
+	}
+	if !CheckPassword(hash, "correct horse") {
+		t.Error("the right password was rejected")
+	}
+
+	tests := []struct {
+		name, hash, password string
+	}{
+		{"wrong password", hash, "correct horsf"},
+		{"empty hash", "", "correct horse"},
+		{"other scheme", strings.Replace(hash, "pbkdf2-sha256", "md5", 1), "correct horse"},
+		{"bad iterations", "pbkdf2-sha256$0$c2FsdA$a2V5", "correct horse"},
+		{"bad salt", "pbkdf2-sha256$1$!!$a2V5", "correct horse"},
+	}
+	for _, tt := range tests {
+		if CheckPassword(tt.hash, tt.password) {
+			t.Errorf("%s: password accepted", tt.name)
+		}
+	}
+
+	// A hash keeps working after the work factor changes
+	defer func(saved int) { Iterations = saved }(Iterations)
+	Iterations /= 2
+	if !CheckPassword(hash, "correct horse") {
+		t.Error("a hash stopped matching when the work factor changed")
+	}
+
+	// Salts are random, so equal passwords hash differently
+	if again, _ := HashPassword("correct horse"); again == hash {
+		t.Error("two hashes of one password are equal")
+	}
+}
+
+func TestLockout(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Add("alice", "secret1", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < MaxFailures; i++ {
+		if _, err := db.Authenticate("alice", "wrong!!"); err == nil || strings.Contains(err.Error(), "locked") {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	// A right password resets the count
+	if _, err := db.Authenticate("alice", "secret1"); err != nil {
+		t.Fatalf("right password: %v", err)
+	}
+	for i := 1; i <= MaxFailures; i++ {
+		_, err = db.Authenticate("alice", "wrong!!")
+	}
+	if err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Fatalf("after %d failures: %v, want a lockout", MaxFailures, err)
+	}
+	if _, err := db.Authenticate("alice", "secret1"); err == nil {
+		t.Error("a locked account accepted the right password")
+	}
+
+	// Changing the password lifts the lockout
+	if err := db.SetPassword("alice", "secret2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Authenticate("alice", "secret2"); err != nil {
+		t.Errorf("after a new password: %v", err)
+	}
+}
+
+func TestSharedFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	first, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Add("alice", "secret1", RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	// A second handle on the file stands in for another shell
+	second, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < MaxFailures-1; i++ {
+		db := first
+		if i%2 == 1 {
+			db = second
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.Authenticate("alice", "wrong!!")
+		}()
+	}
+	wg.Wait()
+
+	u, err := first.Lookup("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Failures != MaxFailures-1 {
+		t.Errorf("%d failures recorded, want %d", u.Failures, MaxFailures-1)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Add("root", "secret1", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Add("root", "secret1", RoleUser); err == nil {
+		t.Error("added a user twice")
+	}
+	if err := db.Add("bob", "secret1", RoleGuest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Remove("root"); err == nil {
+		t.Error("removed the last administrator")
+	}
+	if err := db.Remove("bob"); err != nil {
+		t.Error(err)
+	}
+	if _, err := db.Authenticate("bob", "secret1"); err == nil {
+		t.Error("a removed user logged in")
+	}
+
+	users, err := db.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != "root" {
+		t.Errorf("users %v, want only root", users)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"alice", true},
+		{"a_b.c-1", true},
+		{"", false},
+		{"Alice", false},
+		{"1alice", false},
+		{"-alice", false},
+		{strings.Repeat("a", 33), false},
+	}
+	for _, tt := range tests {
+		if err := ValidName(tt.name); (err == nil) != tt.ok {
+			t.Errorf("ValidName(%q) = %v", tt.name, err)
+		}
+	}
+}
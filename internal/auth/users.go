@@ -0,0 +1,366 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxFailures is how many wrong passwords in a row lock an account
+	MaxFailures = 5
+	// LockoutDuration is how long a locked account refuses logins
+	LockoutDuration = 5 * time.Minute
+	// MinPasswordLength is the shortest password accepted
+	MinPasswordLength = 6
+)
+
+// Roles a user can have
+const (
+	RoleAdmin = "admin" // manages users and permissions
+	RoleUser  = "user"
+	RoleGuest = "guest" // read-only unless a policy says otherwise
+)
+
+// Roles lists the valid roles
+var Roles = []string{RoleAdmin, RoleUser, RoleGuest}
+
+// User is an account in the user database
+type User struct {
+	Name        string    `json:"name"`
+	Role        string    `json:"role"`
+	Hash        string    `json:"hash"`
+	Created     time.Time `json:"created"`
+	LastLogin   time.Time `json:"last_login"`
+	Failures    int       `json:"failures,omitempty"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Locked reports whether the account refuses logins at the given time
+func (u *User) Locked(now time.Time) bool {
+	return now.Before(u.LockedUntil)
+}
+
+// DB is a user database kept in a JSON file. Every operation rereads the
+// file, so several shells can share one database.
+type DB struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns the database stored at path. The file is created with the
+// first user.
+func Open(path string) (*DB, error) {
+	db := &DB{path: path}
+	if _, err := db.load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Path is the file the database is kept in
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Users returns every account, sorted by name
+func (db *DB) Users() ([]User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	users, err := db.load()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]User, 0, len(users))
+	for _, u := range users {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Lookup returns the named account
+func (db *DB) Lookup(name string) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	users, err := db.load()
+	if err != nil {
+		return nil, err
+	}
+	u, ok := users[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such user", name)
+	}
+	return u, nil
+}
+
+// Add creates an account
+func (db *DB) Add(name, password, role string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	if err := ValidRole(role); err != nil {
+		return err
+	}
+	if err := ValidPassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.update(func(users map[string]*User) error {
+		if _, exists := users[name]; exists {
+			return fmt.Errorf("%s: user already exists", name)
+		}
+		users[name] = &User{Name: name, Role: role, Hash: hash, Created: time.Now()}
+		return nil
+	})
+}
+
+// Remove deletes an account. The last administrator cannot be removed.
+func (db *DB) Remove(name string) error {
+	return db.update(func(users map[string]*User) error {
+		u, ok := users[name]
+		if !ok {
+			return fmt.Errorf("%s: no such user", name)
+		}
+		if u.Role == RoleAdmin && countRole(users, RoleAdmin) == 1 {
+			return fmt.Errorf("%s: cannot remove the last administrator", name)
+		}
+		delete(users, name)
+		return nil
+	})
+}
+
+// SetPassword replaces a user's password and lifts any lockout
+func (db *DB) SetPassword(name, password string) error {
+	if err := ValidPassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.update(func(users map[string]*User) error {
+		u, ok := users[name]
+		if !ok {
+			return fmt.Errorf("%s: no such user", name)
+		}
+		u.Hash = hash
+		u.Failures = 0
+		u.LockedUntil = time.Time{}
+		return nil
+	})
+}
+
+// Authenticate checks a user's password. Each wrong password counts
+// towards a lockout; a right one resets the count. The user returned still
+// holds the time of their previous login.
+func (db *DB) Authenticate(name, password string) (*User, error) {
+	var user *User
+	var failed error
+	err := db.update(func(users map[string]*User) error {
+		now := time.Now()
+		u, ok := users[name]
+		if !ok {
+			// Spend as long as a real check so the answer does not
+			// reveal which names exist
+			CheckPassword(dummyHash(), password)
+			failed = fmt.Errorf("incorrect username or password")
+			return errUnchanged
+		}
+		if u.Locked(now) {
+			failed = fmt.Errorf("account %s is locked for another %s", name, remaining(u.LockedUntil, now))
+			return errUnchanged
+		}
+		if !CheckPassword(u.Hash, password) {
+			u.Failures++
+			if u.Failures >= MaxFailures {
+				u.Failures = 0
+				u.LockedUntil = now.Add(LockoutDuration)
+				failed = fmt.Errorf("too many failed attempts: account %s is locked for %s", name, LockoutDuration)
+			} else {
+				failed = fmt.Errorf("incorrect username or password")
+			}
+			return nil
+		}
+		copied := *u
+		user = &copied
+		u.Failures = 0
+		u.LastLogin = now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, failed
+}
+
+// Check verifies a password without counting failures, for confirming the
+// logged in user's identity
+func (db *DB) Check(name, password string) bool {
+	u, err := db.Lookup(name)
+	return err == nil && CheckPassword(u.Hash, password)
+}
+
+// ValidName reports whether name can be used as a user name
+func ValidName(name string) error {
+	if name == "" || len(name) > 32 {
+		return fmt.Errorf("user names must be 1 to 32 characters")
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r == '_':
+		case i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.'):
+		default:
+			return fmt.Errorf("%s: user names use lower case letters, digits, '_', '-' and '.', starting with a letter", name)
+		}
+	}
+	return nil
+}
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role string) error {
+	for _, r := range Roles {
+		if role == r {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: unknown role (roles: %s)", role, strings.Join(Roles, ", "))
+}
+
+// ValidPassword reports whether a password is acceptable
+func ValidPassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("passwords must be at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
+// dummyHash returns a hash to check against when a user does not exist
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("")
+	return hash
+})
+
+// errUnchanged tells update that a change left the users as they were
+var errUnchanged = errors.New("unchanged")
+
+// update applies a change to the users on disk and writes them back. The
+// file lock keeps shells sharing the database from losing each other's
+// changes, such as failed logins counting towards a lockout.
+func (db *DB) update(change func(users map[string]*User) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	unlock, err := db.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	users, err := db.load()
+	if err != nil {
+		return err
+	}
+	if err := change(users); err == errUnchanged {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return db.save(users)
+}
+
+// lock takes an exclusive advisory lock on a file next to the database.
+// The database itself is replaced on every save, so it cannot hold the lock.
+func (db *DB) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(db.path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(db.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: cannot lock: %v", db.path, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// load reads the users on disk; a missing file holds no users
+func (db *DB) load() (map[string]*User, error) {
+	users := make(map[string]*User)
+	data, err := os.ReadFile(db.path)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %v", db.path, err)
+	}
+	for _, u := range list {
+		users[u.Name] = u
+	}
+	return users, nil
+}
+
+// save writes the users to a temporary file and renames it into place, so
+// readers never see a partial database
+func (db *DB) save(users map[string]*User) error {
+	list := make([]*User, 0, len(users))
+	for _, u := range users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(db.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), ".users-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), db.path)
+}
+
+func countRole(users map[string]*User, role string) int {
+	n := 0
+	for _, u := range users {
+		if u.Role == role {
+			n++
+		}
+	}
+	return n
+}
+
+// remaining formats the time left until t, rounded up to the second
+func remaining(t, now time.Time) time.Duration {
+	return t.Sub(now).Truncate(time.Second) + time.Second
+}
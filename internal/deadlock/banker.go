@@ -0,0 +1,166 @@
+package deadlock
+
+import "fmt"
+
+// Step is one process finishing during a safety or detection check
+type Step struct {
+	Process int
+	Work    []int // resources available before it ran
+	Wants   []int // its need, or its outstanding request
+	After   []int // resources available once it released what it held
+}
+
+// Check is the outcome of the safety or detection algorithm. Sequence is
+// the order processes could finish in; Stuck are those that never could.
+type Check struct {
+	Steps    []Step
+	Sequence []int
+	Stuck    []int
+}
+
+// OK reports whether every process could finish
+func (c Check) OK() bool {
+	return len(c.Stuck) == 0
+}
+
+// finishOrder runs the common core of the safety and detection algorithms:
+// scanning the processes in turn, wrapping around, any process whose wants
+// fit in the work vector finishes and returns its allocation
+func finishOrder(available []int, allocation, wants [][]int, done []bool) Check {
+	var c Check
+	work := append([]int(nil), available...)
+	finish := append([]bool(nil), done...)
+
+	for progress := true; progress; {
+		progress = false
+		for i := range wants {
+			if finish[i] || !lessEqual(wants[i], work) {
+				continue
+			}
+			step := Step{Process: i, Work: append([]int(nil), work...), Wants: wants[i]}
+			add(work, allocation[i])
+			step.After = append([]int(nil), work...)
+			finish[i] = true
+			progress = true
+			c.Steps = append(c.Steps, step)
+			c.Sequence = append(c.Sequence, i)
+		}
+	}
+	for i, f := range finish {
+		if !f {
+			c.Stuck = append(c.Stuck, i)
+		}
+	}
+	return c
+}
+
+// Safety runs the Banker's safety algorithm: the state is safe if the
+// processes can finish in some order even if each asks for its whole
+// remaining need
+func (s *State) Safety() Check {
+	return finishOrder(s.Available, s.Allocation, s.Need(), make([]bool, len(s.Processes)))
+}
+
+// Outcome is the result of the resource-request algorithm
+type Outcome struct {
+	Granted bool
+	Reason  string
+	Check   Check // the safety check of the state had the request been granted
+}
+
+// TryRequest runs the Banker's resource-request algorithm. A request that
+// leaves the system safe is granted and applied to the state.
+func (s *State) TryRequest(req PendingRequest) (Outcome, error) {
+	p := req.Process
+	need := s.Need()
+	if !lessEqual(req.Amount, need[p]) {
+		return Outcome{}, fmt.Errorf("%s asked for %s, more than its remaining need %s",
+			s.Processes[p], Vector(req.Amount), Vector(need[p]))
+	}
+	if !lessEqual(req.Amount, s.Available) {
+		return Outcome{Reason: fmt.Sprintf("must wait: only %s available", Vector(s.Available))}, nil
+	}
+
+	trial := *s
+	trial.Available = append([]int(nil), s.Available...)
+	trial.Allocation = clone(s.Allocation)
+	sub(trial.Available, req.Amount)
+	add(trial.Allocation[p], req.Amount)
+
+	check := trial.Safety()
+	if !check.OK() {
+		return Outcome{Reason: "must wait: granting it would leave the system unsafe", Check: check}, nil
+	}
+	s.Available, s.Allocation = trial.Available, trial.Allocation
+	return Outcome{Granted: true, Reason: "granted: the system stays safe", Check: check}, nil
+}
+
+// Detect runs the deadlock detection algorithm on outstanding requests.
+// Processes holding nothing cannot be part of a deadlock and are treated as
+// finished from the start; those left stuck are deadlocked.
+func (s *State) Detect() Check {
+	done := make([]bool, len(s.Processes))
+	for i, row := range s.Allocation {
+		done[i] = isZero(row)
+	}
+	return finishOrder(s.Available, s.Allocation, s.Request, done)
+}
+
+// Victim is a process suggested for termination to end a deadlock
+type Victim struct {
+	Process  int
+	Releases []int // what terminating it frees
+	Freed    int   // how many deadlocked processes can then finish
+}
+
+// Victims suggests processes to terminate, one at a time, until no deadlock
+// is left. Each pick is the deadlocked process whose termination lets the
+// most others finish, preferring the one holding least when there is a tie,
+// since that loses the least work.
+func (s *State) Victims() []Victim {
+	available := append([]int(nil), s.Available...)
+	allocation := clone(s.Allocation)
+	request := clone(s.Request)
+	trial := &State{Processes: s.Processes, Resources: s.Resources}
+
+	var victims []Victim
+	for {
+		trial.Available, trial.Allocation, trial.Request = available, allocation, request
+		stuck := trial.Detect().Stuck
+		if len(stuck) == 0 {
+			return victims
+		}
+
+		best := Victim{Process: -1}
+		bestHeld := 0
+		for _, p := range stuck {
+			after := append([]int(nil), available...)
+			add(after, allocation[p])
+			rest := clone(allocation)
+			rest[p] = make([]int, len(s.Resources))
+			reqs := clone(request)
+			reqs[p] = make([]int, len(s.Resources))
+			left := (&State{Available: after, Allocation: rest, Request: reqs, Processes: s.Processes}).Detect().Stuck
+
+			freed := len(stuck) - 1 - len(left)
+			held := sum(allocation[p])
+			if best.Process < 0 || freed > best.Freed || (freed == best.Freed && held < bestHeld) {
+				best = Victim{Process: p, Releases: append([]int(nil), allocation[p]...), Freed: freed}
+				bestHeld = held
+			}
+		}
+
+		victims = append(victims, best)
+		add(available, allocation[best.Process])
+		allocation[best.Process] = make([]int, len(s.Resources))
+		request[best.Process] = make([]int, len(s.Resources))
+	}
+}
+
+func sum(v []int) int {
+	total := 0
+	for _, n := range v {
+		total += n
+	}
+	return total
+}
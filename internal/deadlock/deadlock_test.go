@@ -0,0 +1,159 @@
+package deadlock
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bankerScenario is the Banker's algorithm example from Silberschatz et al.
+const bankerScenario = `
+resources A B C
+available 3 3 2
+alloc P0 0 1 0
+alloc P1 2 0 0
+alloc P2 3 0 2
+alloc P3 2 1 1
+alloc P4 0 0 2
+max P0 7 5 3
+max P1 3 2 2
+max P2 9 0 2
+max P3 2 2 2
+max P4 4 3 3
+request P1 1 0 2
+request P4 3 3 0
+request P0 0 2 0
+`
+
+// detectionScenario is the matching deadlock detection example
+const detectionScenario = `
+resources A B C
+available 0 0 0
+alloc P0 0 1 0
+alloc P1 2 0 0
+alloc P2 3 0 3
+alloc P3 2 1 1
+alloc P4 0 0 2
+waiting P0 0 0 0
+waiting P1 2 0 2
+waiting P2 0 0 0
+waiting P3 1 0 0
+waiting P4 0 0 2
+`
+
+func readScenario(t *testing.T, text string) *State {
+	t.Helper()
+	s, err := ReadScenario(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBankerSafety(t *testing.T) {
+	s := readScenario(t, bankerScenario)
+	want := [][]int{{7, 4, 3}, {1, 2, 2}, {6, 0, 0}, {0, 1, 1}, {4, 3, 1}}
+	if got := s.Need(); !reflect.DeepEqual(got, want) {
+		t.Errorf("need %v, want %v", got, want)
+	}
+
+	check := s.Safety()
+	if !check.OK() {
+		t.Fatalf("unsafe, stuck %v", check.Stuck)
+	}
+	if want := []int{1, 3, 4, 0, 2}; !reflect.DeepEqual(check.Sequence, want) {
+		t.Errorf("safe sequence %v, want %v", check.Sequence, want)
+	}
+}
+
+func TestBankerRequests(t *testing.T) {
+	s := readScenario(t, bankerScenario)
+	if len(s.Pending) != 3 {
+		t.Fatalf("%d pending requests, want 3", len(s.Pending))
+	}
+
+	// Tried in order, each against the state the previous ones left
+	tests := []struct {
+		process string
+		granted bool
+		reason  string
+	}{
+		{"P1", true, "granted"},
+		{"P4", false, "only 2 3 0 available"},
+		{"P0", false, "unsafe"},
+	}
+	for i, tt := range tests {
+		req := s.Pending[i]
+		if got := s.Processes[req.Process]; got != tt.process {
+			t.Fatalf("request %d is from %s, want %s", i+1, got, tt.process)
+		}
+		outcome, err := s.TryRequest(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.process, err)
+		}
+		if outcome.Granted != tt.granted || !strings.Contains(outcome.Reason, tt.reason) {
+			t.Errorf("%s: granted %v (%s), want %v (%s)", tt.process, outcome.Granted, outcome.Reason, tt.granted, tt.reason)
+		}
+	}
+	if want := []int{2, 3, 0}; !reflect.DeepEqual(s.Available, want) {
+		t.Errorf("available %v after the requests, want %v", s.Available, want)
+	}
+
+	// Asking for more than the remaining need is an error, not a wait
+	if _, err := s.TryRequest(PendingRequest{Process: 3, Amount: []int{0, 2, 0}}); err == nil {
+		t.Error("request over the need was accepted")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	s := readScenario(t, detectionScenario)
+	check := s.Detect()
+	if !check.OK() {
+		t.Fatalf("deadlock detected, stuck %v", check.Stuck)
+	}
+	if want := []int{0, 2, 3, 4, 1}; !reflect.DeepEqual(check.Sequence, want) {
+		t.Errorf("finish order %v, want %v", check.Sequence, want)
+	}
+	if victims := s.Victims(); len(victims) != 0 {
+		t.Errorf("victims %v with no deadlock", victims)
+	}
+
+	// Once P2 also wants one more C, only P0 can finish
+	s.Request[2] = []int{0, 0, 1}
+	check = s.Detect()
+	if want := []int{1, 2, 3, 4}; !reflect.DeepEqual(check.Stuck, want) {
+		t.Errorf("deadlocked %v, want %v", check.Stuck, want)
+	}
+
+	victims := s.Victims()
+	if len(victims) == 0 {
+		t.Fatal("no victims suggested")
+	}
+	for _, v := range victims {
+		s.Allocation[v.Process] = make([]int, len(s.Resources))
+		s.Request[v.Process] = make([]int, len(s.Resources))
+		for r, n := range v.Releases {
+			s.Available[r] += n
+		}
+	}
+	if check := s.Detect(); !check.OK() {
+		t.Errorf("still deadlocked after terminating the victims: %v", check.Stuck)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	s := readScenario(t, `
+resource R1 1
+resource R2 1
+P1 holds R1
+P1 wants R2
+P2 holds R2
+P2 wants R1
+`)
+	if cycles := s.Cycles(); len(cycles) != 1 {
+		t.Errorf("cycles %v, want one", cycles)
+	}
+	if check := s.Detect(); len(check.Stuck) != 2 {
+		t.Errorf("deadlocked %v, want both processes", check.Stuck)
+	}
+}
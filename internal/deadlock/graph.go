@@ -0,0 +1,146 @@
+package deadlock
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxCycles bounds how many cycles Cycles reports
+const maxCycles = 20
+
+// Edge is an edge of the resource-allocation graph: a request edge from a
+// process to a resource, or an assignment edge from a resource to a process
+type Edge struct {
+	Process  int
+	Resource int
+	Count    int
+	Request  bool
+}
+
+// Edges lists the resource-allocation graph's edges, assignments first
+func (s *State) Edges() []Edge {
+	var edges []Edge
+	for _, request := range []bool{false, true} {
+		m := s.Allocation
+		if request {
+			m = s.Request
+		}
+		for p, row := range m {
+			for r, n := range row {
+				if n > 0 {
+					edges = append(edges, Edge{Process: p, Resource: r, Count: n, Request: request})
+				}
+			}
+		}
+	}
+	return edges
+}
+
+// WaitsFor is the wait-for graph: process i waits for process j when i
+// requests more of a resource than is available and j holds some of it
+func (s *State) WaitsFor() [][]int {
+	waits := make([][]int, len(s.Processes))
+	for i, row := range s.Request {
+		for r, n := range row {
+			if n == 0 || n <= s.Available[r] {
+				continue
+			}
+			for j := range s.Processes {
+				if j != i && s.Allocation[j][r] > 0 && !contains(waits[i], j) {
+					waits[i] = append(waits[i], j)
+				}
+			}
+		}
+		sort.Ints(waits[i])
+	}
+	return waits
+}
+
+// Cycles finds the cycles of the wait-for graph, each starting from its
+// lowest numbered process. With single-instance resources any cycle is a
+// deadlock; with several instances a cycle is necessary but not enough.
+func (s *State) Cycles() [][]int {
+	waits := s.WaitsFor()
+	var cycles [][]int
+	var path []int
+	onPath := make([]bool, len(waits))
+
+	var visit func(start, p int)
+	visit = func(start, p int) {
+		if len(cycles) >= maxCycles {
+			return
+		}
+		path = append(path, p)
+		onPath[p] = true
+		for _, q := range waits[p] {
+			switch {
+			case q == start:
+				cycles = append(cycles, append([]int(nil), path...))
+			case q > start && !onPath[q]:
+				visit(start, q)
+			}
+		}
+		path = path[:len(path)-1]
+		onPath[p] = false
+	}
+	for start := range waits {
+		visit(start, start)
+	}
+	return cycles
+}
+
+// CycleText formats a cycle as P1 -> P2 -> P1
+func (s *State) CycleText(cycle []int) string {
+	names := make([]string, 0, len(cycle)+1)
+	for _, p := range cycle {
+		names = append(names, s.Processes[p])
+	}
+	names = append(names, s.Processes[cycle[0]])
+	return strings.Join(names, " -> ")
+}
+
+// Dot renders the resource-allocation graph in Graphviz's dot language,
+// with deadlocked processes highlighted
+func (s *State) Dot(deadlocked []int) string {
+	var b strings.Builder
+	b.WriteString("digraph rag {\n\trankdir=LR;\n")
+	for p, name := range s.Processes {
+		style := ""
+		if contains(deadlocked, p) {
+			style = ", color=red, fontcolor=red"
+		}
+		fmt.Fprintf(&b, "\t%q [shape=circle%s];\n", name, style)
+	}
+	total := s.Total()
+	for r, name := range s.Resources {
+		fmt.Fprintf(&b, "\t%q [shape=box, label=\"%s (%d)\"];\n", name, name, total[r])
+	}
+	for _, e := range s.Edges() {
+		from, to := s.Resources[e.Resource], s.Processes[e.Process]
+		var attrs []string
+		if e.Request {
+			from, to = to, from
+			attrs = append(attrs, "style=dashed")
+		}
+		if e.Count > 1 {
+			attrs = append(attrs, fmt.Sprintf("label=\"%d\"", e.Count))
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", from, to)
+			continue
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [%s];\n", from, to, strings.Join(attrs, ", "))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func contains(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
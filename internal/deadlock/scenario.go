@@ -0,0 +1,308 @@
+package deadlock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadScenario reads a system description, one statement per line. Counts
+// are listed in resource order and may be separated by spaces or commas;
+// blank lines and # comments are skipped.
+//
+//	resources A B C          name the resources
+//	resource R1 2            or declare them one at a time with their instances
+//	available 3 3 2          free instances (or: total 10 5 7)
+//	alloc P0 0 1 0           what a process holds
+//	max P0 7 5 3             its maximum claim (or: need P0 7 4 3)
+//	request P1 1 0 2         a request for the Banker's algorithm to try
+//	waiting P1 0 0 1         what it is blocked waiting for, for detection
+//	P1 holds R1 [n]          resource-allocation graph edges
+//	P1 wants R2 [n]
+func ReadScenario(r io.Reader) (*State, error) {
+	sc := &scenario{
+		procs:    make(map[string]int),
+		res:      make(map[string]int),
+		declared: make(map[int]int),
+		rows:     make(map[string]map[int][]int),
+	}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if err := sc.statement(fields); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sc.build()
+}
+
+// scenario collects statements until the whole system is known
+type scenario struct {
+	processes []string
+	procs     map[string]int
+	resources []string
+	res       map[string]int
+	named     bool // resources were named up front
+
+	declared  map[int]int // instances of resources declared one at a time
+	available []int
+	total     []int
+	rows      map[string]map[int][]int // alloc, max, need and waiting rows by process
+	edges     []Edge
+	pending   []PendingRequest
+}
+
+func (sc *scenario) statement(fields []string) error {
+	keyword, args := strings.ToLower(fields[0]), fields[1:]
+	switch keyword {
+	case "resources":
+		if len(sc.resources) > 0 {
+			return fmt.Errorf("resources are already known")
+		}
+		for _, name := range args {
+			sc.resource(name)
+		}
+		sc.named = true
+		return nil
+	case "resource":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("expected resource name [instances]")
+		}
+		count := 1
+		if len(args) == 2 {
+			n, err := count1(args[1])
+			if err != nil {
+				return err
+			}
+			count = n
+		}
+		sc.declared[sc.resource(args[0])] = count
+		return nil
+	case "processes":
+		for _, name := range args {
+			sc.process(name)
+		}
+		return nil
+	case "available", "total":
+		v, err := sc.vector(args)
+		if err != nil {
+			return err
+		}
+		if keyword == "available" {
+			sc.available = v
+		} else {
+			sc.total = v
+		}
+		return nil
+	case "alloc", "allocation", "max", "need", "request", "waiting":
+		if len(args) < 2 {
+			return fmt.Errorf("expected %s process counts...", keyword)
+		}
+		p := sc.process(args[0])
+		v, err := sc.vector(args[1:])
+		if err != nil {
+			return err
+		}
+		switch keyword {
+		case "request":
+			sc.pending = append(sc.pending, PendingRequest{Process: p, Amount: v})
+			return nil
+		case "allocation":
+			keyword = "alloc"
+		}
+		if sc.rows[keyword] == nil {
+			sc.rows[keyword] = make(map[int][]int)
+		}
+		if _, dup := sc.rows[keyword][p]; dup {
+			return fmt.Errorf("%s is given twice for %s", keyword, args[0])
+		}
+		sc.rows[keyword][p] = v
+		return nil
+	}
+
+	// process holds|wants resource [count]
+	if len(fields) < 3 || len(fields) > 4 {
+		return fmt.Errorf("%s: unknown statement", fields[0])
+	}
+	var request bool
+	switch strings.ToLower(fields[1]) {
+	case "holds", "has":
+		request = false
+	case "wants", "requests", "waits-for":
+		request = true
+	default:
+		return fmt.Errorf("%s: expected holds or wants", fields[1])
+	}
+	count := 1
+	if len(fields) == 4 {
+		n, err := count1(fields[3])
+		if err != nil {
+			return err
+		}
+		count = n
+	}
+	if sc.named {
+		if _, ok := sc.res[fields[2]]; !ok {
+			return fmt.Errorf("%s: unknown resource", fields[2])
+		}
+	}
+	sc.edges = append(sc.edges, Edge{Process: sc.process(fields[0]), Resource: sc.resource(fields[2]),
+		Count: count, Request: request})
+	return nil
+}
+
+// process returns the index of a process, adding it if it is new
+func (sc *scenario) process(name string) int {
+	if i, ok := sc.procs[name]; ok {
+		return i
+	}
+	sc.procs[name] = len(sc.processes)
+	sc.processes = append(sc.processes, name)
+	return len(sc.processes) - 1
+}
+
+// resource returns the index of a resource, adding it if it is new
+func (sc *scenario) resource(name string) int {
+	if i, ok := sc.res[name]; ok {
+		return i
+	}
+	sc.res[name] = len(sc.resources)
+	sc.resources = append(sc.resources, name)
+	return len(sc.resources) - 1
+}
+
+// vector parses a row of counts. The first row names the resources A, B,
+// C... when they have not been named.
+func (sc *scenario) vector(args []string) ([]int, error) {
+	if len(sc.resources) == 0 {
+		for i := range args {
+			sc.resource(resourceName(i))
+		}
+	}
+	if len(args) != len(sc.resources) {
+		return nil, fmt.Errorf("expected %d counts, one per resource, got %d", len(sc.resources), len(args))
+	}
+	v := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s: invalid count", arg)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// resourceName names the i'th unnamed resource A to Z, then R27 onwards
+func resourceName(i int) string {
+	if i < 26 {
+		return string(rune('A' + i))
+	}
+	return fmt.Sprintf("R%d", i+1)
+}
+
+func count1(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s: invalid count", arg)
+	}
+	return n, nil
+}
+
+// build assembles the state once every statement has been read
+func (sc *scenario) build() (*State, error) {
+	np, nr := len(sc.processes), len(sc.resources)
+	if np == 0 {
+		return nil, fmt.Errorf("no processes")
+	}
+	if nr == 0 {
+		return nil, fmt.Errorf("no resources")
+	}
+	// Rows read before later resources were declared are too short
+	matrix := func(kind string) [][]int {
+		m := make([][]int, np)
+		for p := range m {
+			m[p] = make([]int, nr)
+			copy(m[p], sc.rows[kind][p])
+		}
+		return m
+	}
+
+	s := &State{Processes: sc.processes, Resources: sc.resources, Pending: sc.pending}
+	s.Allocation = matrix("alloc")
+	request := matrix("waiting")
+	for _, e := range sc.edges {
+		if e.Request {
+			request[e.Process][e.Resource] += e.Count
+		} else {
+			s.Allocation[e.Process][e.Resource] += e.Count
+		}
+	}
+
+	if sc.rows["max"] != nil || sc.rows["need"] != nil {
+		s.Max = make([][]int, np)
+		for p := range s.Max {
+			claim, hasMax := sc.rows["max"][p]
+			need, hasNeed := sc.rows["need"][p]
+			switch {
+			case hasMax && hasNeed:
+				return nil, fmt.Errorf("%s has both a max and a need row", sc.processes[p])
+			case hasMax:
+				s.Max[p] = append([]int(nil), claim...)
+			case hasNeed:
+				s.Max[p] = append([]int(nil), need...)
+				add(s.Max[p], s.Allocation[p])
+			default:
+				return nil, fmt.Errorf("%s has no max or need row", sc.processes[p])
+			}
+		}
+	}
+
+	// Without claims there is nothing to do but detection, even if
+	// nobody is waiting
+	if sc.rows["waiting"] != nil || len(sc.edges) > 0 || s.Max == nil {
+		s.Request = request
+	}
+
+	held := make([]int, nr)
+	for _, row := range s.Allocation {
+		add(held, row)
+	}
+	switch {
+	case sc.available != nil:
+		s.Available = sc.available
+	case sc.total != nil:
+		s.Available = append([]int(nil), sc.total...)
+		sub(s.Available, held)
+	default:
+		// Resources of a graph have as many instances as declared, or
+		// a single one
+		s.Available = make([]int, nr)
+		for r := range s.Available {
+			total, ok := sc.declared[r]
+			if !ok {
+				total = max(1, held[r])
+			}
+			s.Available[r] = total - held[r]
+		}
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,173 @@
+package deadlock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// State is a system of processes and resources. Max is each process's
+// maximum claim, used by the Banker's algorithm, and Request what each
+// process is blocked waiting for, used by deadlock detection; either may be
+// nil.
+type State struct {
+	Processes  []string
+	Resources  []string
+	Available  []int
+	Allocation [][]int
+	Max        [][]int
+	Request    [][]int
+
+	// Pending are requests for the Banker's algorithm to try in order
+	Pending []PendingRequest
+}
+
+// PendingRequest is a process asking for more resources
+type PendingRequest struct {
+	Process int
+	Amount  []int
+}
+
+// Total is the number of instances of each resource
+func (s *State) Total() []int {
+	total := append([]int(nil), s.Available...)
+	for _, row := range s.Allocation {
+		add(total, row)
+	}
+	return total
+}
+
+// Need is what each process may still ask for before reaching its maximum
+// claim
+func (s *State) Need() [][]int {
+	need := make([][]int, len(s.Processes))
+	for i := range need {
+		need[i] = make([]int, len(s.Resources))
+		for r := range need[i] {
+			need[i][r] = s.Max[i][r] - s.Allocation[i][r]
+		}
+	}
+	return need
+}
+
+// Validate checks that the matrices agree with each other
+func (s *State) Validate() error {
+	if len(s.Processes) == 0 {
+		return fmt.Errorf("no processes")
+	}
+	if len(s.Resources) == 0 {
+		return fmt.Errorf("no resources")
+	}
+	if len(s.Available) != len(s.Resources) {
+		return fmt.Errorf("available lists %d resources, not %d", len(s.Available), len(s.Resources))
+	}
+	for _, n := range s.Available {
+		if n < 0 {
+			return fmt.Errorf("more resources are allocated than exist")
+		}
+	}
+
+	check := func(what string, m [][]int) error {
+		if m == nil {
+			return nil
+		}
+		if len(m) != len(s.Processes) {
+			return fmt.Errorf("%s has %d rows, not one per process (%d)", what, len(m), len(s.Processes))
+		}
+		for i, row := range m {
+			if len(row) != len(s.Resources) {
+				return fmt.Errorf("%s: %s has %d columns, not %d", what, s.Processes[i], len(row), len(s.Resources))
+			}
+			for _, n := range row {
+				if n < 0 {
+					return fmt.Errorf("%s: %s has a negative count", what, s.Processes[i])
+				}
+			}
+		}
+		return nil
+	}
+	if err := check("allocation", s.Allocation); err != nil {
+		return err
+	}
+	if err := check("max", s.Max); err != nil {
+		return err
+	}
+	if err := check("request", s.Request); err != nil {
+		return err
+	}
+	if s.Allocation == nil {
+		return fmt.Errorf("no allocation given")
+	}
+	if s.Max == nil && s.Request == nil {
+		return fmt.Errorf("no maximum claims or outstanding requests given")
+	}
+
+	if s.Max != nil {
+		for i := range s.Processes {
+			if !lessEqual(s.Allocation[i], s.Max[i]) {
+				return fmt.Errorf("%s holds more than its maximum claim", s.Processes[i])
+			}
+		}
+	}
+	for _, req := range s.Pending {
+		if len(req.Amount) != len(s.Resources) {
+			return fmt.Errorf("request by %s lists %d resources, not %d",
+				s.Processes[req.Process], len(req.Amount), len(s.Resources))
+		}
+	}
+	return nil
+}
+
+// Vector formats a row of counts
+func Vector(v []int) string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = fmt.Sprint(n)
+	}
+	return strings.Join(parts, " ")
+}
+
+// lessEqual reports whether a <= b element by element
+func lessEqual(a, b []int) bool {
+	for i := range a {
+		if a[i] > b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// add adds b to a element by element
+func add(a, b []int) {
+	for i := range a {
+		a[i] += b[i]
+	}
+}
+
+// sub subtracts b from a element by element
+func sub(a, b []int) {
+	for i := range a {
+		a[i] -= b[i]
+	}
+}
+
+// isZero reports whether every count in v is zero
+func isZero(v []int) bool {
+	for _, n := range v {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// clone copies a matrix
+func clone(m [][]int) [][]int {
+	if m == nil {
+		return nil
+	}
+	c := make([][]int, len(m))
+	for i, row := range m {
+		c[i] = append([]int(nil), row...)
+	}
+	return c
+}
@@ -0,0 +1,62 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chart draws the head's path with one row per move and cylinders across,
+// scaled to fit in width columns. The head's position after each move is an
+// o; returns to the other end of the disk are dotted.
+//
+//	        0                                                    199
+//	 53    |            o
+//	 98    |            ------->o
+//	183    |                    ---------------->o
+func Chart(r *Result, width int) string {
+	const labelWidth = 10
+	cells := max(10, width-labelWidth-1)
+	cells = min(cells, r.Cylinders)
+	col := func(cylinder int) int {
+		if r.Cylinders == 1 {
+			return 0
+		}
+		return cylinder * (cells - 1) / (r.Cylinders - 1)
+	}
+
+	var b strings.Builder
+	last := fmt.Sprint(r.Cylinders - 1)
+	fmt.Fprintf(&b, "%*s0%*s\n", labelWidth, "", cells-1, last)
+
+	row := func(cylinder int, draw func(line []byte)) {
+		line := []byte(strings.Repeat(" ", cells))
+		draw(line)
+		fmt.Fprintf(&b, "%*d    |%s\n", labelWidth-5, cylinder, strings.TrimRight(string(line), " "))
+	}
+
+	row(r.Start, func(line []byte) { line[col(r.Start)] = 'o' })
+	for _, m := range r.Moves {
+		row(m.To, func(line []byte) {
+			from, to := col(m.From), col(m.To)
+			fill := byte('-')
+			if m.Return {
+				fill = '.'
+			}
+			lo, hi := min(from, to), max(from, to)
+			for c := lo; c <= hi; c++ {
+				line[c] = fill
+			}
+			switch {
+			case to > from:
+				line[to-1] = '>'
+			case to < from:
+				line[to+1] = '<'
+			}
+			line[to] = 'o'
+			if !m.Request {
+				line[to] = '|'
+			}
+		})
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,259 @@
+package disk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Algorithm is a disk scheduling algorithm
+type Algorithm string
+
+const (
+	FCFS  Algorithm = "fcfs"   // serve requests in arrival order
+	SSTF  Algorithm = "sstf"   // serve the closest request next
+	SCAN  Algorithm = "scan"   // sweep to the end of the disk, then back
+	CSCAN Algorithm = "c-scan" // sweep to the end, return to the start, sweep again
+	LOOK  Algorithm = "look"   // SCAN, turning at the last request instead of the end
+	CLOOK Algorithm = "c-look" // C-SCAN, returning only as far as the first request
+)
+
+// Algorithms lists every algorithm, in the order comparisons show them
+var Algorithms = []Algorithm{FCFS, SSTF, SCAN, CSCAN, LOOK, CLOOK}
+
+// ParseAlgorithm accepts an algorithm's name or a common alias
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "fcfs", "fifo":
+		return FCFS, nil
+	case "sstf":
+		return SSTF, nil
+	case "scan", "elevator":
+		return SCAN, nil
+	case "c-scan", "cscan":
+		return CSCAN, nil
+	case "look":
+		return LOOK, nil
+	case "c-look", "clook":
+		return CLOOK, nil
+	}
+	return "", fmt.Errorf("%s: unknown algorithm", name)
+}
+
+// Title names an algorithm
+func (a Algorithm) Title() string {
+	switch a {
+	case FCFS:
+		return "First come, first served"
+	case SSTF:
+		return "Shortest seek time first"
+	case SCAN:
+		return "SCAN (elevator)"
+	case CSCAN:
+		return "Circular SCAN"
+	case LOOK:
+		return "LOOK"
+	case CLOOK:
+		return "Circular LOOK"
+	}
+	return string(a)
+}
+
+// Direction is the way the head is moving
+type Direction int
+
+const (
+	Up   Direction = 1  // towards higher cylinders
+	Down Direction = -1 // towards cylinder 0
+)
+
+func (d Direction) String() string {
+	if d == Down {
+		return "down"
+	}
+	return "up"
+}
+
+// ParseDirection accepts up or down and their synonyms
+func ParseDirection(name string) (Direction, error) {
+	switch strings.ToLower(name) {
+	case "up", "right", "higher", "+":
+		return Up, nil
+	case "down", "left", "lower", "-":
+		return Down, nil
+	}
+	return 0, fmt.Errorf("%s: direction must be up or down", name)
+}
+
+// Move is the head travelling between two cylinders. Request is false for
+// a move to the edge of the disk to turn around, and Return marks the
+// circular algorithms' jump back to the other end.
+type Move struct {
+	From, To int
+	Request  bool
+	Return   bool
+}
+
+// Distance is how many cylinders the move crosses
+func (m Move) Distance() int {
+	if m.To > m.From {
+		return m.To - m.From
+	}
+	return m.From - m.To
+}
+
+// Result is the outcome of scheduling a request queue
+type Result struct {
+	Algorithm Algorithm
+	Start     int
+	Cylinders int
+	Direction Direction
+	Moves     []Move
+	Order     []int // requests in the order they were served
+}
+
+// Movement is the total head movement in cylinders, including returns
+func (r *Result) Movement() int {
+	total := 0
+	for _, m := range r.Moves {
+		total += m.Distance()
+	}
+	return total
+}
+
+// Returned is the head movement spent on the circular algorithms' returns
+func (r *Result) Returned() int {
+	total := 0
+	for _, m := range r.Moves {
+		if m.Return {
+			total += m.Distance()
+		}
+	}
+	return total
+}
+
+// Simulate schedules a queue of cylinder requests on a disk with cylinders
+// cylinders, starting with the head at start moving in direction dir. SCAN
+// and C-SCAN only travel to the edge of the disk when there are requests
+// left to serve beyond it.
+func Simulate(requests []int, start, cylinders int, dir Direction, alg Algorithm) (*Result, error) {
+	if cylinders <= 0 {
+		return nil, fmt.Errorf("the number of cylinders must be positive")
+	}
+	if start < 0 || start >= cylinders {
+		return nil, fmt.Errorf("head position %d is outside cylinders 0-%d", start, cylinders-1)
+	}
+	for _, c := range requests {
+		if c < 0 || c >= cylinders {
+			return nil, fmt.Errorf("request %d is outside cylinders 0-%d", c, cylinders-1)
+		}
+	}
+	if _, err := ParseAlgorithm(string(alg)); err != nil {
+		return nil, err
+	}
+
+	r := &Result{Algorithm: alg, Start: start, Cylinders: cylinders, Direction: dir}
+	head := start
+	move := func(to int, request, ret bool) {
+		r.Moves = append(r.Moves, Move{From: head, To: to, Request: request, Return: ret})
+		head = to
+		if request {
+			r.Order = append(r.Order, to)
+		}
+	}
+
+	switch alg {
+	case FCFS:
+		for _, c := range requests {
+			move(c, true, false)
+		}
+	case SSTF:
+		pending := append([]int(nil), requests...)
+		for len(pending) > 0 {
+			best := 0
+			for i, c := range pending {
+				d, bd := distance(head, c), distance(head, pending[best])
+				// Ties go the way the head is already moving
+				if d < bd || (d == bd && (c-head)*int(dir) > 0) {
+					best = i
+				}
+			}
+			next := pending[best]
+			pending = append(pending[:best], pending[best+1:]...)
+			if next != head {
+				dir = Up
+				if next < head {
+					dir = Down
+				}
+			}
+			move(next, true, false)
+		}
+	default:
+		ahead, behind := split(requests, head, dir)
+		for _, c := range ahead {
+			move(c, true, false)
+		}
+		if len(behind) == 0 {
+			break
+		}
+
+		edge, other := cylinders-1, 0
+		if dir == Down {
+			edge, other = 0, cylinders-1
+		}
+		switch alg {
+		case SCAN:
+			if head != edge {
+				move(edge, false, false)
+			}
+		case CSCAN:
+			if head != edge {
+				move(edge, false, false)
+			}
+			move(other, false, true)
+			// Served from the far end in the original direction
+			reverse(behind)
+		case CLOOK:
+			reverse(behind)
+			move(behind[0], true, true)
+			behind = behind[1:]
+		}
+		for _, c := range behind {
+			move(c, true, false)
+		}
+	}
+	return r, nil
+}
+
+// split sorts requests into those at or ahead of the head, in the order the
+// head meets them, and those behind it, nearest first
+func split(requests []int, head int, dir Direction) (ahead, behind []int) {
+	sorted := append([]int(nil), requests...)
+	sort.Ints(sorted)
+	for _, c := range sorted {
+		if (c-head)*int(dir) >= 0 {
+			ahead = append(ahead, c)
+		} else {
+			behind = append(behind, c)
+		}
+	}
+	if dir == Down {
+		reverse(ahead)
+	} else {
+		reverse(behind)
+	}
+	return ahead, behind
+}
+
+func reverse(s []int) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
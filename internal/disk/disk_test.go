@@ -0,0 +1,91 @@
+package disk
+
+import (
+	"reflect"
+	"testing"
+)
+
+// textbookQueue is the request queue from Silberschatz et al., with the
+// head at cylinder 53 of 200
+var textbookQueue = []int{98, 183, 37, 122, 14, 124, 65, 67}
+
+func TestSimulateMovement(t *testing.T) {
+	tests := []struct {
+		alg      Algorithm
+		movement int
+		returned int
+		order    []int
+	}{
+		{FCFS, 640, 0, []int{98, 183, 37, 122, 14, 124, 65, 67}},
+		{SSTF, 236, 0, []int{65, 67, 37, 14, 98, 122, 124, 183}},
+		{SCAN, 331, 0, []int{65, 67, 98, 122, 124, 183, 37, 14}},
+		{CSCAN, 382, 199, []int{65, 67, 98, 122, 124, 183, 14, 37}},
+		{LOOK, 299, 0, []int{65, 67, 98, 122, 124, 183, 37, 14}},
+		{CLOOK, 322, 169, []int{65, 67, 98, 122, 124, 183, 14, 37}},
+	}
+
+	for _, tt := range tests {
+		result, err := Simulate(textbookQueue, 53, 200, Up, tt.alg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.alg, err)
+		}
+		if got := result.Movement(); got != tt.movement {
+			t.Errorf("%s: movement %d, want %d", tt.alg, got, tt.movement)
+		}
+		if got := result.Returned(); got != tt.returned {
+			t.Errorf("%s: returned %d, want %d", tt.alg, got, tt.returned)
+		}
+		if !reflect.DeepEqual(result.Order, tt.order) {
+			t.Errorf("%s: order %v, want %v", tt.alg, result.Order, tt.order)
+		}
+	}
+}
+
+func TestSimulateDown(t *testing.T) {
+	tests := []struct {
+		alg      Algorithm
+		movement int
+	}{
+		{SCAN, 236},  // 53 down to 0, then up to 183
+		{LOOK, 208},  // 53 down to 14, then up to 183
+		{CLOOK, 326}, // 53 down to 14, back to 183, down to 65
+	}
+	for _, tt := range tests {
+		result, err := Simulate(textbookQueue, 53, 200, Down, tt.alg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.alg, err)
+		}
+		if got := result.Movement(); got != tt.movement {
+			t.Errorf("%s down: movement %d, want %d", tt.alg, got, tt.movement)
+		}
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  []int
+		start     int
+		cylinders int
+	}{
+		{"no cylinders", textbookQueue, 53, 0},
+		{"head off the disk", textbookQueue, 200, 200},
+		{"request off the disk", []int{10, 250}, 53, 200},
+	}
+	for _, tt := range tests {
+		if _, err := Simulate(tt.requests, tt.start, tt.cylinders, Up, FCFS); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	for _, alg := range Algorithms {
+		if got, err := ParseAlgorithm(string(alg)); err != nil || got != alg {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v", alg, got, err)
+		}
+	}
+	if _, err := ParseAlgorithm("elevator-ish"); err == nil {
+		t.Error("unknown algorithm: expected an error")
+	}
+}
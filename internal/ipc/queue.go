@@ -0,0 +1,154 @@
+package ipc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by Send once a queue is closed, and by Receive
+	// once it is closed and empty
+	ErrClosed = errors.New("queue closed")
+	// ErrStopped is returned when a blocked Send or Receive is given up
+	ErrStopped = errors.New("stopped")
+)
+
+// Message is a line of text passed through a queue
+type Message struct {
+	Body string
+	From string // who sent it, such as "shell" or "job [2]"
+	Sent time.Time
+}
+
+// Queue is a bounded FIFO of messages. Senders block while it is full and
+// receivers while it is empty.
+type Queue struct {
+	mu       sync.Mutex
+	capacity int
+	messages []Message
+	closed   bool
+	changed  chan struct{} // closed and replaced whenever the queue changes
+
+	sent, received     int
+	sending, receiving int // callers blocked in Send and Receive
+}
+
+// NewQueue returns an empty queue holding at most capacity messages
+func NewQueue(capacity int) *Queue {
+	return &Queue{capacity: capacity, changed: make(chan struct{})}
+}
+
+// Send appends a message, blocking while the queue is full. It gives up
+// with ErrStopped when stop is closed first.
+func (q *Queue) Send(m Message, stop <-chan struct{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return ErrClosed
+		}
+		if len(q.messages) < q.capacity {
+			if m.Sent.IsZero() {
+				m.Sent = time.Now()
+			}
+			q.messages = append(q.messages, m)
+			q.sent++
+			q.broadcastLocked()
+			return nil
+		}
+		q.sending++
+		err := q.waitLocked(stop)
+		q.sending--
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Receive takes the oldest message, blocking while the queue is empty. It
+// gives up with ErrStopped when stop is closed first.
+func (q *Queue) Receive(stop <-chan struct{}) (Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if len(q.messages) > 0 {
+			m := q.messages[0]
+			q.messages = q.messages[1:]
+			q.received++
+			q.broadcastLocked()
+			return m, nil
+		}
+		if q.closed {
+			return Message{}, ErrClosed
+		}
+		q.receiving++
+		err := q.waitLocked(stop)
+		q.receiving--
+		if err != nil {
+			return Message{}, err
+		}
+	}
+}
+
+// PutBack returns a received message to the front of the queue, for a
+// receiver that could not deliver it. It is accepted even when the queue
+// is full or closed, since the message was already counted in.
+func (q *Queue) PutBack(m Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.messages = append([]Message{m}, q.messages...)
+	q.received--
+	q.broadcastLocked()
+}
+
+// Close stops further sends. Messages already queued can still be received.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.broadcastLocked()
+	}
+}
+
+// Stats describes a queue at a moment in time
+type Stats struct {
+	Length, Capacity   int
+	Sent, Received     int
+	Sending, Receiving int
+	Closed             bool
+}
+
+// Stats returns the queue's current state
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return Stats{
+		Length:    len(q.messages),
+		Capacity:  q.capacity,
+		Sent:      q.sent,
+		Received:  q.received,
+		Sending:   q.sending,
+		Receiving: q.receiving,
+		Closed:    q.closed,
+	}
+}
+
+// waitLocked releases the lock until the queue changes or stop is closed
+func (q *Queue) waitLocked(stop <-chan struct{}) error {
+	changed := q.changed
+	q.mu.Unlock()
+	defer q.mu.Lock()
+	select {
+	case <-changed:
+		return nil
+	case <-stop:
+		return ErrStopped
+	}
+}
+
+func (q *Queue) broadcastLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
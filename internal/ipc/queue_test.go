@@ -0,0 +1,48 @@
+package ipc
+
+import "testing"
+
+func TestQueueOrder(t *testing.T) {
+	q := NewQueue(2)
+	for _, body := range []string{"a", "b"} {
+		if err := q.Send(Message{Body: body}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A full queue blocks senders until they give up
+	stop := make(chan struct{})
+	close(stop)
+	if err := q.Send(Message{Body: "c"}, stop); err != ErrStopped {
+		t.Errorf("Send to a full queue: %v, want ErrStopped", err)
+	}
+
+	m, err := q.Receive(nil)
+	if err != nil || m.Body != "a" {
+		t.Fatalf("Receive = %q, %v, want a", m.Body, err)
+	}
+	if m.Sent.IsZero() {
+		t.Error("message has no send time")
+	}
+
+	// A message put back is received again before the rest
+	q.PutBack(m)
+	q.Close()
+	if err := q.Send(Message{Body: "d"}, nil); err != ErrClosed {
+		t.Errorf("Send to a closed queue: %v, want ErrClosed", err)
+	}
+	for _, want := range []string{"a", "b"} {
+		m, err := q.Receive(nil)
+		if err != nil || m.Body != want {
+			t.Errorf("Receive = %q, %v, want %s", m.Body, err, want)
+		}
+	}
+	if _, err := q.Receive(nil); err != ErrClosed {
+		t.Errorf("Receive from a closed, empty queue: %v, want ErrClosed", err)
+	}
+
+	s := q.Stats()
+	if s.Sent != 2 || s.Received != 2 || s.Length != 0 {
+		t.Errorf("stats %+v, want 2 sent, 2 received, none left", s)
+	}
+}
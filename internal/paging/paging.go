@@ -0,0 +1,229 @@
+package paging
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Algorithm is a page replacement algorithm
+type Algorithm string
+
+const (
+	FIFO    Algorithm = "fifo"  // evict the page loaded first
+	LRU     Algorithm = "lru"   // evict the page used least recently
+	Optimal Algorithm = "opt"   // evict the page used again furthest in the future
+	Clock   Algorithm = "clock" // second chance: skip pages referenced since the hand last passed
+	LFU     Algorithm = "lfu"   // evict the page used least often while resident
+)
+
+// Algorithms lists every algorithm, in the order comparisons show them
+var Algorithms = []Algorithm{FIFO, LRU, Optimal, Clock, LFU}
+
+// ParseAlgorithm accepts an algorithm's name or a common alias
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "fifo":
+		return FIFO, nil
+	case "lru":
+		return LRU, nil
+	case "opt", "optimal", "min":
+		return Optimal, nil
+	case "clock", "second-chance":
+		return Clock, nil
+	case "lfu":
+		return LFU, nil
+	}
+	return "", fmt.Errorf("%s: unknown algorithm", name)
+}
+
+// Title names an algorithm
+func (a Algorithm) Title() string {
+	switch a {
+	case FIFO:
+		return "FIFO"
+	case LRU:
+		return "Least Recently Used"
+	case Optimal:
+		return "Optimal (Belady's MIN)"
+	case Clock:
+		return "Clock (second chance)"
+	case LFU:
+		return "Least Frequently Used"
+	}
+	return string(a)
+}
+
+// Step is the state of memory after one reference
+type Step struct {
+	Page    int
+	Frames  []int  // page in each frame, -1 when empty
+	RefBits []bool // Clock's reference bits, by frame
+	Hand    int    // frame the Clock hand points at, -1 for other algorithms
+	Fault   bool
+	Victim  int // page evicted to make room, -1 if none
+}
+
+// Result is the outcome of running a reference string
+type Result struct {
+	Algorithm Algorithm
+	Frames    int
+	Steps     []Step
+	Faults    int
+}
+
+// HitRatio is the share of references that found their page in memory
+func (r *Result) HitRatio() float64 {
+	if len(r.Steps) == 0 {
+		return 0
+	}
+	return float64(len(r.Steps)-r.Faults) / float64(len(r.Steps))
+}
+
+// Simulate runs a reference string of page numbers through frames physical
+// frames. A page brought in takes the frame of the page it replaces.
+func Simulate(refs []int, frames int, alg Algorithm) (*Result, error) {
+	if frames <= 0 {
+		return nil, fmt.Errorf("the number of frames must be positive")
+	}
+	if _, err := ParseAlgorithm(string(alg)); err != nil {
+		return nil, err
+	}
+
+	m := &memory{
+		alg:      alg,
+		pages:    make([]int, frames),
+		loaded:   make([]int, frames),
+		lastUsed: make([]int, frames),
+		uses:     make([]int, frames),
+		refBits:  make([]bool, frames),
+	}
+	for i := range m.pages {
+		m.pages[i] = -1
+	}
+
+	result := &Result{Algorithm: alg, Frames: frames}
+	for t, page := range refs {
+		step := Step{Page: page, Victim: -1, Hand: -1}
+
+		frame := m.find(page)
+		if frame < 0 {
+			step.Fault = true
+			result.Faults++
+			frame = m.free()
+			if frame < 0 {
+				frame = m.victim(refs, t)
+				step.Victim = m.pages[frame]
+			}
+			m.pages[frame] = page
+			m.loaded[frame] = t
+			m.uses[frame] = 0
+			if alg == Clock {
+				m.hand = (frame + 1) % frames
+			}
+		}
+		m.lastUsed[frame] = t
+		m.uses[frame]++
+		m.refBits[frame] = true
+
+		step.Frames = append([]int(nil), m.pages...)
+		if alg == Clock {
+			step.RefBits = append([]bool(nil), m.refBits...)
+			step.Hand = m.hand
+		}
+		result.Steps = append(result.Steps, step)
+	}
+	return result, nil
+}
+
+// memory is the frame table during a simulation
+type memory struct {
+	alg      Algorithm
+	pages    []int
+	loaded   []int // when each frame's page was brought in
+	lastUsed []int
+	uses     []int // references to each frame's page since it was loaded
+	refBits  []bool
+	hand     int
+}
+
+func (m *memory) find(page int) int {
+	for i, p := range m.pages {
+		if p == page {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memory) free() int {
+	return m.find(-1)
+}
+
+// victim picks the frame whose page is replaced at time t
+func (m *memory) victim(refs []int, t int) int {
+	// oldest breaks ties in favour of the page loaded first
+	oldest := func(better func(i, best int) bool) int {
+		best := 0
+		for i := 1; i < len(m.pages); i++ {
+			if better(i, best) || (!better(best, i) && m.loaded[i] < m.loaded[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	switch m.alg {
+	case LRU:
+		return oldest(func(i, best int) bool { return m.lastUsed[i] < m.lastUsed[best] })
+	case LFU:
+		return oldest(func(i, best int) bool { return m.uses[i] < m.uses[best] })
+	case Optimal:
+		next := make([]int, len(m.pages))
+		for i, page := range m.pages {
+			next[i] = len(refs) // never used again
+			for u := t + 1; u < len(refs); u++ {
+				if refs[u] == page {
+					next[i] = u
+					break
+				}
+			}
+		}
+		return oldest(func(i, best int) bool { return next[i] > next[best] })
+	case Clock:
+		for m.refBits[m.hand] {
+			m.refBits[m.hand] = false
+			m.hand = (m.hand + 1) % len(m.pages)
+		}
+		return m.hand
+	}
+	return oldest(func(i, best int) bool { return false })
+}
+
+// Curve returns the number of faults with 1 to maxFrames frames
+func Curve(refs []int, maxFrames int, alg Algorithm) ([]int, error) {
+	faults := make([]int, maxFrames)
+	for n := 1; n <= maxFrames; n++ {
+		result, err := Simulate(refs, n, alg)
+		if err != nil {
+			return nil, err
+		}
+		faults[n-1] = result.Faults
+	}
+	return faults, nil
+}
+
+// Anomalies returns the frame counts at which adding a frame caused more
+// faults, given a curve from Curve
+func Anomalies(curve []int) []int {
+	var frames []int
+	for i := 1; i < len(curve); i++ {
+		if curve[i] > curve[i-1] {
+			frames = append(frames, i+1)
+		}
+	}
+	return frames
+}
+
+// BeladyReferences is the classic reference string on which FIFO has more
+// faults with four frames than with three
+var BeladyReferences = []int{1, 2, 3, 4, 1, 2, 5, 1, 2, 3, 4, 5}
@@ -0,0 +1,85 @@
+package paging
+
+import (
+	"reflect"
+	"testing"
+)
+
+// textbookReferences is the 20-reference string used by Silberschatz et al.
+var textbookReferences = []int{7, 0, 1, 2, 0, 3, 0, 4, 2, 3, 0, 3, 2, 1, 2, 0, 1, 7, 0, 1}
+
+func TestSimulateFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		refs   []int
+		frames int
+		alg    Algorithm
+		faults int
+	}{
+		{"textbook FIFO", textbookReferences, 3, FIFO, 15},
+		{"textbook LRU", textbookReferences, 3, LRU, 12},
+		{"textbook OPT", textbookReferences, 3, Optimal, 9},
+		{"Belady FIFO 3 frames", BeladyReferences, 3, FIFO, 9},
+		{"Belady FIFO 4 frames", BeladyReferences, 4, FIFO, 10},
+		{"one frame", []int{1, 1, 2, 2, 1}, 1, LRU, 3},
+		{"fits in memory", []int{1, 2, 3, 1, 2, 3}, 3, Clock, 3},
+	}
+
+	for _, tt := range tests {
+		result, err := Simulate(tt.refs, tt.frames, tt.alg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Faults != tt.faults {
+			t.Errorf("%s: %d faults, want %d", tt.name, result.Faults, tt.faults)
+		}
+		if len(result.Steps) != len(tt.refs) {
+			t.Errorf("%s: %d steps, want %d", tt.name, len(result.Steps), len(tt.refs))
+		}
+	}
+}
+
+func TestBeladyAnomaly(t *testing.T) {
+	curve, err := Curve(BeladyReferences, 5, FIFO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{12, 12, 9, 10, 5}; !reflect.DeepEqual(curve, want) {
+		t.Errorf("FIFO curve %v, want %v", curve, want)
+	}
+	if got := Anomalies(curve); !reflect.DeepEqual(got, []int{4}) {
+		t.Errorf("anomalies at %v frames, want [4]", got)
+	}
+
+	// Stack algorithms never get worse with more memory
+	for _, alg := range []Algorithm{LRU, Optimal} {
+		curve, err := Curve(BeladyReferences, 5, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Anomalies(curve); len(got) != 0 {
+			t.Errorf("%s: anomalies at %v frames", alg, got)
+		}
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	if _, err := Simulate(BeladyReferences, 0, FIFO); err == nil {
+		t.Error("0 frames: expected an error")
+	}
+	if _, err := Simulate(BeladyReferences, 3, "random"); err == nil {
+		t.Error("unknown algorithm: expected an error")
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := map[string]Algorithm{
+		"FIFO": FIFO, "lru": LRU, "optimal": Optimal, "min": Optimal,
+		"second-chance": Clock, "lfu": LFU,
+	}
+	for name, want := range tests {
+		if got, err := ParseAlgorithm(name); err != nil || got != want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
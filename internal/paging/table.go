@@ -0,0 +1,82 @@
+package paging
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Table draws the frame table of a simulation with one column per
+// reference, wrapping onto more blocks when wider than width columns. Faults
+// are marked with F and evicted pages listed under them; for Clock, a '
+// marks a set reference bit and > the frame the hand points at.
+//
+//	Ref     |  7  0  1  2  0
+//	Frame 0 |  7  7  7  2  2
+//	Frame 1 |     0  0  0  0
+//	Frame 2 |        1  1  1
+//	Fault   |  F  F  F  F
+//	Evicted |           7
+func Table(r *Result, width int) string {
+	cell := 2
+	for _, step := range r.Steps {
+		cell = max(cell, len(strconv.Itoa(step.Page))+1)
+	}
+	if r.Algorithm == Clock {
+		cell += 2 // room for the hand and reference bit marks
+	}
+	cell++ // separating space
+
+	const labelWidth = 10
+	perBlock := max(1, (width-labelWidth)/cell)
+
+	var b strings.Builder
+	for start := 0; start < len(r.Steps); start += perBlock {
+		steps := r.Steps[start:min(start+perBlock, len(r.Steps))]
+		if start > 0 {
+			b.WriteByte('\n')
+		}
+
+		row := func(label string, text func(Step) string) {
+			var line strings.Builder
+			fmt.Fprintf(&line, "%-*s|", labelWidth-1, label)
+			for _, step := range steps {
+				s := text(step)
+				line.WriteString(strings.Repeat(" ", cell-len(s)))
+				line.WriteString(s)
+			}
+			b.WriteString(strings.TrimRight(line.String(), " "))
+			b.WriteByte('\n')
+		}
+
+		row("Ref", func(s Step) string { return strconv.Itoa(s.Page) })
+		for f := 0; f < r.Frames; f++ {
+			row("Frame "+strconv.Itoa(f), func(s Step) string {
+				if s.Frames[f] < 0 {
+					return ""
+				}
+				text := strconv.Itoa(s.Frames[f])
+				if s.RefBits != nil && s.RefBits[f] {
+					text += "'"
+				}
+				if s.Hand == f {
+					text = ">" + text
+				}
+				return text
+			})
+		}
+		row("Fault", func(s Step) string {
+			if s.Fault {
+				return "F"
+			}
+			return ""
+		})
+		row("Evicted", func(s Step) string {
+			if s.Victim < 0 {
+				return ""
+			}
+			return strconv.Itoa(s.Victim)
+		})
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// idleLabel marks the time the CPU had nothing to run
+const idleLabel = "idle"
+
+// Chart draws a Gantt chart, wrapping it onto more rows when it is wider
+// than width columns:
+//
+//	+----+------+---+
+//	| P1 |  P2  |P3 |
+//	+----+------+---+
+//	0    4      10  13
+func Chart(slices []Slice, width int) string {
+	if len(slices) == 0 {
+		return ""
+	}
+
+	// Each time unit gets two columns, and each slice room for its label
+	cells := make([]int, len(slices))
+	for i, s := range slices {
+		cells[i] = max((s.End-s.Start)*2, len(label(s))+2)
+	}
+
+	var b strings.Builder
+	for start := 0; start < len(slices); {
+		end, used := start, 1
+		for end < len(slices) && (end == start || used+cells[end]+1 <= width) {
+			used += cells[end] + 1
+			end++
+		}
+		if start > 0 {
+			b.WriteByte('\n')
+		}
+		writeRow(&b, slices[start:end], cells[start:end])
+		start = end
+	}
+	return b.String()
+}
+
+// writeRow draws one row of the chart
+func writeRow(b *strings.Builder, slices []Slice, cells []int) {
+	border := func() {
+		b.WriteByte('+')
+		for _, n := range cells {
+			b.WriteString(strings.Repeat("-", n))
+			b.WriteByte('+')
+		}
+		b.WriteByte('\n')
+	}
+
+	border()
+	b.WriteByte('|')
+	for i, s := range slices {
+		text := label(s)
+		left := (cells[i] - len(text)) / 2
+		b.WriteString(strings.Repeat(" ", left))
+		b.WriteString(text)
+		b.WriteString(strings.Repeat(" ", cells[i]-len(text)-left))
+		b.WriteByte('|')
+	}
+	b.WriteByte('\n')
+	border()
+
+	// Times go under the borders, skipping any that would overlap the
+	// previous one
+	var times []byte
+	pos := 0
+	for i := 0; i <= len(slices); i++ {
+		t := slices[0].Start
+		if i > 0 {
+			t = slices[i-1].End
+			pos += cells[i-1] + 1
+		}
+		text := strconv.Itoa(t)
+		if pos < len(times)+1 && len(times) > 0 {
+			continue
+		}
+		times = append(times, strings.Repeat(" ", pos-len(times))...)
+		times = append(times, text...)
+	}
+	b.Write(times)
+	b.WriteByte('\n')
+}
+
+func label(s Slice) string {
+	if s.Name == "" {
+		return idleLabel
+	}
+	return s.Name
+}
@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Process is a process to be scheduled. Times are in abstract units and a
+// lower Priority number means a more important process.
+type Process struct {
+	Name     string
+	Arrival  int
+	Burst    int
+	Priority int
+}
+
+// ParseProcess parses an inline process spec, name:arrival:burst[:priority]
+// or arrival:burst[:priority]. Unnamed processes are called P<seq>.
+func ParseProcess(spec string, seq int) (Process, error) {
+	fields := strings.Split(spec, ":")
+	return processOf(fields, seq, spec)
+}
+
+// ReadProcesses reads a process set with one process per line: a name, an
+// arrival time, a burst time and an optional priority, separated by spaces
+// or commas. Blank lines, # comments and a header line are skipped.
+func ReadProcesses(r io.Reader) ([]Process, error) {
+	var procs []Process
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if len(procs) == 0 && len(fields) > 1 && !isNumber(fields[0]) && !isNumber(fields[1]) {
+			continue // header
+		}
+
+		p, err := processOf(fields, len(procs)+1, strings.TrimSpace(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		procs = append(procs, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return procs, nil
+}
+
+// processOf builds a process from its fields, with or without a name
+func processOf(fields []string, seq int, spec string) (Process, error) {
+	p := Process{Name: fmt.Sprintf("P%d", seq)}
+	if len(fields) > 0 && !isNumber(fields[0]) {
+		p.Name = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return p, fmt.Errorf("%s: expected [name] arrival burst [priority]", spec)
+	}
+
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("%s: %s is not a valid time or priority", spec, field)
+		}
+		values[i] = n
+	}
+	p.Arrival, p.Burst = values[0], values[1]
+	if len(values) == 3 {
+		p.Priority = values[2]
+	}
+	if p.Burst == 0 {
+		return p, fmt.Errorf("%s: burst time must be positive", spec)
+	}
+	return p, nil
+}
+
+// Validate checks that process names are unique and that every process
+// arrives at a time of 0 or later and needs the CPU for some time
+func Validate(procs []Process) error {
+	if len(procs) == 0 {
+		return fmt.Errorf("no processes")
+	}
+	seen := make(map[string]bool, len(procs))
+	for _, p := range procs {
+		if seen[p.Name] {
+			return fmt.Errorf("%s: duplicate process name", p.Name)
+		}
+		if p.Arrival < 0 {
+			return fmt.Errorf("%s: arrival time must not be negative", p.Name)
+		}
+		if p.Burst <= 0 {
+			return fmt.Errorf("%s: burst time must be positive", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
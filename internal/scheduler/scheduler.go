@@ -0,0 +1,376 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Algorithm is a CPU scheduling algorithm
+type Algorithm string
+
+const (
+	FCFS               Algorithm = "fcfs"       // first come, first served
+	SJF                Algorithm = "sjf"        // shortest job first, non-preemptive
+	SRTF               Algorithm = "srtf"       // shortest remaining time first
+	RoundRobin         Algorithm = "rr"         // round robin
+	Priority           Algorithm = "priority"   // priority, non-preemptive
+	PreemptivePriority Algorithm = "priority-p" // priority, preemptive
+	MLFQ               Algorithm = "mlfq"       // multilevel feedback queue
+)
+
+// Algorithms lists every algorithm, in the order comparisons show them
+var Algorithms = []Algorithm{FCFS, SJF, SRTF, RoundRobin, Priority, PreemptivePriority, MLFQ}
+
+// ParseAlgorithm accepts an algorithm's name or a common alias
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "fcfs", "fifo":
+		return FCFS, nil
+	case "sjf", "spn":
+		return SJF, nil
+	case "srtf", "srt", "psjf":
+		return SRTF, nil
+	case "rr", "round-robin":
+		return RoundRobin, nil
+	case "priority", "prio", "priority-np":
+		return Priority, nil
+	case "priority-p", "pprio", "ppriority":
+		return PreemptivePriority, nil
+	case "mlfq":
+		return MLFQ, nil
+	}
+	return "", fmt.Errorf("%s: unknown algorithm", name)
+}
+
+// Options tunes the algorithms that use time slices
+type Options struct {
+	Quantum int // round robin time slice, and that of MLFQ's top queue
+	Levels  int // number of MLFQ queues; each has twice the slice of the one above
+	Boost   int // MLFQ moves every process back to the top queue this often, 0 for never
+}
+
+// DefaultOptions are used for options left at zero
+var DefaultOptions = Options{Quantum: 2, Levels: 3}
+
+// Title names an algorithm along with the options it uses
+func (a Algorithm) Title(opts Options) string {
+	switch a {
+	case FCFS:
+		return "First Come, First Served"
+	case SJF:
+		return "Shortest Job First (non-preemptive)"
+	case SRTF:
+		return "Shortest Remaining Time First (preemptive)"
+	case RoundRobin:
+		return fmt.Sprintf("Round Robin (quantum %d)", opts.Quantum)
+	case Priority:
+		return "Priority (non-preemptive, lower number runs first)"
+	case PreemptivePriority:
+		return "Priority (preemptive, lower number runs first)"
+	case MLFQ:
+		title := fmt.Sprintf("Multilevel Feedback Queue (%d levels, top quantum %d", opts.Levels, opts.Quantum)
+		if opts.Boost > 0 {
+			title += fmt.Sprintf(", boost every %d", opts.Boost)
+		}
+		return title + ")"
+	}
+	return string(a)
+}
+
+// Slice is a stretch of time the CPU spent on one process. An empty Name
+// means the CPU was idle.
+type Slice struct {
+	Name       string
+	Start, End int
+}
+
+// Stat holds the times of one process under a schedule
+type Stat struct {
+	Process
+	Completion int
+	Turnaround int // completion - arrival
+	Waiting    int // turnaround - burst
+	Response   int // first run - arrival
+}
+
+// Result is the outcome of a simulation
+type Result struct {
+	Algorithm       Algorithm
+	Options         Options
+	Gantt           []Slice
+	Stats           []Stat // in the order the processes were given
+	ContextSwitches int    // times the CPU moved from one process to another
+}
+
+// Averages returns the mean waiting, turnaround and response times
+func (r *Result) Averages() (waiting, turnaround, response float64) {
+	for _, s := range r.Stats {
+		waiting += float64(s.Waiting)
+		turnaround += float64(s.Turnaround)
+		response += float64(s.Response)
+	}
+	n := float64(len(r.Stats))
+	return waiting / n, turnaround / n, response / n
+}
+
+// End is when the last process completes
+func (r *Result) End() int {
+	if len(r.Gantt) == 0 {
+		return 0
+	}
+	return r.Gantt[len(r.Gantt)-1].End
+}
+
+// Utilisation is the share of time the CPU was busy
+func (r *Result) Utilisation() float64 {
+	busy := 0
+	for _, s := range r.Gantt {
+		if s.Name != "" {
+			busy += s.End - s.Start
+		}
+	}
+	if r.End() == 0 {
+		return 0
+	}
+	return float64(busy) / float64(r.End())
+}
+
+// task is a process during a simulation
+type task struct {
+	Process
+	index     int
+	remaining int
+	started   bool
+	firstRun  int
+	done      int
+	level     int // MLFQ queue
+	used      int // time used of the current slice
+}
+
+// Simulate runs the processes under an algorithm one time unit at a time
+func Simulate(procs []Process, alg Algorithm, opts Options) (*Result, error) {
+	if err := Validate(procs); err != nil {
+		return nil, err
+	}
+	if _, err := ParseAlgorithm(string(alg)); err != nil {
+		return nil, err
+	}
+	if opts.Quantum < 0 || opts.Levels < 0 || opts.Boost < 0 {
+		return nil, fmt.Errorf("quantum, levels and boost must be positive")
+	}
+	if opts.Quantum == 0 {
+		opts.Quantum = DefaultOptions.Quantum
+	}
+	if opts.Levels == 0 {
+		opts.Levels = DefaultOptions.Levels
+	}
+
+	tasks := make([]*task, len(procs))
+	for i, p := range procs {
+		tasks[i] = &task{Process: p, index: i, remaining: p.Burst}
+	}
+	arrivals := append([]*task(nil), tasks...)
+	sort.SliceStable(arrivals, func(i, j int) bool { return arrivals[i].Arrival < arrivals[j].Arrival })
+
+	s := &simulation{alg: alg, opts: opts, queues: make([][]*task, opts.Levels)}
+	result := &Result{Algorithm: alg, Options: opts}
+	last := ""
+	next, finished := 0, 0
+	for t := 0; finished < len(tasks); t++ {
+		for next < len(arrivals) && arrivals[next].Arrival <= t {
+			s.arrive(arrivals[next])
+			next++
+		}
+		if alg == MLFQ && opts.Boost > 0 && t > 0 && t%opts.Boost == 0 {
+			s.boost()
+		}
+
+		current := s.choose()
+		name := ""
+		if current != nil {
+			name = current.Name
+		}
+		if n := len(result.Gantt); n > 0 && result.Gantt[n-1].Name == name {
+			result.Gantt[n-1].End = t + 1
+		} else {
+			result.Gantt = append(result.Gantt, Slice{Name: name, Start: t, End: t + 1})
+		}
+		if current == nil {
+			// Nothing is ready, so skip ahead to the next arrival
+			if next < len(arrivals) {
+				t = arrivals[next].Arrival - 1
+				result.Gantt[len(result.Gantt)-1].End = t + 1
+			}
+			continue
+		}
+
+		if last != "" && last != current.Name {
+			result.ContextSwitches++
+		}
+		last = current.Name
+		if !current.started {
+			current.started = true
+			current.firstRun = t
+		}
+		current.remaining--
+		current.used++
+		if current.remaining == 0 {
+			current.done = t + 1
+			s.current = nil
+			finished++
+		}
+	}
+
+	for _, task := range tasks {
+		turnaround := task.done - task.Arrival
+		result.Stats = append(result.Stats, Stat{
+			Process:    task.Process,
+			Completion: task.done,
+			Turnaround: turnaround,
+			Waiting:    turnaround - task.Burst,
+			Response:   task.firstRun - task.Arrival,
+		})
+	}
+	return result, nil
+}
+
+// simulation holds the ready processes of a running simulation
+type simulation struct {
+	alg     Algorithm
+	opts    Options
+	current *task
+	ready   []*task   // for the algorithms that pick by a key
+	queues  [][]*task // round robin uses the first queue, MLFQ all of them
+}
+
+func (s *simulation) arrive(t *task) {
+	switch s.alg {
+	case RoundRobin, MLFQ:
+		s.queues[0] = append(s.queues[0], t)
+	default:
+		s.ready = append(s.ready, t)
+	}
+}
+
+// choose decides which task runs for the next time unit
+func (s *simulation) choose() *task {
+	switch s.alg {
+	case FCFS, SJF, Priority:
+		if s.current == nil {
+			s.current = s.takeBest(nil)
+		}
+	case SRTF, PreemptivePriority:
+		s.current = s.takeBest(s.current)
+	case RoundRobin:
+		if s.current != nil && s.current.used >= s.opts.Quantum {
+			s.queues[0] = append(s.queues[0], s.current)
+			s.current = nil
+		}
+		if s.current == nil {
+			s.current = s.pop(0)
+		}
+	case MLFQ:
+		s.chooseMLFQ()
+	}
+	return s.current
+}
+
+// takeBest removes and returns the ready task that should run, by the
+// algorithm's key. The running task, if any, competes too and keeps the CPU
+// on a tie.
+func (s *simulation) takeBest(running *task) *task {
+	key := func(t *task) int {
+		switch s.alg {
+		case SJF:
+			return t.Burst
+		case SRTF:
+			return t.remaining
+		case Priority, PreemptivePriority:
+			return t.Priority
+		}
+		return t.Arrival
+	}
+
+	best := -1
+	for i, t := range s.ready {
+		if best < 0 || key(t) < key(s.ready[best]) ||
+			(key(t) == key(s.ready[best]) && (t.Arrival < s.ready[best].Arrival ||
+				(t.Arrival == s.ready[best].Arrival && t.index < s.ready[best].index))) {
+			best = i
+		}
+	}
+	if best < 0 || (running != nil && key(running) <= key(s.ready[best])) {
+		return running
+	}
+
+	chosen := s.ready[best]
+	s.ready = append(s.ready[:best], s.ready[best+1:]...)
+	if running != nil {
+		s.ready = append(s.ready, running)
+	}
+	return chosen
+}
+
+// chooseMLFQ applies the feedback rules: a task that uses up its slice moves
+// down a queue, and one that arrives in a higher queue preempts the running
+// task, which keeps its place at the back of its own queue
+func (s *simulation) chooseMLFQ() {
+	if cur := s.current; cur != nil {
+		last := cur.level == len(s.queues)-1
+		switch {
+		case !last && cur.used >= s.opts.Quantum<<cur.level:
+			cur.level++
+			cur.used = 0
+			s.queues[cur.level] = append(s.queues[cur.level], cur)
+			s.current = nil
+		case s.higherReady(cur.level):
+			cur.used = 0
+			s.queues[cur.level] = append(s.queues[cur.level], cur)
+			s.current = nil
+		}
+	}
+	if s.current == nil {
+		for level := range s.queues {
+			if len(s.queues[level]) > 0 {
+				s.current = s.pop(level)
+				break
+			}
+		}
+	}
+}
+
+// higherReady reports whether a task waits in a queue above level
+func (s *simulation) higherReady(level int) bool {
+	for l := 0; l < level; l++ {
+		if len(s.queues[l]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// boost moves every task back to the top queue so that long-running tasks
+// are not starved
+func (s *simulation) boost() {
+	for level := 1; level < len(s.queues); level++ {
+		s.queues[0] = append(s.queues[0], s.queues[level]...)
+		s.queues[level] = nil
+	}
+	for _, t := range s.queues[0] {
+		t.level, t.used = 0, 0
+	}
+	if s.current != nil {
+		s.current.level, s.current.used = 0, 0
+	}
+}
+
+func (s *simulation) pop(level int) *task {
+	if len(s.queues[level]) == 0 {
+		return nil
+	}
+	t := s.queues[level][0]
+	s.queues[level] = s.queues[level][1:]
+	t.used = 0
+	return t
+}
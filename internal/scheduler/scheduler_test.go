@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Process sets from Silberschatz et al.
+var (
+	// convoy is the FCFS and round robin example: everything arrives at 0
+	convoy = []Process{{"P1", 0, 24, 0}, {"P2", 0, 3, 0}, {"P3", 0, 3, 0}}
+	// shortest is the SJF example
+	shortest = []Process{{"P1", 0, 6, 0}, {"P2", 0, 8, 0}, {"P3", 0, 7, 0}, {"P4", 0, 3, 0}}
+	// staggered is the SRTF example, with arrivals one unit apart
+	staggered = []Process{{"P1", 0, 8, 0}, {"P2", 1, 4, 0}, {"P3", 2, 9, 0}, {"P4", 3, 5, 0}}
+	// prioritised is the priority example; a lower number is more important
+	prioritised = []Process{{"P1", 0, 10, 3}, {"P2", 0, 1, 1}, {"P3", 0, 2, 4}, {"P4", 0, 1, 5}, {"P5", 0, 5, 2}}
+)
+
+func TestSimulateWaiting(t *testing.T) {
+	tests := []struct {
+		name    string
+		procs   []Process
+		alg     Algorithm
+		quantum int
+		waiting []int
+		gantt   []Slice
+	}{
+		{"FCFS convoy", convoy, FCFS, 0, []int{0, 24, 27},
+			[]Slice{{"P1", 0, 24}, {"P2", 24, 27}, {"P3", 27, 30}}},
+		{"SJF", shortest, SJF, 0, []int{3, 16, 9, 0},
+			[]Slice{{"P4", 0, 3}, {"P1", 3, 9}, {"P3", 9, 16}, {"P2", 16, 24}}},
+		{"SRTF", staggered, SRTF, 0, []int{9, 0, 15, 2},
+			[]Slice{{"P1", 0, 1}, {"P2", 1, 5}, {"P4", 5, 10}, {"P1", 10, 17}, {"P3", 17, 26}}},
+		{"RR quantum 4", convoy, RoundRobin, 4, []int{6, 4, 7},
+			[]Slice{{"P1", 0, 4}, {"P2", 4, 7}, {"P3", 7, 10}, {"P1", 10, 30}}},
+		{"priority", prioritised, Priority, 0, []int{6, 0, 16, 18, 1},
+			[]Slice{{"P2", 0, 1}, {"P5", 1, 6}, {"P1", 6, 16}, {"P3", 16, 18}, {"P4", 18, 19}}},
+		{"preemptive priority", []Process{{"P1", 0, 4, 2}, {"P2", 1, 2, 1}}, PreemptivePriority, 0, []int{2, 0},
+			[]Slice{{"P1", 0, 1}, {"P2", 1, 3}, {"P1", 3, 6}}},
+		{"idle until the first arrival", []Process{{"P1", 3, 2, 0}}, FCFS, 0, []int{0},
+			[]Slice{{"", 0, 3}, {"P1", 3, 5}}},
+	}
+
+	for _, tt := range tests {
+		result, err := Simulate(tt.procs, tt.alg, Options{Quantum: tt.quantum})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var waiting []int
+		for _, s := range result.Stats {
+			waiting = append(waiting, s.Waiting)
+		}
+		if !reflect.DeepEqual(waiting, tt.waiting) {
+			t.Errorf("%s: waiting %v, want %v", tt.name, waiting, tt.waiting)
+		}
+		if !reflect.DeepEqual(result.Gantt, tt.gantt) {
+			t.Errorf("%s: chart %v, want %v", tt.name, result.Gantt, tt.gantt)
+		}
+	}
+}
+
+func TestSimulateAverages(t *testing.T) {
+	tests := []struct {
+		procs   []Process
+		alg     Algorithm
+		waiting float64
+	}{
+		{convoy, FCFS, 17},
+		{shortest, SJF, 7},
+		{staggered, SRTF, 6.5},
+		{prioritised, Priority, 8.2},
+	}
+	for _, tt := range tests {
+		result, err := Simulate(tt.procs, tt.alg, Options{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.alg, err)
+		}
+		if waiting, _, _ := result.Averages(); waiting != tt.waiting {
+			t.Errorf("%s: average waiting %.2f, want %.2f", tt.alg, waiting, tt.waiting)
+		}
+	}
+}
+
+func TestSimulateMLFQ(t *testing.T) {
+	// A long process sinks to the lower queues and a short one that
+	// arrives later runs ahead of it
+	procs := []Process{{"P1", 0, 10, 0}, {"P2", 4, 2, 0}}
+	result, err := Simulate(procs, MLFQ, Options{Quantum: 2, Levels: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Slice{{"P1", 0, 4}, {"P2", 4, 6}, {"P1", 6, 12}}; !reflect.DeepEqual(result.Gantt, want) {
+		t.Errorf("chart %v, want %v", result.Gantt, want)
+	}
+}
+
+func TestSimulateRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		procs []Process
+		opts  Options
+	}{
+		{"no processes", nil, Options{}},
+		{"zero burst", []Process{{"P1", 0, 0, 0}}, Options{}},
+		{"negative burst", []Process{{"P1", 0, -2, 0}}, Options{}},
+		{"negative arrival", []Process{{"P1", -1, 3, 0}}, Options{}},
+		{"duplicate name", []Process{{"P1", 0, 3, 0}, {"P1", 1, 2, 0}}, Options{}},
+		{"negative quantum", convoy, Options{Quantum: -1}},
+	}
+	for _, tt := range tests {
+		for _, alg := range Algorithms {
+			if _, err := Simulate(tt.procs, alg, tt.opts); err == nil {
+				t.Errorf("%s under %s: expected an error", tt.name, alg)
+			}
+		}
+	}
+}
+
+func TestParseProcess(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Process
+		ok   bool
+	}{
+		{"A:0:5:2", Process{"A", 0, 5, 2}, true},
+		{"1:4", Process{"P3", 1, 4, 0}, true},
+		{"A:0:0", Process{}, false},
+		{"A:-1:3", Process{}, false},
+		{"A:0", Process{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseProcess(tt.spec, 3)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseProcess(%q): error %v", tt.spec, err)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("ParseProcess(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
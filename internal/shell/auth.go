@@ -0,0 +1,371 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/internal/auth"
+)
+
+const (
+	// usersEnv names the environment variable holding the path of the user
+	// database; it defaults to ~/.advanced-shell/users.json
+	usersEnv = "ASH_USERS"
+
+	// loginEnv names the environment variable that makes the shell ask for
+	// a login before running any command
+	loginEnv = "ASH_LOGIN"
+
+	// loginFailureDelay slows down repeated guesses at the login prompt
+	loginFailureDelay = time.Second
+)
+
+// errNoHome means there is no home directory to keep the user database in
+var errNoHome = errors.New("cannot find home directory")
+
+// session is a logged in user
+type session struct {
+	user  *auth.User
+	since time.Time
+}
+
+// loginEnabled reports whether an ASH_LOGIN value turns login on
+func loginEnabled(value string) bool {
+	switch strings.ToLower(value) {
+	case "on", "1", "yes", "true":
+		return true
+	}
+	return false
+}
+
+// userDB opens the user database the first time it is needed
+func (ch *CommandHandler) userDB() (*auth.DB, error) {
+	if ch.users != nil {
+		return ch.users, nil
+	}
+	path := os.Getenv(usersEnv)
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errNoHome, err)
+		}
+		path = filepath.Join(homeDir, ".advanced-shell", "users.json")
+	}
+	db, err := auth.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ch.users = db
+	return db, nil
+}
+
+// currentUser is the name of the logged in user, or "" when nobody is
+func (ch *CommandHandler) currentUser() string {
+	if ch.session == nil {
+		return ""
+	}
+	return ch.session.user.Name
+}
+
+// isAdmin reports whether the logged in user is an administrator
+func (ch *CommandHandler) isAdmin() bool {
+	return ch.session != nil && ch.session.user.Role == auth.RoleAdmin
+}
+
+// readLine prompts for and reads a line of input. Secret input is not
+// echoed when it comes from a terminal.
+func (ch *CommandHandler) readLine(prompt string, secret bool) (string, bool) {
+	fmt.Print(prompt)
+	if secret && isTerminal(os.Stdin) {
+		fd := int(os.Stdin.Fd())
+		if modes, err := tcgetattr(fd); err == nil {
+			quiet := *modes
+			quiet.Lflag &^= syscall.ECHO
+			if tcsetattr(fd, &quiet) == nil {
+				defer func() {
+					_ = tcsetattr(fd, modes)
+					fmt.Println()
+				}()
+			}
+		}
+	}
+
+	input := ch.stdin()
+	if !input.Scan() {
+		return "", false
+	}
+	return input.Text(), true
+}
+
+// stdin returns the scanner the shell reads its standard input through,
+// creating it on first use. Everything that reads stdin must share it, since
+// a scanner of its own would miss input already buffered here and take
+// input meant for the shell.
+func (ch *CommandHandler) stdin() *bufio.Scanner {
+	if ch.input == nil {
+		ch.input = bufio.NewScanner(os.Stdin)
+	}
+	return ch.input
+}
+
+// readNewPassword asks for a new password twice
+func (ch *CommandHandler) readNewPassword() (string, error) {
+	password, ok := ch.readLine("New password: ", true)
+	if !ok {
+		return "", fmt.Errorf("no password given")
+	}
+	if err := auth.ValidPassword(password); err != nil {
+		return "", err
+	}
+	again, ok := ch.readLine("Retype new password: ", true)
+	if !ok || again != password {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return password, nil
+}
+
+// promptLogin asks for a user name and password until someone logs in. When
+// the database is empty it creates the first administrator instead. It
+// returns false when input runs out.
+func (ch *CommandHandler) promptLogin() bool {
+	db, err := ch.userDB()
+	if err != nil {
+		fmt.Printf("\033[31mError:\033[0m login: %v\n", err)
+		return false
+	}
+
+	for {
+		users, err := db.Users()
+		if err != nil {
+			fmt.Printf("\033[31mError:\033[0m login: %v\n", err)
+			return false
+		}
+		if len(users) == 0 {
+			fmt.Printf("No users exist yet; create an administrator account (saved in %s).\n", db.Path())
+			name, ok := ch.readLine("New user name: ", false)
+			if !ok {
+				return false
+			}
+			if err := ch.addUser(db, strings.TrimSpace(name), auth.RoleAdmin); err != nil {
+				fmt.Printf("\033[31mError:\033[0m useradd: %v\n", err)
+			}
+			continue
+		}
+
+		name, ok := ch.readLine("login: ", false)
+		if !ok {
+			return false
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if err := ch.login(db, name); err != nil {
+			fmt.Printf("Login failed: %v\n", err)
+			time.Sleep(loginFailureDelay)
+			continue
+		}
+		return true
+	}
+}
+
+// login asks for a user's password and starts a session for them
+func (ch *CommandHandler) login(db *auth.DB, name string) error {
+	password, ok := ch.readLine("Password: ", true)
+	if !ok {
+		return fmt.Errorf("no password given")
+	}
+	user, err := db.Authenticate(name, password)
+	if err != nil {
+		return err
+	}
+
+	ch.session = &session{user: user, since: time.Now()}
+	fmt.Printf("Logged in as %s (%s)", user.Name, user.Role)
+	if !user.LastLogin.IsZero() {
+		fmt.Printf(", last login %s", user.LastLogin.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println()
+	return nil
+}
+
+// addUser asks for a password and creates an account
+func (ch *CommandHandler) addUser(db *auth.DB, name, role string) error {
+	if err := auth.ValidName(name); err != nil {
+		return err
+	}
+	if err := auth.ValidRole(role); err != nil {
+		return err
+	}
+	if _, err := db.Lookup(name); err == nil {
+		return fmt.Errorf("%s: user already exists", name)
+	}
+	password, err := ch.readNewPassword()
+	if err != nil {
+		return err
+	}
+	if err := db.Add(name, password, role); err != nil {
+		return err
+	}
+	fmt.Printf("Created user %s (%s)\n", name, role)
+	return nil
+}
+
+func (ch *CommandHandler) handleLogin(args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("login: too many arguments\nUsage: login [user]")
+	}
+	db, err := ch.userDB()
+	if err != nil {
+		return fmt.Errorf("login: %v", err)
+	}
+	users, err := db.Users()
+	if err != nil {
+		return fmt.Errorf("login: %v", err)
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("login: no users exist yet; create one with useradd")
+	}
+
+	name := ""
+	if len(args) == 2 {
+		name = args[1]
+	} else {
+		line, ok := ch.readLine("login: ", false)
+		if !ok {
+			return fmt.Errorf("login: no user name given")
+		}
+		name = strings.TrimSpace(line)
+	}
+	if err := ch.login(db, name); err != nil {
+		time.Sleep(loginFailureDelay)
+		return fmt.Errorf("login: %v", err)
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleLogout(args []string) error {
+	if ch.session == nil {
+		return fmt.Errorf("logout: not logged in")
+	}
+	fmt.Printf("Logged out %s\n", ch.session.user.Name)
+	ch.session = nil
+	return nil
+}
+
+func (ch *CommandHandler) handleWhoami(args []string) error {
+	if ch.session == nil {
+		return fmt.Errorf("whoami: not logged in")
+	}
+	fmt.Printf("%s (%s), logged in since %s\n", ch.session.user.Name, ch.session.user.Role,
+		ch.session.since.Format("15:04:05"))
+	return nil
+}
+
+func (ch *CommandHandler) handlePasswd(args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("passwd: too many arguments\nUsage: passwd [user]")
+	}
+	if ch.session == nil {
+		return fmt.Errorf("passwd: not logged in")
+	}
+	db, err := ch.userDB()
+	if err != nil {
+		return fmt.Errorf("passwd: %v", err)
+	}
+
+	name := ch.currentUser()
+	if len(args) == 2 && args[1] != name {
+		if !ch.isAdmin() {
+			return fmt.Errorf("passwd: only an administrator can change another user's password")
+		}
+		name = args[1]
+		if _, err := db.Lookup(name); err != nil {
+			return fmt.Errorf("passwd: %v", err)
+		}
+	} else {
+		current, ok := ch.readLine("Current password: ", true)
+		if !ok || !db.Check(name, current) {
+			time.Sleep(loginFailureDelay)
+			return fmt.Errorf("passwd: incorrect password")
+		}
+	}
+
+	password, err := ch.readNewPassword()
+	if err != nil {
+		return fmt.Errorf("passwd: %v", err)
+	}
+	if err := db.SetPassword(name, password); err != nil {
+		return fmt.Errorf("passwd: %v", err)
+	}
+	fmt.Printf("Password updated for %s\n", name)
+	return nil
+}
+
+func (ch *CommandHandler) handleUseradd(args []string) error {
+	usage := fmt.Sprintf("Usage: useradd [-r role] name\nRoles: %s", strings.Join(auth.Roles, ", "))
+	role := auth.RoleUser
+	rest := args[1:]
+	if len(rest) > 0 && rest[0] == "-r" {
+		if len(rest) < 2 {
+			return fmt.Errorf("useradd: -r: option requires an argument\n%s", usage)
+		}
+		role = rest[1]
+		rest = rest[2:]
+	}
+	if len(rest) != 1 || strings.HasPrefix(rest[0], "-") {
+		return fmt.Errorf("useradd: expected one user name\n%s", usage)
+	}
+
+	db, err := ch.userDB()
+	if err != nil {
+		return fmt.Errorf("useradd: %v", err)
+	}
+	users, err := db.Users()
+	if err != nil {
+		return fmt.Errorf("useradd: %v", err)
+	}
+	switch {
+	case len(users) == 0:
+		// Somebody has to be able to manage the others
+		if role != auth.RoleAdmin {
+			fmt.Println("useradd: the first user is made an administrator")
+			role = auth.RoleAdmin
+		}
+	case !ch.isAdmin():
+		return fmt.Errorf("useradd: only an administrator can add users")
+	}
+
+	if err := ch.addUser(db, rest[0], role); err != nil {
+		return fmt.Errorf("useradd: %v", err)
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleUserdel(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("userdel: expected one user name\nUsage: userdel name")
+	}
+	if !ch.isAdmin() {
+		return fmt.Errorf("userdel: only an administrator can remove users")
+	}
+	name := args[1]
+	if name == ch.currentUser() {
+		return fmt.Errorf("userdel: %s: cannot remove the logged in user", name)
+	}
+	db, err := ch.userDB()
+	if err != nil {
+		return fmt.Errorf("userdel: %v", err)
+	}
+	if err := db.Remove(name); err != nil {
+		return fmt.Errorf("userdel: %v", err)
+	}
+	fmt.Printf("Removed user %s\n", name)
+	return nil
+}
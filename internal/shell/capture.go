@@ -0,0 +1,431 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// captureBufferSize is how much recent output is kept in memory per job
+const captureBufferSize = 64 * 1024
+
+// maxKeptLogs is how many logs of jobs that have left the table are kept,
+// so that the output of a finished job can still be read after it has been
+// reported
+const maxKeptLogs = 20
+
+// ringBuffer keeps the most recent bytes written to it
+type ringBuffer struct {
+	data  []byte
+	start int
+	full  bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, 0, size)}
+}
+
+// Write appends p, overwriting the oldest bytes once the buffer is full
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	size := cap(r.data)
+	n := len(p)
+	if len(p) >= size {
+		p = p[len(p)-size:]
+		r.data = append(r.data[:0], p...)
+		r.start = 0
+		r.full = true
+		return n, nil
+	}
+
+	for _, b := range p {
+		if !r.full {
+			r.data = append(r.data, b)
+			r.full = len(r.data) == size
+			continue
+		}
+		r.data[r.start] = b
+		r.start = (r.start + 1) % size
+	}
+	return n, nil
+}
+
+// Bytes returns the buffered output, oldest first
+func (r *ringBuffer) Bytes() []byte {
+	out := make([]byte, 0, len(r.data))
+	out = append(out, r.data[r.start:]...)
+	return append(out, r.data[:r.start]...)
+}
+
+// outputCapture collects a background job's stdout and stderr into a ring
+// buffer and a log file. Both outlive the job's entry in the table until
+// newer logs push them out, joblog -c clears them or the shell exits.
+type outputCapture struct {
+	mu      sync.Mutex
+	jobID   int
+	pid     int
+	command string
+	started time.Time
+	path    string
+	buffer  *ringBuffer
+	bytes   int64
+	dropped bool
+	done    chan struct{}
+}
+
+// newOutputCapture creates the log file and the pipe the job will write to.
+// The returned write end must be handed to the child and then closed.
+func newOutputCapture() (*outputCapture, *os.File, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("advanced-shell-%d", os.Getuid()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("cannot create job log directory: %v", err)
+	}
+
+	logFile, err := os.CreateTemp(dir, "job-*.log")
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create job log: %v", err)
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		logFile.Close()
+		return nil, nil, fmt.Errorf("cannot capture job output: %v", err)
+	}
+
+	c := &outputCapture{
+		started: time.Now(),
+		path:    logFile.Name(),
+		buffer:  newRingBuffer(captureBufferSize),
+		done:    make(chan struct{}),
+	}
+	go c.collect(reader, logFile)
+	return c, writer, nil
+}
+
+// collect copies output until every writer has closed the pipe
+func (c *outputCapture) collect(reader, logFile *os.File) {
+	defer close(c.done)
+	defer logFile.Close()
+	defer reader.Close()
+
+	chunk := make([]byte, 4096)
+	for {
+		n, err := reader.Read(chunk)
+		if n > 0 {
+			c.mu.Lock()
+			c.bytes += int64(n)
+			if !c.dropped {
+				c.buffer.Write(chunk[:n])
+				logFile.Write(chunk[:n])
+			}
+			c.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// discard frees the buffer and removes the log file. Output the job still
+// writes is read and thrown away so it never blocks.
+func (c *outputCapture) discard() {
+	c.mu.Lock()
+	c.dropped = true
+	c.buffer = newRingBuffer(0)
+	c.mu.Unlock()
+	os.Remove(c.path)
+}
+
+// Bytes reports how much output the job has produced
+func (c *outputCapture) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// Tail returns the last n lines of buffered output, or all of it when n <= 0
+func (c *outputCapture) Tail(n int) string {
+	c.mu.Lock()
+	text := string(c.buffer.Bytes())
+	c.mu.Unlock()
+
+	if n <= 0 {
+		return text
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "")
+}
+
+// Finished reports whether the job has closed its output
+func (c *outputCapture) Finished() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetCapture turns output capture for new background jobs on or off
+func (jm *JobManager) SetCapture(enabled bool) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.captureOutput = enabled
+}
+
+// CaptureEnabled reports whether new background jobs have their output captured
+func (jm *JobManager) CaptureEnabled() bool {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return jm.captureOutput
+}
+
+// keepLogLocked holds on to the log of a job leaving the table, dropping the
+// oldest kept log beyond maxKeptLogs. The caller must hold the lock.
+func (jm *JobManager) keepLogLocked(jobID int, c *outputCapture) {
+	c.mu.Lock()
+	c.jobID = jobID
+	c.mu.Unlock()
+	jm.keptLogs = append(jm.keptLogs, c)
+	if len(jm.keptLogs) > maxKeptLogs {
+		jm.keptLogs[0].discard()
+		jm.keptLogs = jm.keptLogs[1:]
+	}
+}
+
+// ClearJobLogs removes the kept logs of jobs that have left the table and
+// returns how many there were. With all set, the logs of jobs still in the
+// table go too, as when the shell exits.
+func (jm *JobManager) ClearJobLogs(all bool) int {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	cleared := len(jm.keptLogs)
+	for _, c := range jm.keptLogs {
+		c.discard()
+	}
+	jm.keptLogs = nil
+	if all {
+		for job, c := range jm.captures {
+			c.discard()
+			delete(jm.captures, job)
+		}
+	}
+	return cleared
+}
+
+// KeptJobLog returns the most recent kept log of a job that has left the
+// table, found by job ID or by PID
+func (jm *JobManager) KeptJobLog(jobID, pid int) (*outputCapture, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	for i := len(jm.keptLogs) - 1; i >= 0; i-- {
+		if c := jm.keptLogs[i]; (jobID > 0 && c.jobID == jobID) || (pid > 0 && c.pid == pid) {
+			return c, nil
+		}
+	}
+	if jobID > 0 {
+		return nil, fmt.Errorf("job %d not found", jobID)
+	}
+	return nil, fmt.Errorf("pid %d is not a child of this shell", pid)
+}
+
+// JobLog returns the captured output of a job
+func (jm *JobManager) JobLog(jobID int) (*outputCapture, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return nil, fmt.Errorf("job %d not found", jobID)
+	}
+	c, exists := jm.captures[job]
+	if !exists {
+		return nil, fmt.Errorf("no captured output for job %d", jobID)
+	}
+	return c, nil
+}
+
+// JobLogs returns every captured log, oldest first
+func (jm *JobManager) JobLogs() []*outputCapture {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	logs := append(make([]*outputCapture, 0, len(jm.keptLogs)+len(jm.captures)), jm.keptLogs...)
+	for _, c := range jm.captures {
+		logs = append(logs, c)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].started.Before(logs[j].started) })
+	return logs
+}
+
+// pause sleeps for d, returning an error early if the user hits Ctrl-C
+func (jm *JobManager) pause(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-jm.interrupt:
+		return fmt.Errorf("interrupted")
+	}
+}
+
+func (ch *CommandHandler) handleJobLog(args []string) error {
+	usage := "Usage: joblog [-n lines] [-f] [%job | pid]\n       joblog -c\n       joblog capture [on|off]"
+
+	if len(args) == 2 && args[1] == "-c" {
+		cleared := ch.jobManager.ClearJobLogs(false)
+		fmt.Printf("Removed %d finished job log(s)\n", cleared)
+		return nil
+	}
+
+	if len(args) >= 2 && args[1] == "capture" {
+		if len(args) == 2 {
+			state := "off"
+			if ch.jobManager.CaptureEnabled() {
+				state = "on"
+			}
+			fmt.Printf("Background job output capture is %s\n", state)
+			return nil
+		}
+		switch args[2] {
+		case "on":
+			ch.jobManager.SetCapture(true)
+			fmt.Println("Background job output will be captured; view it with 'joblog %job'")
+		case "off":
+			ch.jobManager.SetCapture(false)
+		default:
+			return fmt.Errorf("joblog: capture: expected on or off\n%s", usage)
+		}
+		return nil
+	}
+
+	lines := 0
+	follow := false
+	var target string
+
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-f":
+			follow = true
+		case arg == "-n":
+			if i+1 >= len(args) {
+				return fmt.Errorf("joblog: -n: option requires an argument\n%s", usage)
+			}
+			n, err := parsePositive(args[i+1])
+			if err != nil {
+				return fmt.Errorf("joblog: -n: %v", err)
+			}
+			lines = n
+			i++
+		case strings.HasPrefix(arg, "-") && !IsJobSpec(arg):
+			return fmt.Errorf("joblog: %s: invalid option\n%s", arg, usage)
+		default:
+			if target != "" {
+				return fmt.Errorf("joblog: too many arguments\n%s", usage)
+			}
+			target = arg
+		}
+	}
+
+	// Without a target, list every captured log
+	if target == "" {
+		logs := ch.jobManager.JobLogs()
+		if len(logs) == 0 {
+			fmt.Println("No captured job output (enable with 'joblog capture on')")
+			return nil
+		}
+		for _, c := range logs {
+			state := "running"
+			if c.Finished() {
+				state = "finished"
+			}
+			fmt.Printf("%-7d %-8s %8s  %s  %s\n", c.pid, state, formatBytes(c.Bytes()), c.path, c.command)
+		}
+		return nil
+	}
+
+	capture, err := ch.findJobLog(target)
+	if err != nil {
+		return fmt.Errorf("joblog: %v", err)
+	}
+
+	if !follow {
+		if lines > 0 {
+			fmt.Print(capture.Tail(lines))
+			return nil
+		}
+		content, err := os.ReadFile(capture.path)
+		if err != nil {
+			return fmt.Errorf("joblog: %v", err)
+		}
+		fmt.Print(string(content))
+		return nil
+	}
+
+	return ch.followJobLog(capture, lines)
+}
+
+// findJobLog finds the log of a job in the table or, once the job has been
+// reported and removed, the kept log of the job with that number or PID
+func (ch *CommandHandler) findJobLog(target string) (*outputCapture, error) {
+	job, err := ch.resolveJobOrPID(target)
+	if err == nil {
+		return ch.jobManager.JobLog(job.ID)
+	}
+
+	if IsJobSpec(target) {
+		if jobID, convErr := strconv.Atoi(strings.TrimPrefix(target, "%")); convErr == nil {
+			return ch.jobManager.KeptJobLog(jobID, 0)
+		}
+	} else if pid, convErr := strconv.Atoi(target); convErr == nil {
+		return ch.jobManager.KeptJobLog(0, pid)
+	}
+	return nil, err
+}
+
+// followJobLog prints a job's log and keeps printing new output until the
+// job finishes or the user presses Ctrl-C
+func (ch *CommandHandler) followJobLog(capture *outputCapture, lines int) error {
+	if lines <= 0 {
+		lines = 10
+	}
+	fmt.Print(capture.Tail(lines))
+
+	logFile, err := os.Open(capture.path)
+	if err != nil {
+		return fmt.Errorf("joblog: %v", err)
+	}
+	defer logFile.Close()
+
+	offset := capture.Bytes()
+	if _, err := logFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("joblog: %v", err)
+	}
+
+	ch.jobManager.clearInterrupt()
+	for {
+		finished := capture.Finished()
+		if _, err := io.Copy(os.Stdout, logFile); err != nil {
+			return fmt.Errorf("joblog: %v", err)
+		}
+		if finished {
+			return nil
+		}
+		if err := ch.jobManager.pause(200 * time.Millisecond); err != nil {
+			fmt.Println()
+			return nil
+		}
+	}
+}
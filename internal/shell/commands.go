@@ -1,24 +1,50 @@
 package shell
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/Su5ubedi/advanced-shell/internal/acl"
+	"github.com/Su5ubedi/advanced-shell/internal/auth"
+	"github.com/Su5ubedi/advanced-shell/internal/ipc"
+	"github.com/Su5ubedi/advanced-shell/internal/syncsim"
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
 )
 
 // CommandHandler handles built-in shell commands
 type CommandHandler struct {
 	jobManager *JobManager
+	parser     *CommandParser
+
+	// Semaphores and mutexes created with the sync built-in
+	semaphores map[string]*semaphoreState
+	mutexes    map[string]*syncsim.Mutex
+
+	// Message queues created with mq, shared by the jobs attached to them
+	queues map[string]*ipc.Queue
+
+	// User accounts; input is shared with the shell so that password
+	// prompts read the same buffered stdin
+	users         *auth.DB
+	usersWarned   bool // told the user there is no home directory for the database
+	acl           *acl.Policy
+	session       *session
+	loginRequired bool
+	input         *bufio.Scanner
 }
 
 // NewCommandHandler creates a new command handler
 func NewCommandHandler(jobManager *JobManager) *CommandHandler {
 	return &CommandHandler{
 		jobManager: jobManager,
+		parser:     NewCommandParser(),
 	}
 }
 
@@ -59,6 +85,76 @@ func (ch *CommandHandler) HandleCommand(parsed *ParsedCommand) error {
 		return ch.handleFG(parsed.Args)
 	case "bg":
 		return ch.handleBG(parsed.Args)
+	case "wait":
+		return ch.handleWait(parsed.Args)
+	case "disown":
+		return ch.handleDisown(parsed.Args)
+	case "nohup":
+		return ch.handleNohup(parsed.Args, parsed.Background)
+	case "time":
+		return ch.handleTime(parsed.Args, parsed.Background)
+	case "joblog":
+		return ch.handleJobLog(parsed.Args)
+	case "timeout":
+		return ch.handleTimeout(parsed.Args, parsed.Background)
+	case "retry":
+		return ch.handleRetry(parsed.Args, parsed.Background)
+	case "after":
+		return ch.handleAfter(parsed.Args, parsed.Background)
+	case "run":
+		return ch.handleRun(parsed.Args, parsed.Background)
+	case "parallel":
+		return ch.handleParallel(parsed.Args, parsed.Background)
+	case "at":
+		return ch.handleAt(parsed.Args)
+	case "every":
+		return ch.handleEvery(parsed.Args)
+	case "crontab":
+		return ch.handleCrontab(parsed.Args)
+	case "ulimit":
+		return ch.handleUlimit(parsed.Args)
+	case "limit":
+		return ch.handleLimit(parsed.Args, parsed.Background)
+	case "schedule":
+		return ch.handleSchedule(parsed.Args)
+	case "memsim":
+		return ch.handleMemsim(parsed.Args)
+	case "malloc-sim":
+		return ch.handleMallocSim(parsed.Args)
+	case "sync":
+		return ch.handleSync(parsed.Args)
+	case "deadlock":
+		return ch.handleDeadlock(parsed.Args)
+	case "disksim":
+		return ch.handleDisksim(parsed.Args)
+	case "sched":
+		return ch.handleSched(parsed.Args)
+	case "nice":
+		return ch.handleNice(parsed.Args, parsed.Background)
+	case "renice":
+		return ch.handleRenice(parsed.Args)
+	case "login":
+		return ch.handleLogin(parsed.Args)
+	case "logout":
+		return ch.handleLogout(parsed.Args)
+	case "whoami":
+		return ch.handleWhoami(parsed.Args)
+	case "passwd":
+		return ch.handlePasswd(parsed.Args)
+	case "useradd":
+		return ch.handleUseradd(parsed.Args)
+	case "userdel":
+		return ch.handleUserdel(parsed.Args)
+	case "mq":
+		return ch.handleMq(parsed.Args, parsed.Background)
+	case "mkfifo":
+		return ch.handleMkfifo(parsed.Args)
+	case "acl":
+		return ch.handleACL(parsed.Args)
+	case "acl-chmod":
+		return ch.handleACLChmod(parsed.Args)
+	case "acl-chown":
+		return ch.handleACLChown(parsed.Args)
 	case "help":
 		return ch.handleHelp(parsed.Args)
 	default:
@@ -106,6 +202,10 @@ func (ch *CommandHandler) handleCD(args []string) error {
 		}
 	}
 
+	if err := ch.authorize("cd", dir, acl.Exec, false); err != nil {
+		return err
+	}
+
 	// Check if directory exists before trying to change
 	if stat, err := os.Stat(dir); err != nil {
 		if os.IsNotExist(err) {
@@ -139,12 +239,16 @@ func (ch *CommandHandler) handleExit(args []string) error {
 	// Clean shutdown - kill any remaining jobs
 	jobs := ch.jobManager.GetAllJobs()
 	for _, job := range jobs {
-		if job.Status != "Done" {
-			fmt.Printf("Terminating job [%d]: %s\n", job.ID, job.Command)
+		if job.Status != types.JobStatusDone && !job.NoHangup {
 			ch.jobManager.KillJob(job.ID)
 		}
 	}
 
+	if saved := ch.jobManager.SaveDetached(); saved > 0 {
+		fmt.Printf("Saved %d running job(s); they will be reattached next time\n", saved)
+	}
+	ch.jobManager.ClearJobLogs(true)
+
 	os.Exit(0)
 	return nil
 }
@@ -270,6 +374,9 @@ func (ch *CommandHandler) handleCat(args []string) error {
 		if filename == "" {
 			return fmt.Errorf("cat: empty filename")
 		}
+		if err := ch.authorize("cat", filename, acl.Read, false); err != nil {
+			return err
+		}
 
 		// Check if file exists and is readable
 		if stat, err := os.Stat(filename); err != nil {
@@ -317,6 +424,10 @@ func (ch *CommandHandler) handleMkdir(args []string) error {
 	}
 
 	for _, dirname := range dirs {
+		if err := ch.authorize("mkdir", dirname, acl.Write, false); err != nil {
+			return err
+		}
+
 		var err error
 		if createParents {
 			err = os.MkdirAll(dirname, 0755)
@@ -338,6 +449,9 @@ func (ch *CommandHandler) handleRmdir(args []string) error {
 
 	for i := 1; i < len(args); i++ {
 		dirname := args[i]
+		if err := ch.authorize("rmdir", dirname, acl.Write, false); err != nil {
+			return err
+		}
 		if err := os.Remove(dirname); err != nil {
 			return fmt.Errorf("rmdir: %s: %v", dirname, err)
 		}
@@ -374,6 +488,11 @@ func (ch *CommandHandler) handleRm(args []string) error {
 	}
 
 	for _, filename := range files {
+		// Denials are reported even with -f
+		if err := ch.authorize("rm", filename, acl.Write, recursive); err != nil {
+			return err
+		}
+
 		var err error
 		if recursive {
 			err = os.RemoveAll(filename)
@@ -395,6 +514,9 @@ func (ch *CommandHandler) handleTouch(args []string) error {
 
 	for i := 1; i < len(args); i++ {
 		filename := args[i]
+		if err := ch.authorize("touch", filename, acl.Write, false); err != nil {
+			return err
+		}
 
 		// Check if file exists
 		if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -416,15 +538,71 @@ func (ch *CommandHandler) handleTouch(args []string) error {
 }
 
 func (ch *CommandHandler) handleKill(args []string) error {
+	usage := "Usage: kill [-s sigspec | -n signum | -sigspec] pid | %job ...\n       kill -l [sigspec]"
 	if len(args) < 2 {
-		return fmt.Errorf("kill: missing PID\nUsage: kill [pid1] [pid2] ...")
+		return fmt.Errorf("kill: missing PID\n%s", usage)
+	}
+
+	sig := syscall.SIGTERM
+	targets := args[1:]
+
+	// Parse the signal option, which must come before any targets
+	switch opt := targets[0]; {
+	case opt == "-l" || opt == "-L":
+		return ch.listSignals(targets[1:])
+	case opt == "-s" || opt == "-n":
+		if len(targets) < 2 {
+			return fmt.Errorf("kill: %s: option requires an argument\n%s", opt, usage)
+		}
+		parsed, err := ParseSignal(targets[1])
+		if err != nil {
+			return fmt.Errorf("kill: %v", err)
+		}
+		sig = parsed
+		targets = targets[2:]
+	case opt == "--":
+		targets = targets[1:]
+	case strings.HasPrefix(opt, "-") && len(opt) > 1:
+		parsed, err := ParseSignal(opt[1:])
+		if err != nil {
+			return fmt.Errorf("kill: %v", err)
+		}
+		sig = parsed
+		targets = targets[1:]
+	}
+
+	if len(targets) > 0 && targets[0] == "--" {
+		targets = targets[1:]
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("kill: missing PID\n%s", usage)
 	}
 
+	sigName, _ := SignalName(sig)
 	var errors []string
 	killed := 0
 
-	for i := 1; i < len(args); i++ {
-		pidStr := args[i]
+	// Jobs hit by the signal and their status beforehand, so the job table
+	// can be given time to reflect it
+	signalled := make(map[int]types.JobStatus)
+	jobs := ch.jobManager.GetAllJobs()
+
+	for _, pidStr := range targets {
+		// Job specs such as %1 or %vim target a whole job
+		if IsJobSpec(pidStr) {
+			job, err := ch.jobManager.ResolveJobSpec(pidStr)
+			if err != nil {
+				errors = append(errors, err.Error())
+				continue
+			}
+			if err := ch.jobManager.SignalJob(job.ID, sig); err != nil {
+				errors = append(errors, err.Error())
+				continue
+			}
+			signalled[job.ID] = job.Status
+			killed++
+			continue
+		}
 
 		// Validate PID format
 		if pidStr == "" {
@@ -438,9 +616,10 @@ func (ch *CommandHandler) handleKill(args []string) error {
 			continue
 		}
 
-		// Validate PID range
-		if pid <= 0 {
-			errors = append(errors, fmt.Sprintf("invalid PID %d: must be positive", pid))
+		// Negative PIDs address a whole process group, but 0 and -1 would
+		// hit the shell's own group or every process
+		if pid == 0 || pid == -1 {
+			errors = append(errors, fmt.Sprintf("invalid PID %d: refusing to signal all processes", pid))
 			continue
 		}
 
@@ -450,26 +629,34 @@ func (ch *CommandHandler) handleKill(args []string) error {
 			continue
 		}
 
-		if pid == os.Getpid() {
+		if pid == os.Getpid() || -pid == syscall.Getpgrp() {
 			errors = append(errors, "cannot kill shell process itself")
 			continue
 		}
 
-		process, err := os.FindProcess(pid)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("process %d not found: %v", pid, err))
+		if err := syscall.Kill(pid, sig); err != nil {
+			errors = append(errors, fmt.Sprintf("failed to signal process %d: %v", pid, err))
 			continue
 		}
 
-		if err := process.Kill(); err != nil {
-			errors = append(errors, fmt.Sprintf("failed to kill process %d: %v", pid, err))
-			continue
+		if pid < 0 {
+			fmt.Printf("Sent %s to process group %d\n", sigName, -pid)
+		} else {
+			fmt.Printf("Sent %s to process %d\n", sigName, pid)
+		}
+		for _, job := range jobs {
+			if job.PID == pid || job.PGID == -pid {
+				signalled[job.ID] = job.Status
+			}
 		}
-
-		fmt.Printf("Process %d killed\n", pid)
 		killed++
 	}
 
+	// A probe changes nothing, so there is nothing to wait for
+	if sig != 0 {
+		ch.jobManager.AwaitSignalled(signalled, 500*time.Millisecond)
+	}
+
 	// Report any errors
 	if len(errors) > 0 {
 		if killed == 0 {
@@ -482,74 +669,365 @@ func (ch *CommandHandler) handleKill(args []string) error {
 	return nil
 }
 
-func (ch *CommandHandler) handleJobs(args []string) error {
-	ch.jobManager.CleanupCompletedJobs()
-	ch.jobManager.ListJobs()
+// listSignals implements kill -l, translating between names and numbers
+// when arguments are given
+func (ch *CommandHandler) listSignals(specs []string) error {
+	if len(specs) == 0 {
+		ListSignals()
+		return nil
+	}
+
+	for _, spec := range specs {
+		sig, err := ParseSignal(spec)
+		if err != nil {
+			return fmt.Errorf("kill: %v", err)
+		}
+
+		// A number maps to a name and a name maps to a number
+		if _, err := strconv.Atoi(spec); err == nil {
+			name, _ := SignalName(sig)
+			fmt.Println(strings.TrimPrefix(name, "SIG"))
+		} else {
+			fmt.Println(int(sig))
+		}
+	}
 	return nil
 }
 
-func (ch *CommandHandler) handleFG(args []string) error {
-	if len(args) < 2 {
-		return fmt.Errorf("fg: missing job ID\nUsage: fg [job_id]\nUse 'jobs' to see available jobs")
+func (ch *CommandHandler) handleJobs(args []string) error {
+	if len(args) > 1 {
+		switch args[1] {
+		case "--history":
+			return ch.handleJobHistory(args[2:])
+		case "--persist":
+			return ch.handlePersist(args[2:])
+		}
 	}
 
+	var opts JobListOptions
+
+	for _, arg := range args[1:] {
+		if IsJobSpec(arg) || !strings.HasPrefix(arg, "-") {
+			opts.Specs = append(opts.Specs, arg)
+			continue
+		}
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'v':
+				opts.Verbose = true
+			case 'l':
+				opts.Long = true
+			case 'p':
+				opts.PIDsOnly = true
+			case 'r':
+				opts.RunningOnly = true
+			case 's':
+				opts.StoppedOnly = true
+			case 'g':
+				opts.Graph = true
+			default:
+				return fmt.Errorf("jobs: -%c: invalid option\nUsage: jobs [-glprsv] [%%job ...]", flag)
+			}
+		}
+	}
+
+	if err := ch.jobManager.ListJobs(opts); err != nil {
+		return fmt.Errorf("jobs: %v", err)
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleFG(args []string) error {
 	if len(args) > 2 {
 		return fmt.Errorf("fg: too many arguments")
 	}
 
-	jobIDStr := args[1]
-	if jobIDStr == "" {
-		return fmt.Errorf("fg: empty job ID")
+	// Check if any jobs exist
+	allJobs := ch.jobManager.GetAllJobs()
+	if len(allJobs) == 0 {
+		return fmt.Errorf("fg: no jobs to bring to foreground")
 	}
 
-	jobID, err := strconv.Atoi(jobIDStr)
+	// Default to the current job, as bash does
+	spec := "%+"
+	if len(args) == 2 {
+		spec = args[1]
+	}
+
+	job, err := ch.jobManager.ResolveJobSpec(spec)
 	if err != nil {
-		return fmt.Errorf("fg: invalid job ID '%s': not a number", jobIDStr)
+		return fmt.Errorf("fg: %v\nUse 'jobs' to see available jobs", err)
 	}
 
-	if jobID <= 0 {
-		return fmt.Errorf("fg: invalid job ID %d: must be positive", jobID)
+	return ch.jobManager.BringToForeground(job.ID)
+}
+
+func (ch *CommandHandler) handleBG(args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("bg: too many arguments")
 	}
 
 	// Check if any jobs exist
 	allJobs := ch.jobManager.GetAllJobs()
 	if len(allJobs) == 0 {
-		return fmt.Errorf("fg: no jobs to bring to foreground")
+		return fmt.Errorf("bg: no jobs to resume in background")
+	}
+
+	// Default to the current job, as bash does
+	spec := "%+"
+	if len(args) == 2 {
+		spec = args[1]
+	}
+
+	job, err := ch.jobManager.ResolveJobSpec(spec)
+	if err != nil {
+		return fmt.Errorf("bg: %v\nUse 'jobs' to see available jobs", err)
 	}
 
-	return ch.jobManager.BringToForeground(jobID)
+	return ch.jobManager.ResumeInBackground(job.ID)
 }
 
-func (ch *CommandHandler) handleBG(args []string) error {
+func (ch *CommandHandler) handleWait(args []string) error {
+	nextOnly := false
+	var specs []string
+
+	for _, arg := range args[1:] {
+		if arg == "-n" {
+			nextOnly = true
+		} else if strings.HasPrefix(arg, "-") && !IsJobSpec(arg) {
+			return fmt.Errorf("wait: %s: invalid option\nUsage: wait [-n] [pid | %%job] ...", arg)
+		} else {
+			specs = append(specs, arg)
+		}
+	}
+
+	if nextOnly {
+		if len(specs) > 0 {
+			return fmt.Errorf("wait: -n does not take job arguments")
+		}
+		job, err := ch.jobManager.WaitForNext()
+		if err != nil {
+			return fmt.Errorf("wait: %v", err)
+		}
+		ch.jobManager.ReapJob(job.ID)
+		return waitStatus(job)
+	}
+
+	var jobs []*types.Job
+	if len(specs) == 0 {
+		// Stopped jobs would never finish and scheduled ones may not run for
+		// hours, so only running ones are awaited
+		for _, job := range ch.jobManager.GetAllJobs() {
+			if job.Status != types.JobStatusStopped && job.Schedule == "" {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	for _, spec := range specs {
+		job, err := ch.resolveJobOrPID(spec)
+		if err != nil {
+			return fmt.Errorf("wait: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	finished, err := ch.jobManager.WaitForJobs(jobs)
+	if err != nil {
+		return fmt.Errorf("wait: %v", err)
+	}
+
+	for _, job := range finished {
+		ch.jobManager.ReapJob(job.ID)
+	}
+
+	// Like bash, wait reports the status of the last job named
+	if len(specs) > 0 && len(finished) > 0 {
+		if last := finished[len(finished)-1]; last.ID == jobs[len(jobs)-1].ID {
+			return waitStatus(last)
+		}
+	}
+	return nil
+}
+
+// waitStatus returns an error describing how a finished job failed, or nil
+// if it succeeded
+func waitStatus(job *types.Job) error {
+	switch {
+	case job.ExitCode == 0:
+		return nil
+	case job.Cancelled != "" || job.OverLimit != "" || job.TimedOut:
+		return fmt.Errorf("wait: [%d] %s: %s", job.ID, job.Command, statusText(job, true))
+	case job.Signal != 0:
+		name, _ := SignalName(job.Signal)
+		return fmt.Errorf("wait: [%d] %s: killed by %s", job.ID, job.Command, name)
+	case job.ExitCode < 0:
+		return fmt.Errorf("wait: [%d] %s: status unknown", job.ID, job.Command)
+	}
+	return fmt.Errorf("wait: [%d] %s: exit %d", job.ID, job.Command, job.ExitCode)
+}
+
+func (ch *CommandHandler) handleDisown(args []string) error {
+	keepJob := false
+	allJobs := false
+	runningOnly := false
+	var specs []string
+
+	for _, arg := range args[1:] {
+		if IsJobSpec(arg) || !strings.HasPrefix(arg, "-") {
+			specs = append(specs, arg)
+			continue
+		}
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'h':
+				keepJob = true
+			case 'a':
+				allJobs = true
+			case 'r':
+				runningOnly = true
+			default:
+				return fmt.Errorf("disown: -%c: invalid option\nUsage: disown [-h] [-ar] [%%job ...]", flag)
+			}
+		}
+	}
+
+	var jobs []*types.Job
+	if allJobs || runningOnly {
+		for _, job := range ch.jobManager.GetAllJobs() {
+			if !runningOnly || job.Status == types.JobStatusRunning || job.Status == types.JobStatusReady {
+				jobs = append(jobs, job)
+			}
+		}
+	} else {
+		if len(specs) == 0 {
+			specs = []string{"%+"}
+		}
+		for _, spec := range specs {
+			job, err := ch.jobManager.ResolveJobSpec(spec)
+			if err != nil {
+				return fmt.Errorf("disown: %v", err)
+			}
+			jobs = append(jobs, job)
+		}
+	}
+
+	for _, job := range jobs {
+		// With -h the job stays in the table but survives the shell exiting
+		if keepJob {
+			if err := ch.jobManager.SetNoHangup(job.ID); err != nil {
+				return fmt.Errorf("disown: %v", err)
+			}
+			continue
+		}
+		if err := ch.jobManager.Disown(job.ID); err != nil {
+			return fmt.Errorf("disown: %v", err)
+		}
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleNohup(args []string, background bool) error {
 	if len(args) < 2 {
-		return fmt.Errorf("bg: missing job ID\nUsage: bg [job_id]\nUse 'jobs' to see available jobs")
+		return fmt.Errorf("nohup: missing command\nUsage: nohup command [args...] [&]")
 	}
 
-	if len(args) > 2 {
-		return fmt.Errorf("bg: too many arguments")
+	command := args[1:]
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return fmt.Errorf("nohup: %s: command not found", command[0])
 	}
 
-	jobIDStr := args[1]
-	if jobIDStr == "" {
-		return fmt.Errorf("bg: empty job ID")
+	opts := JobOptions{
+		Background:   background,
+		IgnoreHangup: true,
+		Name:         strings.Join(args, " "),
 	}
 
-	jobID, err := strconv.Atoi(jobIDStr)
+	// Like nohup(1), only redirect streams that are attached to a terminal
+	if isTerminal(os.Stdin) {
+		devNull, err := os.Open(os.DevNull)
+		if err != nil {
+			return fmt.Errorf("nohup: %v", err)
+		}
+		defer devNull.Close()
+		opts.Stdin = devNull
+	}
+
+	if isTerminal(os.Stdout) || isTerminal(os.Stderr) {
+		out, name, err := openNohupOutput()
+		if err != nil {
+			return fmt.Errorf("nohup: %v", err)
+		}
+		defer out.Close()
+		fmt.Printf("nohup: ignoring input and appending output to '%s'\n", name)
+		opts.Stdout = out
+		opts.Stderr = out
+	}
+
+	if background {
+		_, err := ch.jobManager.StartJob(command, opts)
+		if err != nil {
+			return fmt.Errorf("nohup: %v", err)
+		}
+		return nil
+	}
+
+	if _, err := ch.jobManager.RunForeground(command, opts); err != nil {
+		return fmt.Errorf("nohup: %v", err)
+	}
+	return nil
+}
+
+// openNohupOutput opens nohup.out in the current directory, falling back to
+// the home directory when that is not writable
+func openNohupOutput() (*os.File, string, error) {
+	name := "nohup.out"
+	out, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err == nil {
+		return out, name, nil
+	}
+
+	homeDir, homeErr := os.UserHomeDir()
+	if homeErr != nil {
+		return nil, "", err
+	}
+	name = filepath.Join(homeDir, "nohup.out")
+	out, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
 	if err != nil {
-		return fmt.Errorf("bg: invalid job ID '%s': not a number", jobIDStr)
+		return nil, "", err
 	}
+	return out, name, nil
+}
 
-	if jobID <= 0 {
-		return fmt.Errorf("bg: invalid job ID %d: must be positive", jobID)
+// parsePositive parses a strictly positive integer argument
+func parsePositive(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number '%s'", arg)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid number %d: must be positive", n)
 	}
+	return n, nil
+}
 
-	// Check if any jobs exist
-	allJobs := ch.jobManager.GetAllJobs()
-	if len(allJobs) == 0 {
-		return fmt.Errorf("bg: no jobs to resume in background")
+// resolveJobOrPID finds a job from a job spec or from the PID of one of its
+// processes
+func (ch *CommandHandler) resolveJobOrPID(arg string) (*types.Job, error) {
+	if IsJobSpec(arg) {
+		return ch.jobManager.ResolveJobSpec(arg)
 	}
 
-	return ch.jobManager.ResumeInBackground(jobID)
+	pid, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a pid or valid job spec", arg)
+	}
+	for _, job := range ch.jobManager.GetAllJobs() {
+		if job.PID == pid {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("pid %d is not a child of this shell", pid)
 }
 
 func (ch *CommandHandler) handleHelp(args []string) error {
@@ -566,18 +1044,118 @@ func (ch *CommandHandler) handleHelp(args []string) error {
 	fmt.Println("  rmdir [dirs...]   - Remove empty directories")
 	fmt.Println("  rm [options] [files...] - Remove files (-r recursive, -f force)")
 	fmt.Println("  touch [files...]  - Create empty files or update timestamps")
-	fmt.Println("  kill [pids...]    - Kill processes by PID")
+	fmt.Println("  kill [-sig] [pids|%jobs] - Signal processes or jobs (default SIGTERM)")
+	fmt.Println("  kill -l           - List signal names and numbers")
 	fmt.Println("  exit              - Exit shell")
 	fmt.Println("  help              - Show this help")
 	fmt.Println()
+	fmt.Println("Users:")
+	fmt.Println("  login [user]      - Log in, or switch to another user")
+	fmt.Println("  logout            - End the session (asks for a new login if it is required)")
+	fmt.Println("  whoami            - Show the logged in user and their role")
+	fmt.Println("  passwd [user]     - Change your password (admins: anyone's, lifting lockouts)")
+	fmt.Println("  useradd [-r admin|user|guest] name - Add a user (admins only, except the first)")
+	fmt.Println("  userdel name      - Remove a user (admins only)")
+	fmt.Println("                      Accounts live in ~/.advanced-shell/users.json or $ASH_USERS;")
+	fmt.Println("                      ASH_LOGIN=on or -login requires a login at startup, and")
+	fmt.Println("                      5 wrong passwords lock an account for 5 minutes")
+	fmt.Println()
+	fmt.Println("Permissions:")
+	fmt.Println("  acl [list]        - Show the rwx rules for owner, user and guest per path prefix")
+	fmt.Println("  acl check [-u user] paths... - Show what a user may do with paths")
+	fmt.Println("  acl rm paths...   - Remove the rules for paths, so the enclosing prefix applies")
+	fmt.Println("  acl-chmod mode paths... - Set rules with 750 (owner/user/guest) or guest-w,user=rx")
+	fmt.Println("  acl-chown user paths... - Give paths an owner (admins only; - for none)")
+	fmt.Println("                      Once accounts exist, cat needs r, cd x, and mkdir, rmdir,")
+	fmt.Println("                      rm and touch need w; admins may do anything, and without a")
+	fmt.Println("                      login commands run as a guest. Rules live in")
+	fmt.Println("                      ~/.advanced-shell/acl.json or $ASH_ACL")
+	fmt.Println()
 	fmt.Println("Job Control:")
-	fmt.Println("  jobs              - List background jobs")
-	fmt.Println("  fg [job_id]       - Bring job to foreground")
-	fmt.Println("  bg [job_id]       - Resume job in background")
+	fmt.Println("  jobs [-glprsv] [jobs] - List jobs (-l PIDs/exit codes, -p PIDs only,")
+	fmt.Println("                      -r running only, -s stopped only, -v resource usage,")
+	fmt.Println("                      -g dependency graph)")
+	fmt.Println("  jobs --persist on|off - Save finished jobs (and reattach to jobs left running")
+	fmt.Println("                      at exit) in ~/.advanced-shell/jobs.jsonl; ASH_JOB_HISTORY=on")
+	fmt.Println("                      or a file path turns this on at startup")
+	fmt.Println("  jobs --history [--since t] [--until t] [--status s] [--grep pat] [-n N] [-v]")
+	fmt.Println("                    - Query saved jobs by date, status and command")
+	fmt.Println("  fg [job_spec]     - Bring job to foreground (default: current job)")
+	fmt.Println("  bg [job_spec]     - Resume job in background (default: current job)")
+	fmt.Println("  wait [-n] [jobs]  - Wait for jobs to finish (-n: next job only)")
+	fmt.Println("  disown [-h] [jobs] - Stop tracking jobs (-h: only keep them alive on exit)")
+	fmt.Println("  nohup cmd [args]  - Run a command immune to hangups, output to nohup.out")
+	fmt.Println("  time [-p] cmd     - Report real/user/sys time of a command (see TIMEFORMAT)")
+	fmt.Println("  joblog capture on|off - Capture background job output instead of printing it")
+	fmt.Println("  joblog [-n N] [-f] [job] - Show (or follow) a job's captured output")
+	fmt.Println("  joblog -c         - Remove the kept output of finished jobs")
+	fmt.Println("  timeout [-s sig] [-k grace] dur cmd - Kill a command that runs longer than dur")
+	fmt.Println("  retry [-n N] [-backoff dur] [-timeout dur] cmd - Rerun a failing command,")
+	fmt.Println("                      doubling the wait between attempts")
+	fmt.Println("  after %job... cmd - Start a command once the given jobs have succeeded")
+	fmt.Println("  run [--after jobs] [-n N] [-timeout dur] cmd - Start a command with dependencies")
+	fmt.Println("                      (comma-separated job specs) and a retry/timeout policy")
+	fmt.Println("  parallel [-j N] [-k] [--tag] [--halt on-failure] 'cmd {}' ::: items...")
+	fmt.Println("                    - Run cmd once per item (or per line of input), N at a time")
+	fmt.Println("  at 14:30 cmd      - Run a command in the background at a time (or YYYY-MM-DD[THH:MM])")
+	fmt.Println("  after 10m cmd     - Run a command in the background once the delay has passed")
+	fmt.Println("  every 5m cmd      - Run a command in the background at a fixed interval")
+	fmt.Println("  crontab file      - Run the entries of a crontab file while the shell is up")
+	fmt.Println("                      (-l list entries, -r remove them; kill %n cancels one job)")
+	fmt.Printf("  ulimit [-SH] [%s] [n] - Show or set resource limits of commands\n", ulimitFlags("|"))
+	fmt.Println("                      started from the shell (the shell itself is not limited)")
+	fmt.Println("  limit [--mem size] [--cpu dur] [--fsize size] [--nofile n] cmd")
+	fmt.Println("                    - Run a command with its own limits; jobs shows those exceeded")
+	fmt.Println("  sched [rr|priority|fair|off] [-q quantum] [-n N] - Time-slice background jobs")
+	fmt.Println("                      with SIGSTOP/SIGCONT so only N run at once (Ready = waiting")
+	fmt.Println("                      for its turn); with no arguments, show the policy and jobs")
+	fmt.Println("  nice [-n adj] cmd - Run a command with a higher niceness (default 10)")
+	fmt.Println("  renice [-n] prio %job|pid... - Change the niceness of jobs or processes")
+	fmt.Println("  mkfifo [-m mode] names... - Create named pipes for jobs to talk through")
+	fmt.Println("  mq create [-n capacity] names... - Create message queues (default 64 messages)")
+	fmt.Println("  mq send [-t timeout] name msg - Queue a message, waiting while the queue is full")
+	fmt.Println("  mq recv [-t timeout] [-v] name - Take the oldest message, waiting for one")
+	fmt.Println("  mq run [-in q] [-out q] [-close] cmd - Feed a command's input from queue q and")
+	fmt.Println("                      send its output lines to another; -close closes the out")
+	fmt.Println("                      queue when it exits. jobs shows each job's queues")
+	fmt.Println("  mq [list] | mq close names... | mq rm names... - Show, close or remove queues")
+	fmt.Println()
+	fmt.Println("Simulators:")
+	fmt.Println("  schedule [-a alg|all] [-q n] (-f file | name:arrival:burst[:priority]...)")
+	fmt.Println("                    - Simulate CPU scheduling (fcfs, sjf, srtf, rr, priority,")
+	fmt.Println("                      priority-p, mlfq) with a Gantt chart and waiting times")
+	fmt.Println("  memsim [-a alg|all] [-f frames] [-s size] (-r n | references...)")
+	fmt.Println("                    - Simulate page replacement (fifo, lru, opt, clock, lfu)")
+	fmt.Println("                      with a frame table; -s translates addresses to pages")
+	fmt.Println("  memsim -belady [references...]")
+	fmt.Println("                    - Show faults for each frame count and Belady's anomaly")
+	fmt.Println("  malloc-sim [-a strategy|all] [-size n] [-compact] (-f script | name:size | free:name | compact...)")
+	fmt.Println("                    - Simulate contiguous allocation (first, next, best, worst")
+	fmt.Println("                      fit, buddy) with a memory map and fragmentation figures")
+	fmt.Println("  sync problem [-t duration] [options]")
+	fmt.Println("                    - Run producer-consumer, readers-writers, philosophers or")
+	fmt.Println("                      barber with a live event log and starvation detection")
+	fmt.Println("  sync sem|mutex [op name ...]")
+	fmt.Println("                    - Create, wait on, post, lock and unlock named semaphores")
+	fmt.Println("                      and mutexes; run holds one while a background job runs")
+	fmt.Println("  deadlock [-dot] (-f scenario | -available v -alloc m -max m [-request 'P v'])")
+	fmt.Println("                    - Run the Banker's safety and request algorithms, or find")
+	fmt.Println("                      cycles and deadlocked processes in an allocation graph")
+	fmt.Println("  disksim [-a alg|all] -h head [-d up|down] [-c cylinders] (requests... | -r n)")
+	fmt.Println("                    - Schedule disk requests (fcfs, sstf, scan, c-scan, look,")
+	fmt.Println("                      c-look) with a head-movement chart and comparison")
+	fmt.Println()
+	fmt.Println("Job Specs:")
+	fmt.Println("  %n                - Job number n")
+	fmt.Println("  %% or %+          - Current job")
+	fmt.Println("  %-                - Previous job")
+	fmt.Println("  %name             - Job whose command starts with name")
+	fmt.Println("  %?text            - Job whose command contains text")
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  command &         - Run command in background")
 	fmt.Println("  Ctrl+C            - Interrupt current foreground process")
+	fmt.Println("  Ctrl+Z            - Suspend current foreground process")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  ls -la")
@@ -585,16 +1163,13 @@ func (ch *CommandHandler) handleHelp(args []string) error {
 	fmt.Println("  rm -rf unwanted_dir")
 	fmt.Println("  sleep 10 &")
 	fmt.Println("  jobs")
-	fmt.Println("  fg 1")
+	fmt.Println("  fg %1")
+	fmt.Println("  kill -STOP %1")
 	fmt.Println("  cat file1.txt file2.txt")
 	fmt.Println("  echo \"Hello\\nWorld\"")
 	fmt.Println()
 	fmt.Println("Advanced Features (Future Deliverables):")
-	fmt.Println("  - Process scheduling algorithms")
-	fmt.Println("  - Memory management simulation")
-	fmt.Println("  - Process synchronization")
 	fmt.Println("  - Command piping")
-	fmt.Println("  - User authentication and file permissions")
 	fmt.Println()
 	return nil
 }
@@ -0,0 +1,145 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Su5ubedi/advanced-shell/internal/scheduler"
+)
+
+// chartWidth is how wide simulator charts may get before they wrap
+const chartWidth = 100
+
+func (ch *CommandHandler) handleSchedule(args []string) error {
+	usage := "Usage: schedule [-a algorithm|all] [-q quantum] [-levels n] [-boost n] [-v] (-f file | [name:]arrival:burst[:priority]...)\n" +
+		"Algorithms: fcfs, sjf, srtf, rr, priority, priority-p, mlfq"
+
+	algorithms := []scheduler.Algorithm{scheduler.FCFS}
+	opts := scheduler.DefaultOptions
+	file := ""
+	verbose := false
+	rest := args[1:]
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		if rest[0] == "-v" {
+			verbose = true
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("schedule: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		var err error
+		switch rest[0] {
+		case "-a":
+			if rest[1] == "all" {
+				algorithms = scheduler.Algorithms
+				break
+			}
+			algorithms = nil
+			for _, name := range strings.Split(rest[1], ",") {
+				alg, err := scheduler.ParseAlgorithm(name)
+				if err != nil {
+					return fmt.Errorf("schedule: %v\n%s", err, usage)
+				}
+				algorithms = append(algorithms, alg)
+			}
+		case "-q":
+			opts.Quantum, err = parsePositive(rest[1])
+		case "-levels":
+			opts.Levels, err = parsePositive(rest[1])
+		case "-boost":
+			opts.Boost, err = parsePositive(rest[1])
+		case "-f":
+			file = rest[1]
+		default:
+			return fmt.Errorf("schedule: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("schedule: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	var procs []scheduler.Process
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("schedule: %v", err)
+		}
+		defer f.Close()
+		if procs, err = scheduler.ReadProcesses(f); err != nil {
+			return fmt.Errorf("schedule: %s: %v", file, err)
+		}
+	}
+	for _, spec := range rest {
+		p, err := scheduler.ParseProcess(spec, len(procs)+1)
+		if err != nil {
+			return fmt.Errorf("schedule: %v", err)
+		}
+		procs = append(procs, p)
+	}
+	if len(procs) == 0 {
+		return fmt.Errorf("schedule: no processes given\n%s", usage)
+	}
+
+	results := make([]*scheduler.Result, 0, len(algorithms))
+	for _, alg := range algorithms {
+		result, err := scheduler.Simulate(procs, alg, opts)
+		if err != nil {
+			return fmt.Errorf("schedule: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 1 || verbose {
+		for i, result := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			printSchedule(result)
+		}
+	}
+	if len(results) > 1 {
+		if verbose {
+			fmt.Println()
+		}
+		compareSchedules(results)
+	}
+	return nil
+}
+
+// printSchedule prints the Gantt chart and per-process times of a simulation
+func printSchedule(result *scheduler.Result) {
+	fmt.Println(result.Algorithm.Title(result.Options))
+	fmt.Println()
+	fmt.Println(scheduler.Chart(result.Gantt, chartWidth))
+
+	fmt.Printf("%-10s %7s %5s %8s %10s %10s %7s %8s\n",
+		"PROCESS", "ARRIVAL", "BURST", "PRIORITY", "COMPLETION", "TURNAROUND", "WAITING", "RESPONSE")
+	for _, s := range result.Stats {
+		fmt.Printf("%-10s %7d %5d %8d %10d %10d %7d %8d\n",
+			s.Name, s.Arrival, s.Burst, s.Priority, s.Completion, s.Turnaround, s.Waiting, s.Response)
+	}
+	waiting, turnaround, response := result.Averages()
+	fmt.Printf("%-10s %7s %5s %8s %10s %10.2f %7.2f %8.2f\n", "Average", "", "", "", "", turnaround, waiting, response)
+
+	fmt.Printf("\nCPU utilisation %.1f%%, throughput %.3f processes per unit, %d context switches\n",
+		result.Utilisation()*100, float64(len(result.Stats))/float64(result.End()), result.ContextSwitches)
+}
+
+// compareSchedules prints the averages of several simulations side by side
+func compareSchedules(results []*scheduler.Result) {
+	fmt.Printf("%-12s %12s %15s %13s %9s %7s\n", "ALGORITHM", "AVG WAITING", "AVG TURNAROUND", "AVG RESPONSE", "SWITCHES", "END")
+	best := results[0]
+	for _, result := range results {
+		waiting, turnaround, response := result.Averages()
+		fmt.Printf("%-12s %12.2f %15.2f %13.2f %9d %7d\n",
+			result.Algorithm, waiting, turnaround, response, result.ContextSwitches, result.End())
+		if w, _, _ := best.Averages(); waiting < w {
+			best = result
+		}
+	}
+	fmt.Printf("\nLowest average waiting time: %s\n", best.Algorithm.Title(best.Options))
+}
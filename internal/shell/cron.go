@@ -0,0 +1,340 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// cronField is the set of values a crontab field matches, one bit per value
+type cronField uint64
+
+func (f cronField) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// cronSchedule is a five-field crontab time specification
+type cronSchedule struct {
+	spec                          string
+	minute, hour, dom, month, dow cronField
+	domStar, dowStar              bool
+}
+
+// cronMacros are the @ shorthands cron understands
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var cronDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseCron parses the five time fields of a crontab line
+func parseCron(fields []string) (*cronSchedule, error) {
+	spec := strings.Join(fields, " ")
+	if len(fields) == 1 {
+		expanded, ok := cronMacros[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown macro", fields[0])
+		}
+		fields = strings.Fields(expanded)
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 time fields, got %d", len(fields))
+	}
+
+	s := &cronSchedule{spec: spec}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDays); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	// Sunday is both 0 and 7
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges (a-b) and
+// steps (*/n, a-b/n). names, if given, are accepted for the values from min.
+func parseCronField(field string, min, max int, names []string) (cronField, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return min + i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%s: expected a value from %d to %d", s, min, max)
+		}
+		return n, nil
+	}
+
+	var set cronField
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: range runs backwards", rng)
+			}
+		default:
+			var err error
+			if lo, err = value(rng); err != nil {
+				return 0, err
+			}
+			// a/n means from a to the end in steps of n
+			if step == 1 {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// dayMatches applies cron's rule that when both day fields are restricted,
+// a day matching either of them will do
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// A spec such as 30 2 31 2 * never matches; give up after a few years
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !s.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) String() string {
+	return "cron " + s.spec
+}
+
+// cronEntry is one line of a crontab file
+type cronEntry struct {
+	line     int
+	schedule *cronSchedule
+	command  string
+}
+
+// readCrontab parses a crontab file: five time fields, or an @ macro,
+// followed by a command run with /bin/sh. Blank lines, comments and
+// environment assignments are skipped.
+func readCrontab(path string) ([]cronEntry, []error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer f.Close()
+
+	var entries []cronEntry
+	var errs []error
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if !strings.HasPrefix(fields[0], "@") && strings.Contains(fields[0], "=") {
+			continue
+		}
+
+		timeFields := 5
+		if strings.HasPrefix(fields[0], "@") {
+			timeFields = 1
+		}
+		if len(fields) <= timeFields {
+			errs = append(errs, fmt.Errorf("%s:%d: missing command", path, n))
+			continue
+		}
+		schedule, err := parseCron(fields[:timeFields])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %v", path, n, err))
+			continue
+		}
+
+		// Keep the command's own spacing and quoting for the shell
+		command := line
+		for _, field := range fields[:timeFields] {
+			command = strings.TrimSpace(strings.TrimPrefix(command, field))
+		}
+		entries = append(entries, cronEntry{line: n, schedule: schedule, command: command})
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return entries, errs
+}
+
+// CronJobs returns the jobs started from the crontab
+func (jm *JobManager) CronJobs() []*types.Job {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	var jobs []*types.Job
+	for _, job := range jm.jobs {
+		if jm.isCronLocked(job) {
+			jobs = append(jobs, snapshot(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// CancelCronJobs stops the jobs started from the crontab, letting a run
+// that is in progress finish, and returns how many there were
+func (jm *JobManager) CancelCronJobs() int {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	count := 0
+	for _, job := range jm.jobs {
+		if !jm.isCronLocked(job) {
+			continue
+		}
+		count++
+		if job.Status == types.JobStatusWaiting {
+			job.Cancelled = "crontab removed"
+			jm.cancelLocked(job, syscall.SIGTERM)
+		} else {
+			jm.controls[job].cancelled = true
+		}
+	}
+	return count
+}
+
+// isCronLocked reports whether a job was started from the crontab. The
+// caller must hold the lock.
+func (jm *JobManager) isCronLocked(job *types.Job) bool {
+	control := jm.controls[job]
+	if control == nil || job.Status == types.JobStatusDone {
+		return false
+	}
+	_, ok := control.opts.Schedule.(*cronSchedule)
+	return ok
+}
+
+func (ch *CommandHandler) handleCrontab(args []string) error {
+	usage := "Usage: crontab file | crontab -l | crontab -r"
+
+	if len(args) != 2 {
+		return fmt.Errorf("crontab: expected one argument\n%s", usage)
+	}
+
+	switch args[1] {
+	case "-l":
+		jobs := ch.jobManager.CronJobs()
+		if len(jobs) == 0 {
+			fmt.Println("crontab: no entries loaded")
+			return nil
+		}
+		for _, job := range jobs {
+			next := "-"
+			if job.NextRun != nil {
+				next = job.NextRun.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("[%d] %-20s next %-16s  %s\n", job.ID, strings.TrimPrefix(job.Schedule, "cron "), next, job.Command)
+		}
+		return nil
+	case "-r":
+		fmt.Printf("crontab: removed %d entries\n", ch.jobManager.CancelCronJobs())
+		return nil
+	}
+	if strings.HasPrefix(args[1], "-") {
+		return fmt.Errorf("crontab: %s: invalid option\n%s", args[1], usage)
+	}
+
+	entries, errs := readCrontab(args[1])
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "crontab: %v\n", err)
+	}
+	if len(entries) == 0 {
+		if len(errs) > 0 {
+			return fmt.Errorf("crontab: %s: no entries loaded", args[1])
+		}
+		return fmt.Errorf("crontab: %s: no entries", args[1])
+	}
+
+	// A new table replaces the old one
+	ch.jobManager.CancelCronJobs()
+	for _, entry := range entries {
+		opts := JobOptions{Name: entry.command, Quiet: true, Schedule: entry.schedule}
+		job, err := ch.jobManager.StartJob([]string{"/bin/sh", "-c", entry.command}, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "crontab: %s:%d: %v\n", args[1], entry.line, err)
+			continue
+		}
+		fmt.Printf("[%d] cron %s, next run %s: %s\n", job.ID, entry.schedule.spec,
+			job.NextRun.Format("2006-01-02 15:04"), entry.command)
+	}
+	return nil
+}
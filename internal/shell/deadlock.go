@@ -0,0 +1,232 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Su5ubedi/advanced-shell/internal/deadlock"
+)
+
+func (ch *CommandHandler) handleDeadlock(args []string) error {
+	usage := "Usage: deadlock [-dot] (-f scenario | -available v (-alloc m) (-max m | -need m | -waiting m) [-request 'P v']...)\n" +
+		"Vectors list a count per resource (\"3 3 2\"); matrices separate processes P0, P1... with ';'"
+
+	var scenario strings.Builder
+	file, dot := "", false
+	rest := args[1:]
+	for len(rest) > 0 {
+		if rest[0] == "-dot" {
+			dot = true
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("deadlock: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		switch rest[0] {
+		case "-f":
+			file = rest[1]
+		case "-available", "-total":
+			fmt.Fprintf(&scenario, "%s %s\n", rest[0][1:], rest[1])
+		case "-alloc", "-max", "-need", "-waiting":
+			for i, row := range strings.Split(rest[1], ";") {
+				fmt.Fprintf(&scenario, "%s P%d %s\n", rest[0][1:], i, row)
+			}
+		case "-request":
+			fmt.Fprintf(&scenario, "request %s\n", strings.Replace(rest[1], ":", " ", 1))
+		default:
+			return fmt.Errorf("deadlock: %s: invalid option\n%s", rest[0], usage)
+		}
+		rest = rest[2:]
+	}
+	if file == "" && scenario.Len() == 0 {
+		return fmt.Errorf("deadlock: no scenario given\n%s", usage)
+	}
+
+	source := "command line"
+	text := scenario.String()
+	if file != "" {
+		if text != "" {
+			return fmt.Errorf("deadlock: -f cannot be combined with matrices on the command line")
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("deadlock: %v", err)
+		}
+		source, text = file, string(data)
+	}
+	s, err := deadlock.ReadScenario(strings.NewReader(text))
+	if err != nil {
+		return fmt.Errorf("deadlock: %s: %v", source, err)
+	}
+
+	printDeadlockState(s)
+	if s.Max != nil {
+		fmt.Println()
+		if err := runBanker(s); err != nil {
+			return fmt.Errorf("deadlock: %v", err)
+		}
+	}
+	if s.Request != nil {
+		fmt.Println()
+		stuck := detectDeadlock(s)
+		if dot {
+			fmt.Println()
+			fmt.Println(s.Dot(stuck))
+		}
+	}
+	return nil
+}
+
+// printDeadlockState prints the resources and the matrices describing a
+// system
+func printDeadlockState(s *deadlock.State) {
+	fmt.Printf("Resources %s, total %s, available %s\n\n",
+		strings.Join(s.Resources, " "), deadlock.Vector(s.Total()), deadlock.Vector(s.Available))
+
+	headers := []string{"ALLOCATION"}
+	columns := [][][]int{s.Allocation}
+	if s.Max != nil {
+		headers = append(headers, "MAX", "NEED")
+		columns = append(columns, s.Max, s.Need())
+	}
+	if s.Request != nil {
+		headers = append(headers, "WAITING")
+		columns = append(columns, s.Request)
+	}
+
+	nameWidth := len("PROCESS")
+	for _, name := range s.Processes {
+		nameWidth = max(nameWidth, len(name))
+	}
+	width := len(deadlock.Vector(s.Available))
+	for _, h := range headers {
+		width = max(width, len(h))
+	}
+
+	row := func(name string, cells []string) {
+		line := fmt.Sprintf("%-*s", nameWidth, name)
+		for _, cell := range cells {
+			line += fmt.Sprintf("  %-*s", width, cell)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	row("PROCESS", headers)
+	for p, name := range s.Processes {
+		cells := make([]string, len(columns))
+		for i, m := range columns {
+			cells[i] = deadlock.Vector(m[p])
+		}
+		row(name, cells)
+	}
+}
+
+// runBanker runs the safety algorithm and then tries each pending request
+func runBanker(s *deadlock.State) error {
+	fmt.Println("Banker's safety algorithm:")
+	check := s.Safety()
+	printCheck(s, check, "need")
+	if check.OK() {
+		fmt.Printf("SAFE: safe sequence %s\n", processList(s, check.Sequence))
+	} else {
+		fmt.Printf("UNSAFE: %s cannot be sure to finish\n", processList(s, check.Stuck))
+	}
+
+	for _, req := range s.Pending {
+		fmt.Printf("\nRequest by %s for %s: ", s.Processes[req.Process], deadlock.Vector(req.Amount))
+		outcome, err := s.TryRequest(req)
+		if err != nil {
+			fmt.Println("refused")
+			return err
+		}
+		fmt.Println(outcome.Reason)
+		switch {
+		case outcome.Granted:
+			fmt.Printf("  safe sequence %s, available now %s\n",
+				processList(s, outcome.Check.Sequence), deadlock.Vector(s.Available))
+		case outcome.Check.Stuck != nil:
+			fmt.Printf("  %s could not be sure to finish\n", processList(s, outcome.Check.Stuck))
+		}
+	}
+	return nil
+}
+
+// detectDeadlock prints the resource-allocation graph, its cycles and the
+// outcome of the detection algorithm, and returns the deadlocked processes
+func detectDeadlock(s *deadlock.State) []int {
+	fmt.Println("Resource-allocation graph:")
+	for _, e := range s.Edges() {
+		count := ""
+		if e.Count > 1 {
+			count = fmt.Sprintf(" x%d", e.Count)
+		}
+		if e.Request {
+			fmt.Printf("  %s -> %s%s (requests)\n", s.Processes[e.Process], s.Resources[e.Resource], count)
+		} else {
+			fmt.Printf("  %s -> %s%s (holds)\n", s.Resources[e.Resource], s.Processes[e.Process], count)
+		}
+	}
+
+	fmt.Println("\nWait-for graph:")
+	waiting := false
+	for p, targets := range s.WaitsFor() {
+		if len(targets) > 0 {
+			waiting = true
+			fmt.Printf("  %s waits for %s\n", s.Processes[p], processList(s, targets))
+		}
+	}
+	if !waiting {
+		fmt.Println("  nobody is waiting on another process")
+	}
+
+	cycles := s.Cycles()
+	if len(cycles) > 0 {
+		fmt.Println("\nCycles:")
+		for _, cycle := range cycles {
+			fmt.Printf("  %s\n", s.CycleText(cycle))
+		}
+	}
+
+	fmt.Println("\nDetection algorithm:")
+	check := s.Detect()
+	printCheck(s, check, "request")
+	if check.OK() {
+		if len(cycles) > 0 {
+			fmt.Println("No deadlock: the cycles can be broken by spare instances")
+		} else {
+			fmt.Println("No deadlock")
+		}
+		return nil
+	}
+
+	fmt.Printf("DEADLOCK: %s\n", processList(s, check.Stuck))
+	fmt.Println("\nSuggested victims:")
+	for i, v := range s.Victims() {
+		fmt.Printf("  %d. terminate %s, releasing %s", i+1, s.Processes[v.Process], deadlock.Vector(v.Releases))
+		if v.Freed > 0 {
+			fmt.Printf(", which lets %d other(s) finish", v.Freed)
+		}
+		fmt.Println()
+	}
+	return check.Stuck
+}
+
+// printCheck prints the steps of a safety or detection run
+func printCheck(s *deadlock.State, check deadlock.Check, wants string) {
+	for _, step := range check.Steps {
+		fmt.Printf("  %-6s %s %s <= work %s, finishes and releases its resources: work %s\n",
+			s.Processes[step.Process], wants, deadlock.Vector(step.Wants),
+			deadlock.Vector(step.Work), deadlock.Vector(step.After))
+	}
+}
+
+// processList names the given processes
+func processList(s *deadlock.State, procs []int) string {
+	names := make([]string, len(procs))
+	for i, p := range procs {
+		names[i] = s.Processes[p]
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,258 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// deferLocked adds a job that is started once every job in opts.After has
+// finished successfully. The caller must hold the lock.
+func (jm *JobManager) deferLocked(job *types.Job, opts JobOptions) error {
+	deps := make([]*types.Job, 0, len(opts.After))
+	for _, id := range opts.After {
+		dep, exists := jm.jobs[id]
+		if !exists {
+			return fmt.Errorf("job %d not found", id)
+		}
+		deps = append(deps, dep)
+	}
+
+	job.Status = types.JobStatusWaiting
+	job.DependsOn = append([]int(nil), opts.After...)
+	jm.controls[job] = &jobControl{opts: opts}
+	jm.deps[job] = deps
+
+	if opts.Background {
+		jm.addJob(job)
+		fmt.Printf("[%d] waiting for %s\n", job.ID, dependencyList(job))
+	}
+
+	// The dependencies may have finished already
+	jm.notifyLocked()
+	return nil
+}
+
+// settleDependenciesLocked starts the jobs whose dependencies have all
+// succeeded and cancels those with a dependency that failed. Cancelling a
+// job can fail its own dependents in turn, so it repeats until nothing
+// changes. The caller must hold the lock.
+func (jm *JobManager) settleDependenciesLocked() {
+	for settled := false; !settled; {
+		settled = true
+		for job, deps := range jm.deps {
+			if job.Status != types.JobStatusWaiting {
+				// Killed by the user while it waited
+				delete(jm.deps, job)
+				continue
+			}
+
+			failed, ready := dependencyOutcome(deps)
+			switch {
+			case failed != nil:
+				delete(jm.deps, job)
+				job.Cancelled = fmt.Sprintf("dependency %%%d failed", failed.ID)
+				job.ExitCode = 1
+				jm.finishLocked(job)
+				settled = false
+			case ready:
+				delete(jm.deps, job)
+				job.StartTime = time.Now()
+				if err := jm.spawnLocked(job, jm.controls[job].opts); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					job.ExitCode = 127
+					jm.finishLocked(job)
+					settled = false
+				}
+			}
+		}
+	}
+}
+
+// dependencyOutcome returns the first dependency that failed, or reports
+// whether all of them have succeeded
+func dependencyOutcome(deps []*types.Job) (*types.Job, bool) {
+	ready := true
+	for _, dep := range deps {
+		if dep.Status != types.JobStatusDone {
+			ready = false
+			continue
+		}
+		if dep.ExitCode != 0 || dep.Cancelled != "" {
+			return dep, false
+		}
+	}
+	return nil, ready
+}
+
+// stateLocked is statusText with waiting dependents split into Pending, when
+// their dependencies are making progress, and Blocked, when one of them is
+// stopped. The caller must hold the lock.
+func (jm *JobManager) stateLocked(job *types.Job, long bool) string {
+	if jm.deps[job] == nil {
+		return statusText(job, long)
+	}
+	if jm.blockedLocked(job) {
+		return "Blocked"
+	}
+	return "Pending"
+}
+
+// blockedLocked reports whether a waiting job depends, directly or through
+// other waiting jobs, on a stopped job
+func (jm *JobManager) blockedLocked(job *types.Job) bool {
+	for _, dep := range jm.deps[job] {
+		if dep.Status == types.JobStatusStopped || jm.blockedLocked(dep) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyList formats a job's dependencies as job specs
+func dependencyList(job *types.Job) string {
+	specs := make([]string, len(job.DependsOn))
+	for i, id := range job.DependsOn {
+		specs[i] = fmt.Sprintf("%%%d", id)
+	}
+	return strings.Join(specs, " ")
+}
+
+// printGraphLocked prints jobs as a forest with every job indented under the
+// jobs it depends on. A job with several dependencies appears under each.
+// The caller must hold the lock.
+func (jm *JobManager) printGraphLocked(jobs []*types.Job, marker func(*types.Job) string) {
+	listed := make(map[int]bool, len(jobs))
+	for _, job := range jobs {
+		listed[job.ID] = true
+	}
+
+	// Job IDs are only reused above the highest ID in use, so a dependency
+	// ID lower than the dependent's still names the same job
+	children := make(map[int][]*types.Job)
+	var roots []*types.Job
+	for _, job := range jobs {
+		root := true
+		for _, id := range job.DependsOn {
+			if id < job.ID && listed[id] {
+				children[id] = append(children[id], job)
+				root = false
+			}
+		}
+		if root {
+			roots = append(roots, job)
+		}
+	}
+
+	line := func(job *types.Job) string {
+		return fmt.Sprintf("[%d]%s %-9s %s", job.ID, marker(job), jm.stateLocked(job, false), jm.describeLocked(job, false))
+	}
+
+	var walk func(job *types.Job, indent string)
+	walk = func(job *types.Job, indent string) {
+		kids := children[job.ID]
+		for i, kid := range kids {
+			branch, next := "├─", "│ "
+			if i == len(kids)-1 {
+				branch, next = "└─", "  "
+			}
+			fmt.Printf("%s%s%s\n", indent, branch, line(kid))
+			walk(kid, indent+next)
+		}
+	}
+
+	for _, root := range roots {
+		fmt.Println(line(root))
+		walk(root, "")
+	}
+}
+
+func (ch *CommandHandler) handleAfter(args []string, background bool) error {
+	usage := "Usage: after %job [%job ...] command [args...] [&]\n       after delay command [args...]"
+
+	if len(args) > 2 && !IsJobSpec(args[1]) {
+		return ch.handleDelayed(args)
+	}
+
+	var specs []string
+	rest := args[1:]
+	for len(rest) > 0 && IsJobSpec(rest[0]) {
+		specs = append(specs, rest[0])
+		rest = rest[1:]
+	}
+	if len(specs) == 0 || len(rest) == 0 {
+		return fmt.Errorf("after: expected job specs followed by a command\n%s", usage)
+	}
+
+	return ch.startDependent("after", specs, rest, JobOptions{Background: background})
+}
+
+func (ch *CommandHandler) handleRun(args []string, background bool) error {
+	usage := "Usage: run [--after %job[,%job...]] [-n attempts] [-backoff duration] [-timeout duration] command [args...] [&]"
+
+	opts := JobOptions{Background: background, Backoff: defaultBackoff, KillAfter: defaultKillAfter}
+	var specs []string
+	rest := args[1:]
+options:
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		if rest[0] == "--" {
+			rest = rest[1:]
+			break options
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("run: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		var err error
+		switch rest[0] {
+		case "--after", "-after":
+			for _, spec := range strings.Split(rest[1], ",") {
+				if spec != "" {
+					specs = append(specs, spec)
+				}
+			}
+		case "-n":
+			opts.Attempts, err = parsePositive(rest[1])
+		case "-backoff":
+			opts.Backoff, err = parseDuration(rest[1])
+		case "-timeout":
+			opts.Timeout, err = parseDuration(rest[1])
+		default:
+			return fmt.Errorf("run: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("run: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	if len(rest) == 0 {
+		return fmt.Errorf("run: missing command\n%s", usage)
+	}
+
+	return ch.startDependent("run", specs, rest, opts)
+}
+
+// startDependent resolves the job specs a command depends on and starts it
+// through the job manager, waiting for it when it runs in the foreground
+func (ch *CommandHandler) startDependent(name string, specs, command []string, opts JobOptions) error {
+	for _, spec := range specs {
+		job, err := ch.jobManager.ResolveJobSpec(spec)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		opts.After = append(opts.After, job.ID)
+	}
+
+	job, err := ch.startPolicyJob(name, command, opts)
+	if err != nil || job == nil {
+		return err
+	}
+	if job.Cancelled != "" {
+		return fmt.Errorf("%s: %s: cancelled, %s", name, command[0], job.Cancelled)
+	}
+	return nil
+}
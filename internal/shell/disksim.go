@@ -0,0 +1,171 @@
+package shell
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/internal/disk"
+)
+
+// defaultCylinders is the disk size disksim models unless told otherwise
+const defaultCylinders = 200
+
+func (ch *CommandHandler) handleDisksim(args []string) error {
+	usage := "Usage: disksim [-a algorithm|all] -h head [-d up|down] [-c cylinders] [-v] (requests... | -r n [-seed s])\n" +
+		"Algorithms: fcfs, sstf, scan, c-scan, look, c-look"
+
+	algorithms := []disk.Algorithm{disk.FCFS}
+	head, cylinders := -1, defaultCylinders
+	dir := disk.Up
+	random, seed := 0, time.Now().UnixNano()
+	verbose := false
+	rest := args[1:]
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		if rest[0] == "-v" {
+			verbose = true
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("disksim: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		var err error
+		switch rest[0] {
+		case "-a":
+			if rest[1] == "all" {
+				algorithms = disk.Algorithms
+				break
+			}
+			algorithms = nil
+			for _, name := range strings.Split(rest[1], ",") {
+				alg, err := disk.ParseAlgorithm(name)
+				if err != nil {
+					return fmt.Errorf("disksim: %v\n%s", err, usage)
+				}
+				algorithms = append(algorithms, alg)
+			}
+		case "-h":
+			head, err = strconv.Atoi(rest[1])
+			if err == nil && head < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "-d":
+			dir, err = disk.ParseDirection(rest[1])
+		case "-c":
+			cylinders, err = parsePositive(rest[1])
+		case "-r":
+			random, err = parsePositive(rest[1])
+		case "-seed":
+			seed, err = strconv.ParseInt(rest[1], 10, 64)
+		default:
+			return fmt.Errorf("disksim: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("disksim: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+	if head < 0 {
+		return fmt.Errorf("disksim: missing head position\n%s", usage)
+	}
+
+	var requests []int
+	for _, arg := range rest {
+		for _, word := range strings.FieldsFunc(arg, func(r rune) bool { return r == ',' || r == ' ' }) {
+			c, err := strconv.Atoi(word)
+			if err != nil {
+				return fmt.Errorf("disksim: %s: invalid cylinder", word)
+			}
+			requests = append(requests, c)
+		}
+	}
+	if random > 0 {
+		rng := rand.New(rand.NewSource(seed))
+		for i := 0; i < random; i++ {
+			requests = append(requests, rng.Intn(cylinders))
+		}
+		fmt.Printf("Random request queue (seed %d): %s\n\n", seed, joinInts(requests, " "))
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("disksim: no requests given\n%s", usage)
+	}
+
+	results := make([]*disk.Result, 0, len(algorithms))
+	for _, alg := range algorithms {
+		result, err := disk.Simulate(requests, head, cylinders, dir, alg)
+		if err != nil {
+			return fmt.Errorf("disksim: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 1 || verbose {
+		for i, result := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			printDiskSchedule(result, len(requests))
+		}
+	}
+	if len(results) > 1 {
+		if verbose {
+			fmt.Println()
+		}
+		compareDiskSchedules(results, len(requests))
+	}
+	return nil
+}
+
+// printDiskSchedule prints the seek order, the head-movement chart and the
+// total movement of one algorithm
+func printDiskSchedule(result *disk.Result, requests int) {
+	fmt.Printf("%s, head at %d moving %s, cylinders 0-%d\n\n",
+		result.Algorithm.Title(), result.Start, result.Direction, result.Cylinders-1)
+	fmt.Println(disk.Chart(result, chartWidth))
+
+	path := []string{strconv.Itoa(result.Start)}
+	for _, m := range result.Moves {
+		path = append(path, strconv.Itoa(m.To))
+	}
+	fmt.Printf("\nSeek order: %s\n", joinInts(result.Order, " "))
+	fmt.Printf("Head path:  %s\n", strings.Join(path, " -> "))
+
+	movement := result.Movement()
+	fmt.Printf("Total head movement: %d cylinders", movement)
+	if returned := result.Returned(); returned > 0 {
+		fmt.Printf(" (%d on the return sweep)", returned)
+	}
+	fmt.Printf(", average seek %.2f\n", float64(movement)/float64(requests))
+}
+
+// compareDiskSchedules prints the head movement of several algorithms side
+// by side
+func compareDiskSchedules(results []*disk.Result, requests int) {
+	fmt.Printf("%-9s %9s %7s %9s  %s\n", "ALGORITHM", "MOVEMENT", "RETURN", "AVG SEEK", "SEEK ORDER")
+	best := results[0]
+	for _, result := range results {
+		order := joinInts(result.Order, " ")
+		if len(order) > chartWidth-40 {
+			order = order[:chartWidth-43] + "..."
+		}
+		fmt.Printf("%-9s %9d %7d %9.2f  %s\n", result.Algorithm, result.Movement(), result.Returned(),
+			float64(result.Movement())/float64(requests), order)
+		if result.Movement() < best.Movement() {
+			best = result
+		}
+	}
+	fmt.Printf("\nLeast head movement: %s\n", best.Algorithm.Title())
+}
+
+// joinInts formats numbers separated by sep
+func joinInts(values []int, sep string) string {
+	words := make([]string, len(values))
+	for i, v := range values {
+		words[i] = strconv.Itoa(v)
+	}
+	return strings.Join(words, sep)
+}
@@ -2,108 +2,1016 @@ package shell
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/Su5ubedi/advanced-shell/pkg/types"
 )
 
-// JobManager handles job control operations
+// jobEvent reports a state change observed by wait4 for a job's process
+type jobEvent struct {
+	pid    int
+	status syscall.WaitStatus
+	usage  syscall.Rusage
+	err    error
+}
+
+// JobManager handles job control operations. It is safe for concurrent use:
+// all job state is guarded by mu, and state changes reported by the per-process
+// watchers are applied by a single event loop goroutine. Methods hand out
+// copies of jobs so callers never read fields the loop may be writing.
 type JobManager struct {
-	jobs       map[int]*types.Job
-	jobCounter int
+	mu        sync.Mutex
+	jobs      map[int]*types.Job
+	order     []int              // job IDs, least recently used first
+	procs     map[int]*types.Job // live jobs by PID, including the foreground job
+	changed   chan struct{}      // closed and replaced whenever a job changes state
+	termModes map[int]*syscall.Termios
+
+	captureOutput bool                          // capture output of new background jobs
+	captures      map[*types.Job]*outputCapture // captured output of background jobs
+	keptLogs      []*outputCapture              // logs of jobs that left the table, oldest first
+
+	controls map[*types.Job]*jobControl  // timeout, retry and dependency policies
+	deps     map[*types.Job][]*types.Job // jobs waiting on the jobs they depend on
+	store    *jobStore                   // history of finished jobs, when enabled
+	rlimits  map[int]syscall.Rlimit      // resource limits set with ulimit
+	sched    *jobScheduler               // time-slices background jobs, when a policy is set
+
+	interrupt  chan struct{}
+	terminal   *terminal
+	events     chan jobEvent
+	foreground atomic.Pointer[types.Job]
 }
 
-// NewJobManager creates a new job manager
+// NewJobManager creates a new job manager and starts its event loop
 func NewJobManager() *JobManager {
-	return &JobManager{
-		jobs:       make(map[int]*types.Job),
-		jobCounter: 0,
+	jm := &JobManager{
+		jobs:      make(map[int]*types.Job),
+		procs:     make(map[int]*types.Job),
+		changed:   make(chan struct{}),
+		termModes: make(map[int]*syscall.Termios),
+		captures:  make(map[*types.Job]*outputCapture),
+		controls:  make(map[*types.Job]*jobControl),
+		deps:      make(map[*types.Job][]*types.Job),
+		rlimits:   make(map[int]syscall.Rlimit),
+		interrupt: make(chan struct{}, 1),
+		terminal:  newTerminal(),
+		events:    make(chan jobEvent, 64),
+	}
+	go jm.loop()
+	return jm
+}
+
+// JobOptions controls how StartJob launches a command
+type JobOptions struct {
+	Background bool
+
+	// Stdin, Stdout and Stderr replace the shell's own streams when set
+	Stdin  *os.File
+	Stdout *os.File
+	Stderr *os.File
+
+	// IgnoreHangup starts the command with SIGHUP ignored and keeps it
+	// running when the shell exits
+	IgnoreHangup bool
+
+	// Name overrides the command line shown in job listings
+	Name string
+
+	// Quiet skips announcing a new background job's ID and PID
+	Quiet bool
+
+	// Timeout limits how long each run of the command may take. Once it
+	// expires the job is sent TimeoutSignal (SIGTERM by default), followed
+	// by SIGKILL if it is still running KillAfter later.
+	Timeout       time.Duration
+	TimeoutSignal syscall.Signal
+	KillAfter     time.Duration
+
+	// Attempts is how many times a failing command is run in total, waiting
+	// Backoff before the first retry and twice as long before each next one
+	Attempts int
+	Backoff  time.Duration
+
+	// After lists the IDs of jobs that must finish successfully before the
+	// command is started. If any of them fails the job is cancelled.
+	After []int
+
+	// Schedule runs the command in the background at the times it gives
+	// rather than straight away
+	Schedule Schedule
+
+	// Limits caps what the command may consume, on top of the limits set
+	// with ulimit
+	Limits *types.JobLimits
+
+	// Nice is the niceness the command starts with
+	Nice int
+
+	// Queues names the message queues feeding the command's input or
+	// taking its output, for job listings
+	Queues []string
+}
+
+// StartJob launches an external command in its own process group. Foreground
+// jobs are given the terminal; background jobs are added to the job table.
+func (jm *JobManager) StartJob(args []string, opts JobOptions) (*types.Job, error) {
+	job, err := jm.startJob(args, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return snapshot(job), nil
+}
+
+// startJob launches a command and returns the live job record
+func (jm *JobManager) startJob(args []string, opts JobOptions) (*types.Job, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+
+	command := opts.Name
+	if command == "" {
+		command = strings.Join(args, " ")
+	}
+
+	job := &types.Job{
+		Command:    command,
+		Args:       args,
+		StartTime:  time.Now(),
+		Background: opts.Background,
+		NoHangup:   opts.IgnoreHangup,
+		Limits:     opts.Limits,
+		Nice:       opts.Nice,
+		Queues:     opts.Queues,
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if len(opts.After) > 0 {
+		if err := jm.deferLocked(job, opts); err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+	if opts.Schedule != nil {
+		if err := jm.scheduleLocked(job, opts); err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+
+	if opts.Timeout > 0 || opts.Attempts > 1 {
+		jm.controls[job] = &jobControl{opts: opts}
+	}
+	if err := jm.spawnLocked(job, opts); err != nil {
+		delete(jm.controls, job)
+		return nil, err
+	}
+
+	if opts.Background {
+		jm.addJob(job)
+		if !opts.Quiet {
+			fmt.Printf("[%d] %d\n", job.ID, job.PID)
+		}
+		jm.balanceLocked()
+	}
+	return job, nil
+}
+
+// spawnLocked starts a process for a new job, or the next attempt of a job
+// being retried. The caller must hold the lock.
+func (jm *JobManager) spawnLocked(job *types.Job, opts JobOptions) error {
+	argv := job.Args
+	if opts.IgnoreHangup {
+		// Ignored signals survive exec, so let a tiny sh wrapper set it up
+		argv = append([]string{"/bin/sh", "-c", `trap "" HUP; exec "$@"`, "nohup"}, job.Args...)
+	}
+
+	if limitArgs := jm.limitArgsLocked(opts.Limits); limitArgs != nil {
+		// The helper cannot report a missing command before it starts
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			return fmt.Errorf("%s: %v", job.Args[0], err)
+		}
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("%s: cannot apply resource limits: %v", job.Args[0], err)
+		}
+		helper := append([]string{self, LimitHelperArg}, limitArgs...)
+		argv = append(append(helper, "--"), argv...)
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = orFile(opts.Stdin, os.Stdin)
+	cmd.Stdout = orFile(opts.Stdout, os.Stdout)
+	cmd.Stderr = orFile(opts.Stderr, os.Stderr)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if !job.Background && jm.terminal != nil {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = jm.terminal.fd
+	}
+
+	// Keep background output off the terminal when capture is enabled
+	var capture *outputCapture
+	if job.Background && opts.Stdout == nil && opts.Stderr == nil && jm.captureOutput {
+		c, writer, err := newOutputCapture()
+		if err != nil {
+			return err
+		}
+		defer writer.Close()
+		cmd.Stdout = writer
+		cmd.Stderr = writer
+		capture = c
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %v", job.Args[0], err)
+	}
+
+	job.PID = cmd.Process.Pid
+	job.PGID = cmd.Process.Pid
+	if job.Nice != 0 {
+		// The whole group, since the job may have forked already
+		if err := syscall.Setpriority(syscall.PRIO_PGRP, job.PGID, job.Nice); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: cannot set niceness: %v\n", job.Args[0], err)
+		}
+	}
+	job.Cmd = cmd
+	job.Status = types.JobStatusRunning
+	job.NextRun = nil
+	job.OverLimit = ""
+
+	// Register the process before watching it so that an immediate exit
+	// cannot be reported for a job the loop does not know about yet
+	jm.procs[job.PID] = job
+	if capture != nil {
+		// A retried job keeps only the output of its latest attempt
+		if previous := jm.captures[job]; previous != nil {
+			previous.discard()
+		}
+		capture.pid = job.PID
+		capture.command = job.Command
+		job.LogFile = capture.path
+		jm.captures[job] = capture
+	}
+	if control := jm.controls[job]; control != nil {
+		jm.armLocked(job, control)
+	}
+
+	if opts.Limits != nil && opts.Limits.Memory > 0 && memoryRlimit < 0 {
+		go jm.watchMemory(job, job.PID, opts.Limits.Memory)
+	}
+
+	go jm.watch(job.PID)
+	return nil
+}
+
+// RunForeground starts a command in the foreground, waits for it to finish
+// or stop, and returns the job's final state
+func (jm *JobManager) RunForeground(args []string, opts JobOptions) (*types.Job, error) {
+	opts.Background = false
+	job, err := jm.startJob(args, opts)
+	if err != nil {
+		return nil, err
+	}
+	jm.waitForeground(job)
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return snapshot(job), nil
+}
+
+// orFile returns f, or fallback when f is nil
+func orFile(f, fallback *os.File) *os.File {
+	if f == nil {
+		return fallback
+	}
+	return f
+}
+
+// snapshot copies a job so it can be read without holding the lock
+func snapshot(job *types.Job) *types.Job {
+	copied := *job
+	copied.Args = append([]string(nil), job.Args...)
+	if job.EndTime != nil {
+		endTime := *job.EndTime
+		copied.EndTime = &endTime
+	}
+	if job.Usage != nil {
+		usage := *job.Usage
+		copied.Usage = &usage
+	}
+	if job.Deadline != nil {
+		deadline := *job.Deadline
+		copied.Deadline = &deadline
+	}
+	if job.NextRun != nil {
+		nextRun := *job.NextRun
+		copied.NextRun = &nextRun
+	}
+	copied.Attempts = append([]types.JobAttempt(nil), job.Attempts...)
+	copied.DependsOn = append([]int(nil), job.DependsOn...)
+	copied.Queues = append([]string(nil), job.Queues...)
+	return &copied
+}
+
+// watch waits on a job's process and forwards its state changes until it
+// exits. Stops and continues are reported as well so Ctrl-Z is noticed.
+func (jm *JobManager) watch(pid int) {
+	for {
+		var status syscall.WaitStatus
+		var usage syscall.Rusage
+		_, err := syscall.Wait4(pid, &status, syscall.WUNTRACED|wcontinued, &usage)
+		if err == syscall.EINTR {
+			continue
+		}
+		jm.events <- jobEvent{pid: pid, status: status, usage: usage, err: err}
+		if err != nil || status.Exited() || status.Signaled() {
+			return
+		}
+	}
+}
+
+// loop is the single owner of job state transitions: it applies every event
+// reported by the watchers and wakes up anyone waiting on a change
+func (jm *JobManager) loop() {
+	for ev := range jm.events {
+		jm.mu.Lock()
+		jm.applyEvent(ev)
+		jm.notifyLocked()
+		jm.mu.Unlock()
+	}
+}
+
+// notifyLocked settles jobs whose dependencies have finished and wakes
+// every waiter blocked in awaitChange
+func (jm *JobManager) notifyLocked() {
+	jm.settleDependenciesLocked()
+	jm.balanceLocked()
+	close(jm.changed)
+	jm.changed = make(chan struct{})
+}
+
+// awaitChange blocks until cond, evaluated with the lock held, returns true.
+// With interruptible set, Ctrl-C makes it give up with an error.
+func (jm *JobManager) awaitChange(interruptible bool, cond func() bool) error {
+	if interruptible {
+		jm.clearInterrupt()
+	}
+
+	for {
+		jm.mu.Lock()
+		if cond() {
+			jm.mu.Unlock()
+			return nil
+		}
+		changed := jm.changed
+		jm.mu.Unlock()
+
+		if !interruptible {
+			<-changed
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-jm.interrupt:
+			return fmt.Errorf("interrupted")
+		}
+	}
+}
+
+// waitForeground blocks until the foreground job finishes or is stopped,
+// then returns the terminal to the shell. A stopped job is kept in the job
+// table so that fg and bg can pick it up later.
+func (jm *JobManager) waitForeground(job *types.Job) {
+	jm.foreground.Store(job)
+	defer jm.foreground.Store(nil)
+
+	// A job waiting to be retried is still in the foreground
+	jm.awaitChange(false, func() bool {
+		return job.Status == types.JobStatusDone || job.Status == types.JobStatusStopped
+	})
+
+	modes := jm.terminal.reclaim()
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if job.Status == types.JobStatusStopped {
+		if job.ID == 0 {
+			jm.addJob(job)
+		}
+		jm.touchJob(job.ID)
+		jm.termModes[job.PGID] = modes
+		fmt.Printf("\n[%d]+  %-22s %s\n", job.ID, job.Status, job.Command)
+		return
+	}
+
+	if job.ID != 0 {
+		jm.removeJob(job.ID)
+	}
+	delete(jm.termModes, job.PGID)
+}
+
+// Interrupt wakes up a blocking wait built-in, as SIGINT does in bash
+func (jm *JobManager) Interrupt() {
+	select {
+	case jm.interrupt <- struct{}{}:
+	default:
+	}
+}
+
+// clearInterrupt discards an interrupt that arrived while nothing waited
+func (jm *JobManager) clearInterrupt() {
+	select {
+	case <-jm.interrupt:
+	default:
+	}
+}
+
+// WaitForJobs blocks until each of the given jobs has finished and returns
+// their final state. It returns early with an error when interrupted.
+func (jm *JobManager) WaitForJobs(jobs []*types.Job) ([]*types.Job, error) {
+	live := make([]*types.Job, 0, len(jobs))
+	jm.mu.Lock()
+	for _, job := range jobs {
+		if current, exists := jm.jobs[job.ID]; exists {
+			live = append(live, current)
+		}
+	}
+	jm.mu.Unlock()
+
+	err := jm.awaitChange(true, func() bool {
+		for _, job := range live {
+			if job.Status != types.JobStatusDone {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	finished := make([]*types.Job, 0, len(live))
+	for _, job := range live {
+		finished = append(finished, snapshot(job))
+	}
+	return finished, nil
+}
+
+// WaitForAny blocks until one of the given jobs has finished and returns its
+// final state. It returns early with an error when interrupted.
+func (jm *JobManager) WaitForAny(jobs []*types.Job) (*types.Job, error) {
+	live := make([]*types.Job, 0, len(jobs))
+	jm.mu.Lock()
+	for _, job := range jobs {
+		if current, exists := jm.jobs[job.ID]; exists {
+			live = append(live, current)
+		}
+	}
+	jm.mu.Unlock()
+	if len(live) == 0 {
+		return nil, fmt.Errorf("no such jobs")
+	}
+
+	var finished *types.Job
+	err := jm.awaitChange(true, func() bool {
+		for _, job := range live {
+			if job.Status == types.JobStatusDone {
+				finished = job
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return snapshot(finished), nil
 }
 
-// GetJob retrieves a job by ID
+// WaitForNext blocks until any running background job finishes and returns
+// that job
+func (jm *JobManager) WaitForNext() (*types.Job, error) {
+	var next *types.Job
+
+	err := jm.awaitChange(true, func() bool {
+		running := 0
+		for _, id := range jm.order {
+			job := jm.jobs[id]
+			if job.Status == types.JobStatusDone {
+				next = job
+				return true
+			}
+			if job.Status == types.JobStatusRunning || job.Status == types.JobStatusWaiting || job.Status == types.JobStatusReady {
+				running++
+			}
+		}
+		return running == 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		return nil, fmt.Errorf("no running jobs")
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return snapshot(next), nil
+}
+
+// Disown removes a job from the table so the shell no longer tracks it or
+// terminates it on exit
+func (jm *JobManager) Disown(jobID int) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if _, exists := jm.jobs[jobID]; !exists {
+		return fmt.Errorf("job %d not found", jobID)
+	}
+	jm.removeJob(jobID)
+	return nil
+}
+
+// SetNoHangup keeps a job running when the shell exits
+func (jm *JobManager) SetNoHangup(jobID int) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return fmt.Errorf("job %d not found", jobID)
+	}
+	job.NoHangup = true
+	return nil
+}
+
+// applyEvent records a wait4 result on the job it belongs to. The caller
+// must hold the lock.
+func (jm *JobManager) applyEvent(ev jobEvent) {
+	job := jm.procs[ev.pid]
+	if job == nil || job.Status == types.JobStatusDone {
+		return
+	}
+
+	switch {
+	case ev.err == nil && ev.status.Stopped():
+		job.Status = types.JobStatusStopped
+		if jm.pausedLocked(job) {
+			job.Status = types.JobStatusReady
+		}
+		return
+	case ev.err == nil && ev.status.Continued():
+		job.Status = types.JobStatusRunning
+		return
+	case ev.err != nil:
+		job.ExitCode = -1
+	case ev.status.Exited():
+		job.ExitCode = ev.status.ExitStatus()
+	case ev.status.Signaled():
+		job.Signal = ev.status.Signal()
+		job.ExitCode = 128 + int(job.Signal)
+	default:
+		return
+	}
+
+	if ev.err == nil {
+		job.Usage = &types.ResourceUsage{
+			UserTime:               time.Duration(ev.usage.Utime.Nano()),
+			SystemTime:             time.Duration(ev.usage.Stime.Nano()),
+			MaxRSS:                 int64(ev.usage.Maxrss) * maxRSSUnit,
+			VoluntaryCtxSwitches:   int64(ev.usage.Nvcsw),
+			InvoluntaryCtxSwitches: int64(ev.usage.Nivcsw),
+		}
+	}
+
+	checkLimitsLocked(job)
+
+	delete(jm.procs, ev.pid)
+	if jm.retryLocked(job) || jm.rescheduleLocked(job) {
+		return
+	}
+	jm.finishLocked(job)
+}
+
+// finishLocked marks a job as done. The caller must hold the lock.
+func (jm *JobManager) finishLocked(job *types.Job) {
+	job.Status = types.JobStatusDone
+	job.NextRun = nil
+	endTime := time.Now()
+	job.EndTime = &endTime
+	delete(jm.controls, job)
+	jm.recordLocked(job)
+}
+
+// addJob assigns the next job ID and adds the job to the table. As in bash,
+// the new ID is one more than the highest ID in use, so numbers are reused
+// once the jobs at the top of the table are gone. The caller must hold the
+// lock.
+func (jm *JobManager) addJob(job *types.Job) {
+	job.ID = 1
+	for id := range jm.jobs {
+		if id >= job.ID {
+			job.ID = id + 1
+		}
+	}
+	jm.jobs[job.ID] = job
+	jm.order = append(jm.order, job.ID)
+}
+
+// touchJob marks a job as the most recently used, making it the current job
+func (jm *JobManager) touchJob(jobID int) {
+	for i, id := range jm.order {
+		if id == jobID {
+			jm.order = append(jm.order[:i], jm.order[i+1:]...)
+			break
+		}
+	}
+	jm.order = append(jm.order, jobID)
+}
+
+// removeJob drops a job from the table along with its captured output
+func (jm *JobManager) removeJob(jobID int) {
+	if job := jm.jobs[jobID]; job != nil {
+		if capture := jm.captures[job]; capture != nil {
+			jm.keepLogLocked(job.ID, capture)
+			delete(jm.captures, job)
+		}
+	}
+	delete(jm.jobs, jobID)
+	for i, id := range jm.order {
+		if id == jobID {
+			jm.order = append(jm.order[:i], jm.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// SignalForeground delivers sig to the foreground job's process group. It
+// reports whether a foreground job was there to receive it.
+func (jm *JobManager) SignalForeground(sig syscall.Signal) bool {
+	job := jm.foreground.Load()
+	if job == nil {
+		return false
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	// Interrupting a job also gives up on any retries it has left
+	if sig == syscall.SIGINT || sig == syscall.SIGQUIT {
+		if job.Status == types.JobStatusWaiting {
+			jm.cancelLocked(job, sig)
+			return true
+		}
+		if control := jm.controls[job]; control != nil {
+			control.cancelled = true
+		}
+	}
+	if job.Status != types.JobStatusWaiting {
+		_ = syscall.Kill(-job.PGID, sig)
+	}
+	return true
+}
+
+// NotifyCompletedJobs reports jobs that finished since the last prompt and
+// removes them from the table
+func (jm *JobManager) NotifyCompletedJobs() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	for _, id := range append([]int(nil), jm.order...) {
+		job := jm.jobs[id]
+		if job.Status == types.JobStatusDone {
+			jm.reapLocked(job)
+		}
+	}
+}
+
+// GetJob retrieves a copy of a job by ID
 func (jm *JobManager) GetJob(jobID int) (*types.Job, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
 	job, exists := jm.jobs[jobID]
 	if !exists {
 		return nil, fmt.Errorf("job %d not found", jobID)
 	}
-	return job, nil
+	return snapshot(job), nil
 }
 
-// GetAllJobs returns all jobs
+// GetAllJobs returns copies of all jobs
 func (jm *JobManager) GetAllJobs() []*types.Job {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
 	jobs := make([]*types.Job, 0, len(jm.jobs))
 	for _, job := range jm.jobs {
-		jobs = append(jobs, job)
+		jobs = append(jobs, snapshot(job))
 	}
 	return jobs
 }
 
-// ListJobs lists all jobs with their status
-func (jm *JobManager) ListJobs() {
-	if len(jm.jobs) == 0 {
+// JobListOptions selects which jobs ListJobs prints and how
+type JobListOptions struct {
+	Long        bool     // include PIDs and exit codes
+	Verbose     bool     // include resource usage of finished jobs
+	PIDsOnly    bool     // print only process group leader PIDs
+	RunningOnly bool     // restrict to running jobs
+	StoppedOnly bool     // restrict to stopped jobs
+	Graph       bool     // show jobs as a dependency tree
+	Specs       []string // restrict to these job specs
+}
+
+// ListJobs lists jobs sorted by ID, marking the current job with + and the
+// previous job with -. Finished jobs are shown once and then removed.
+func (jm *JobManager) ListJobs(opts JobListOptions) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	var jobs []*types.Job
+	if len(opts.Specs) > 0 {
+		for _, spec := range opts.Specs {
+			job, err := jm.resolveLocked(spec)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+	} else {
+		for _, job := range jm.jobs {
+			jobs = append(jobs, job)
+		}
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	}
+
+	if len(jobs) == 0 && !opts.PIDsOnly {
 		fmt.Println("No active jobs")
-		return
+		return nil
 	}
 
-	fmt.Println("Active jobs:")
-	for _, job := range jm.jobs {
-		duration := time.Since(job.StartTime)
-		if job.EndTime != nil {
-			duration = job.EndTime.Sub(job.StartTime)
+	current, previous := jm.currentAndPrevious()
+	marker := func(job *types.Job) string {
+		switch job {
+		case current:
+			return "+"
+		case previous:
+			return "-"
+		}
+		return " "
+	}
+
+	if opts.Graph {
+		jm.printGraphLocked(jobs, marker)
+		jobs = nil
+	}
+
+	var reported []*types.Job
+	for _, job := range jobs {
+		if opts.RunningOnly && job.Status != types.JobStatusRunning && job.Status != types.JobStatusReady {
+			continue
+		}
+		if opts.StoppedOnly && job.Status != types.JobStatusStopped {
+			continue
+		}
+
+		if opts.PIDsOnly {
+			if job.PID != 0 {
+				fmt.Println(job.PID)
+			}
+			continue
 		}
 
-		fmt.Printf("[%d] %s %s (PID: %d, Duration: %v)\n",
-			job.ID, job.Status, job.Command, job.PID, duration.Round(time.Second))
+		command := jm.describeLocked(job, opts.Long || opts.Verbose)
+		if opts.Verbose {
+			fmt.Printf("[%d]%s %-7d %-22s %s\n", job.ID, marker(job), job.PID, jm.stateLocked(job, true), command)
+			fmt.Printf("      %s\n", usageText(job))
+			for i, attempt := range job.Attempts {
+				fmt.Printf("      attempt %d: pid %d, %s after %s\n", i+1, attempt.PID,
+					outcomeText(attempt.ExitCode, attempt.Signal, attempt.TimedOut, true),
+					formatSeconds(attempt.EndTime.Sub(attempt.StartTime), 3))
+			}
+		} else if opts.Long {
+			duration := time.Since(job.StartTime)
+			if job.EndTime != nil {
+				duration = job.EndTime.Sub(job.StartTime)
+			}
+			fmt.Printf("[%d]%s %-7d %-22s %s (%v)\n",
+				job.ID, marker(job), job.PID, jm.stateLocked(job, true), command, duration.Round(time.Second))
+		} else {
+			fmt.Printf("[%d]%s  %-22s %s\n", job.ID, marker(job), jm.stateLocked(job, false), command)
+		}
+		reported = append(reported, job)
+	}
+
+	// Like bash, finished jobs are reported once and then forgotten. Those
+	// filtered out or shown only by PID have not been reported yet.
+	for _, job := range reported {
+		if job.Status == types.JobStatusDone {
+			jm.removeJob(job.ID)
+		}
+	}
+	return nil
+}
+
+// describeLocked returns a job's command line annotated with what the job
+// is doing or waiting for. The caller must hold the lock.
+func (jm *JobManager) describeLocked(job *types.Job, long bool) string {
+	command := job.Command
+	if job.Background && (job.Status == types.JobStatusRunning || job.Status == types.JobStatusReady) {
+		command += " &"
+	}
+	if job.Reattached {
+		command += "  (reattached)"
+	}
+	if capture := jm.captures[job]; capture != nil {
+		command += fmt.Sprintf("  (%s output)", formatBytes(capture.Bytes()))
+	}
+	if job.Schedule != "" {
+		note := job.Schedule
+		if n := len(job.Attempts); n > 0 {
+			last := job.Attempts[n-1]
+			note += ", last run " + outcomeText(last.ExitCode, last.Signal, last.TimedOut, false)
+		}
+		command += "  (" + note + ")"
+	} else if len(job.Attempts) > 0 && job.Status != types.JobStatusDone {
+		command += fmt.Sprintf("  (attempt %d)", len(job.Attempts)+1)
+	}
+	if jm.deps[job] != nil {
+		command += fmt.Sprintf("  (after %s)", dependencyList(job))
+	}
+	if job.NextRun != nil {
+		layout := "15:04:05"
+		if job.NextRun.YearDay() != time.Now().YearDay() {
+			layout = "Jan 2 15:04:05"
+		}
+		command += fmt.Sprintf("  (next run %s)", job.NextRun.Format(layout))
+	} else if job.Deadline != nil && long {
+		command += fmt.Sprintf("  (times out %s)", job.Deadline.Format("15:04:05"))
+	}
+	if job.Nice != 0 {
+		command += fmt.Sprintf("  (nice %d)", job.Nice)
+	}
+	if job.Limits != nil && long {
+		command += "  (limits: " + limitsText(job.Limits) + ")"
+	}
+	if len(job.Queues) > 0 {
+		command += "  (mq " + strings.Join(job.Queues, " ") + ")"
 	}
+	return command
+}
+
+// statusText describes a job's state, including its exit code or signal once
+// done. The long form spells out a successful exit code too.
+func statusText(job *types.Job, long bool) string {
+	if job.Status != types.JobStatusDone {
+		return string(job.Status)
+	}
+	if job.Cancelled != "" {
+		if long {
+			return "Cancelled (" + job.Cancelled + ")"
+		}
+		return "Cancelled"
+	}
+	if job.OverLimit != "" {
+		if long {
+			return "Over limit (" + job.OverLimit + ")"
+		}
+		return "Over limit"
+	}
+	return outcomeText(job.ExitCode, job.Signal, job.TimedOut, long)
+}
+
+// outcomeText describes how a process ended
+func outcomeText(exitCode int, sig syscall.Signal, timedOut, long bool) string {
+	if timedOut {
+		return "Timed out"
+	}
+	if sig != 0 {
+		// syscall names signals like strsignal(3): "terminated", "killed"
+		description := sig.String()
+		return strings.ToUpper(description[:1]) + description[1:]
+	}
+	if exitCode < 0 {
+		return "Done (status unknown)"
+	}
+	if exitCode != 0 {
+		return fmt.Sprintf("Exit %d", exitCode)
+	}
+	if long {
+		return "Done (exit 0)"
+	}
+	return string(types.JobStatusDone)
+}
+
+// usageText summarises the resources a finished job used
+func usageText(job *types.Job) string {
+	duration := time.Since(job.StartTime)
+	if job.EndTime != nil {
+		duration = job.EndTime.Sub(job.StartTime)
+	}
+
+	if job.Usage == nil {
+		return fmt.Sprintf("real %s  (resource usage available once the job finishes)", formatSeconds(duration, 3))
+	}
+
+	usage := job.Usage
+	return fmt.Sprintf("real %s  user %s  sys %s  maxrss %s  ctxsw %d vol / %d invol",
+		formatSeconds(duration, 3), formatSeconds(usage.UserTime, 3), formatSeconds(usage.SystemTime, 3),
+		formatBytes(usage.MaxRSS), usage.VoluntaryCtxSwitches, usage.InvoluntaryCtxSwitches)
 }
 
 // BringToForeground brings a background job to the foreground
 func (jm *JobManager) BringToForeground(jobID int) error {
-	job, err := jm.GetJob(jobID)
-	if err != nil {
-		return err
+	jm.mu.Lock()
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		jm.mu.Unlock()
+		return fmt.Errorf("job %d not found", jobID)
 	}
 
 	if job.Status == types.JobStatusDone {
+		jm.mu.Unlock()
 		return fmt.Errorf("job %d has already completed", jobID)
 	}
 
+	// Only a process's parent can wait for it, so an earlier session's job
+	// cannot be run in the foreground
+	if job.Reattached {
+		jm.mu.Unlock()
+		return fmt.Errorf("job %d was started by an earlier session and can only run in the background", jobID)
+	}
+	if job.Schedule != "" {
+		jm.mu.Unlock()
+		return fmt.Errorf("job %d is scheduled and runs in the background", jobID)
+	}
+
 	fmt.Printf("Bringing job [%d] to foreground: %s\n", job.ID, job.Command)
+	if jm.captures[job] != nil {
+		fmt.Printf("Output of this job is captured; view it with 'joblog %%%d'\n", job.ID)
+	}
 
-	// Send SIGCONT to resume the process if it's stopped
-	if job.Cmd != nil && job.Cmd.Process != nil {
-		if job.Status == types.JobStatusStopped {
-			if err := job.Cmd.Process.Signal(syscall.SIGCONT); err != nil {
+	// A job waiting to be retried has no process yet; the next attempt takes
+	// the terminal when it is launched
+	if job.Status != types.JobStatusWaiting {
+		if err := jm.terminal.give(job.PGID); err != nil {
+			jm.mu.Unlock()
+			return fmt.Errorf("failed to give terminal to job: %v", err)
+		}
+		jm.terminal.restore(jm.termModes[job.PGID])
+
+		// Send SIGCONT to resume the process group if it's stopped
+		jm.releaseLocked(job)
+		if job.Status == types.JobStatusStopped || job.Status == types.JobStatusReady {
+			if err := syscall.Kill(-job.PGID, syscall.SIGCONT); err != nil {
+				jm.mu.Unlock()
+				jm.terminal.reclaim()
 				return fmt.Errorf("failed to resume job: %v", err)
 			}
 		}
-
 		job.Status = types.JobStatusRunning
-		job.Background = false
+	}
 
-		// Wait for the job to complete in foreground
-		err := job.Cmd.Wait()
-		if err != nil {
-			fmt.Printf("Job [%d] exited with error: %v\n", job.ID, err)
-		}
+	job.Background = false
+	jm.touchJob(job.ID)
+	jm.mu.Unlock()
 
-		job.Status = types.JobStatusDone
-		endTime := time.Now()
-		job.EndTime = &endTime
-	}
+	jm.waitForeground(job)
 
-	// Remove from jobs list since it's completed
-	delete(jm.jobs, jobID)
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if job.Status == types.JobStatusDone && job.ExitCode != 0 {
+		fmt.Printf("Job [%d] exited with status %d\n", job.ID, job.ExitCode)
+	}
 	return nil
 }
 
 // ResumeInBackground resumes a stopped job in the background
 func (jm *JobManager) ResumeInBackground(jobID int) error {
-	job, err := jm.GetJob(jobID)
-	if err != nil {
-		return err
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return fmt.Errorf("job %d not found", jobID)
 	}
 
 	if job.Status == types.JobStatusDone {
@@ -116,24 +1024,91 @@ func (jm *JobManager) ResumeInBackground(jobID int) error {
 
 	fmt.Printf("Resuming job [%d] in background: %s\n", job.ID, job.Command)
 
-	// Send SIGCONT to resume the process
-	if job.Cmd != nil && job.Cmd.Process != nil {
-		if err := job.Cmd.Process.Signal(syscall.SIGCONT); err != nil {
-			return fmt.Errorf("failed to resume job: %v", err)
+	// Send SIGCONT to resume the process group
+	if err := syscall.Kill(-job.PGID, syscall.SIGCONT); err != nil {
+		return fmt.Errorf("failed to resume job: %v", err)
+	}
+
+	job.Status = types.JobStatusRunning
+	job.Background = true
+	jm.touchJob(job.ID)
+	jm.balanceLocked()
+
+	return nil
+}
+
+// SignalJob sends a signal to every process in a job's process group. The
+// job's status is updated from the resulting wait4 events; continuing a job
+// marks it running straight away.
+func (jm *JobManager) SignalJob(jobID int, sig syscall.Signal) error {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return jm.signalLocked(jobID, sig)
+}
+
+// signalLocked implements SignalJob. The caller must hold the lock.
+func (jm *JobManager) signalLocked(jobID int, sig syscall.Signal) error {
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return fmt.Errorf("job %d not found", jobID)
+	}
+
+	if job.Status == types.JobStatusDone {
+		return fmt.Errorf("job %d has already completed", jobID)
+	}
+
+	// A waiting job has no process yet, so all a signal can do is cancel it
+	if job.Status == types.JobStatusWaiting {
+		switch {
+		case sig == 0:
+		case isTerminating(sig):
+			jm.cancelLocked(job, sig)
+		default:
+			return fmt.Errorf("job %d is waiting to run", jobID)
 		}
+		return nil
+	}
 
-		job.Status = types.JobStatusRunning
-		job.Background = true
+	if control := jm.controls[job]; control != nil && isTerminating(sig) {
+		control.cancelled = true
+	}
+
+	if err := syscall.Kill(-job.PGID, sig); err != nil {
+		return fmt.Errorf("failed to signal job %d: %v", jobID, err)
+	}
+
+	// The user decides from now on whether a job the scheduler stopped runs
+	switch sig {
+	case syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU:
+		if jm.pausedLocked(job) {
+			// Already stopped, so no event will say so
+			jm.releaseLocked(job)
+			job.Status = types.JobStatusStopped
+		}
+	case syscall.SIGCONT:
+		jm.releaseLocked(job)
+	}
+
+	// A stopped job cannot act on a terminating signal until it is continued
+	stopped := job.Status == types.JobStatusStopped || job.Status == types.JobStatusReady
+	if stopped && (sig == syscall.SIGTERM || sig == syscall.SIGHUP) {
+		_ = syscall.Kill(-job.PGID, syscall.SIGCONT)
 	}
 
+	if sig == syscall.SIGCONT {
+		job.Status = types.JobStatusRunning
+	}
 	return nil
 }
 
-// KillJob kills a job by sending SIGTERM
+// KillJob terminates a job by sending SIGTERM to its process group
 func (jm *JobManager) KillJob(jobID int) error {
-	job, err := jm.GetJob(jobID)
-	if err != nil {
-		return err
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return fmt.Errorf("job %d not found", jobID)
 	}
 
 	if job.Status == types.JobStatusDone {
@@ -141,25 +1116,56 @@ func (jm *JobManager) KillJob(jobID int) error {
 	}
 
 	fmt.Printf("Terminating job [%d]: %s\n", job.ID, job.Command)
+	return jm.signalLocked(jobID, syscall.SIGTERM)
+}
+
+// AwaitSignalled waits until each job has left the status it had before it
+// was signalled, or has gone from the table, giving up after timeout since a
+// job may ignore the signal
+func (jm *JobManager) AwaitSignalled(before map[int]types.JobStatus, timeout time.Duration) {
+	if len(before) == 0 {
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
-	if job.Cmd != nil && job.Cmd.Process != nil {
-		if err := job.Cmd.Process.Kill(); err != nil {
-			return fmt.Errorf("failed to kill job: %v", err)
+	for {
+		jm.mu.Lock()
+		settled := true
+		for id, status := range before {
+			if job, exists := jm.jobs[id]; exists && job.Status == status {
+				settled = false
+				break
+			}
 		}
+		changed := jm.changed
+		jm.mu.Unlock()
 
-		job.Status = types.JobStatusDone
-		endTime := time.Now()
-		job.EndTime = &endTime
+		if settled {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		}
 	}
-
-	return nil
 }
 
-// CleanupCompletedJobs removes completed jobs from the manager
-func (jm *JobManager) CleanupCompletedJobs() {
-	for id, job := range jm.jobs {
-		if job.Status == types.JobStatusDone {
-			delete(jm.jobs, id)
-		}
+// ReapJob removes a finished job from the table and reports its status. A
+// job that is not done is left alone: job IDs are reused, so it may be a new
+// job that took the ID of the one the caller saw finish.
+func (jm *JobManager) ReapJob(jobID int) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if job, exists := jm.jobs[jobID]; exists && job.Status == types.JobStatusDone {
+		jm.reapLocked(job)
 	}
 }
+
+// reapLocked implements ReapJob. The caller must hold the lock.
+func (jm *JobManager) reapLocked(job *types.Job) {
+	fmt.Printf("[%d]  %-22s %s\n", job.ID, statusText(job, false), job.Command)
+	jm.removeJob(job.ID)
+}
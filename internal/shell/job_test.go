@@ -0,0 +1,171 @@
+package shell
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// TestJobManagerConcurrency starts, kills, lists and waits for jobs from
+// several goroutines at once. Run it with -race.
+func TestJobManagerConcurrency(t *testing.T) {
+	jm := NewJobManager()
+	commands := [][]string{{"sleep", "0.01"}, {"true"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var started []*types.Job
+			for n := 0; n < 5; n++ {
+				job, err := jm.StartJob(commands[(i+n)%len(commands)], JobOptions{Background: true, Quiet: true})
+				if err != nil {
+					t.Errorf("StartJob: %v", err)
+					return
+				}
+				started = append(started, job)
+			}
+
+			// Killing a job that has already finished is allowed to fail
+			if i%2 == 0 {
+				_ = jm.KillJob(started[0].ID)
+			}
+
+			if _, err := jm.WaitForJobs(started); err != nil {
+				t.Errorf("WaitForJobs: %v", err)
+				return
+			}
+			for _, job := range started {
+				jm.ReapJob(job.ID)
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				for _, job := range jm.GetAllJobs() {
+					_ = job.Status
+				}
+				if err := jm.ListJobs(JobListOptions{Long: true}); err != nil {
+					t.Errorf("ListJobs: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, job := range jm.GetAllJobs() {
+		if job.Status != types.JobStatusDone {
+			t.Errorf("job [%d] %s left %s", job.ID, job.Command, job.Status)
+		}
+	}
+}
+
+// TestWaitForJobsFinished checks that waited-for jobs come back done with
+// their exit codes
+func TestWaitForJobsFinished(t *testing.T) {
+	jm := NewJobManager()
+	tests := []struct {
+		args []string
+		exit int
+	}{
+		{[]string{"true"}, 0},
+		{[]string{"false"}, 1},
+		{[]string{"sh", "-c", "exit 3"}, 3},
+	}
+
+	var jobs []*types.Job
+	for _, tt := range tests {
+		job, err := jm.StartJob(tt.args, JobOptions{Background: true, Quiet: true})
+		if err != nil {
+			t.Fatalf("StartJob %v: %v", tt.args, err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	finished, err := jm.WaitForJobs(jobs)
+	if err != nil {
+		t.Fatalf("WaitForJobs: %v", err)
+	}
+	if len(finished) != len(tests) {
+		t.Fatalf("WaitForJobs returned %d jobs, want %d", len(finished), len(tests))
+	}
+	for i, job := range finished {
+		if job.Status != types.JobStatusDone || job.ExitCode != tests[i].exit {
+			t.Errorf("%v: status %s exit %d, want Done exit %d", tests[i].args, job.Status, job.ExitCode, tests[i].exit)
+		}
+	}
+}
+
+// TestReapJobLeavesLiveJobs checks that a stale reap cannot remove a job
+// that is still running under a reused ID
+func TestReapJobLeavesLiveJobs(t *testing.T) {
+	jm := NewJobManager()
+	job, err := jm.StartJob([]string{"sleep", "5"}, JobOptions{Background: true, Quiet: true})
+	if err != nil {
+		t.Fatalf("StartJob: %v", err)
+	}
+
+	jm.ReapJob(job.ID)
+	if _, err := jm.GetJob(job.ID); err != nil {
+		t.Errorf("running job was reaped: %v", err)
+	}
+
+	if err := jm.KillJob(job.ID); err != nil {
+		t.Fatalf("KillJob: %v", err)
+	}
+	if _, err := jm.WaitForJobs([]*types.Job{job}); err != nil {
+		t.Fatalf("WaitForJobs: %v", err)
+	}
+	jm.ReapJob(job.ID)
+	if _, err := jm.GetJob(job.ID); err == nil {
+		t.Error("finished job was not reaped")
+	}
+}
+
+// TestKeptJobLogs checks that captured output outlives the job's entry in
+// the table, up to maxKeptLogs logs
+func TestKeptJobLogs(t *testing.T) {
+	jm := NewJobManager()
+	jm.SetCapture(true)
+	defer jm.ClearJobLogs(true)
+
+	var first *types.Job
+	for i := 0; i <= maxKeptLogs; i++ {
+		job, err := jm.StartJob([]string{"echo", "hello"}, JobOptions{Background: true, Quiet: true})
+		if err != nil {
+			t.Fatalf("StartJob: %v", err)
+		}
+		if _, err := jm.WaitForJobs([]*types.Job{job}); err != nil {
+			t.Fatalf("WaitForJobs: %v", err)
+		}
+		capture, err := jm.JobLog(job.ID)
+		if err != nil {
+			t.Fatalf("JobLog: %v", err)
+		}
+		<-capture.done
+		jm.ReapJob(job.ID)
+
+		kept, err := jm.KeptJobLog(0, job.PID)
+		if err != nil {
+			t.Fatalf("log of a reaped job: %v", err)
+		}
+		if got := kept.Tail(0); got != "hello\n" {
+			t.Errorf("kept log %q, want hello", got)
+		}
+		if first == nil {
+			first = job
+		}
+	}
+
+	if _, err := jm.KeptJobLog(0, first.PID); err == nil {
+		t.Errorf("more than %d logs kept", maxKeptLogs)
+	}
+	if n := jm.ClearJobLogs(false); n != maxKeptLogs {
+		t.Errorf("cleared %d logs, want %d", n, maxKeptLogs)
+	}
+}
@@ -0,0 +1,136 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// IsJobSpec reports whether an argument refers to a job rather than a PID
+func IsJobSpec(arg string) bool {
+	return strings.HasPrefix(arg, "%")
+}
+
+// ResolveJobSpec looks up a job using bash-style job specifications:
+//
+//	%n        job number n (a bare n is accepted too)
+//	%%, %+, % the current job
+//	%-        the previous job
+//	%name     the job whose command starts with name
+//	%?text    the job whose command contains text
+//
+// The returned job is a copy.
+func (jm *JobManager) ResolveJobSpec(spec string) (*types.Job, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, err := jm.resolveLocked(spec)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot(job), nil
+}
+
+// resolveLocked implements ResolveJobSpec. The caller must hold the lock.
+func (jm *JobManager) resolveLocked(spec string) (*types.Job, error) {
+	if spec == "" {
+		return nil, fmt.Errorf("empty job spec")
+	}
+
+	if !IsJobSpec(spec) {
+		id, err := strconv.Atoi(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid job spec", spec)
+		}
+		return jm.jobByNumber(spec, id)
+	}
+
+	body := spec[1:]
+	switch {
+	case body == "" || body == "%" || body == "+":
+		current, _ := jm.currentAndPrevious()
+		if current == nil {
+			return nil, fmt.Errorf("%s: no current job", spec)
+		}
+		return current, nil
+	case body == "-":
+		_, previous := jm.currentAndPrevious()
+		if previous == nil {
+			return nil, fmt.Errorf("%s: no previous job", spec)
+		}
+		return previous, nil
+	case strings.HasPrefix(body, "?"):
+		text := body[1:]
+		return jm.matchJob(spec, func(job *types.Job) bool {
+			return strings.Contains(job.Command, text)
+		})
+	}
+
+	if id, err := strconv.Atoi(body); err == nil {
+		return jm.jobByNumber(spec, id)
+	}
+
+	return jm.matchJob(spec, func(job *types.Job) bool {
+		return strings.HasPrefix(job.Command, body)
+	})
+}
+
+// jobByNumber returns the job with the given ID
+func (jm *JobManager) jobByNumber(spec string, id int) (*types.Job, error) {
+	job, exists := jm.jobs[id]
+	if !exists {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return job, nil
+}
+
+// matchJob returns the single job accepted by match, failing when no job or
+// more than one job matches
+func (jm *JobManager) matchJob(spec string, match func(*types.Job) bool) (*types.Job, error) {
+	var found *types.Job
+	for _, id := range jm.order {
+		job := jm.jobs[id]
+		if !match(job) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+		}
+		found = job
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return found, nil
+}
+
+// currentAndPrevious returns the jobs that %+ and %- refer to. As in bash,
+// the most recently stopped job is preferred; otherwise the most recently
+// started or backgrounded job is current.
+func (jm *JobManager) currentAndPrevious() (*types.Job, *types.Job) {
+	var current, previous *types.Job
+
+	pick := func(stoppedOnly bool) {
+		for i := len(jm.order) - 1; i >= 0; i-- {
+			job := jm.jobs[jm.order[i]]
+			if stoppedOnly && job.Status != types.JobStatusStopped {
+				continue
+			}
+			if job == current || job == previous {
+				continue
+			}
+			if current == nil {
+				current = job
+			} else if previous == nil {
+				previous = job
+			}
+		}
+	}
+
+	pick(true)
+	pick(false)
+	return current, previous
+}
@@ -0,0 +1,475 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// rlimInfinity is RLIM_INFINITY
+const rlimInfinity = ^uint64(0)
+
+// LimitHelperArg makes the shell binary act as a wrapper that sets resource
+// limits and then executes a command. Limits cannot be set between fork and
+// exec from Go, and setting them on a running child would race with it.
+const LimitHelperArg = "--exec-with-limits"
+
+// clockTicks is the unit of the CPU times in /proc (USER_HZ)
+const clockTicks = 100
+
+// memoryPollInterval is how often the memory of a job with a memory limit
+// is checked
+const memoryPollInterval = 100 * time.Millisecond
+
+// ulimitResource is a resource the ulimit built-in manages
+type ulimitResource struct {
+	flag     byte
+	resource int
+	unit     uint64 // bytes per unit ulimit counts in
+	name     string
+}
+
+// ulimitResources are listed in the order 'ulimit -a' prints them. The
+// memory limits come last and depend on the system.
+var ulimitResources = append([]ulimitResource{
+	{'f', syscall.RLIMIT_FSIZE, 1024, "file size (kbytes)"},
+	{'n', syscall.RLIMIT_NOFILE, 1, "open files"},
+	{'t', syscall.RLIMIT_CPU, 1, "cpu time (seconds)"},
+	{'u', rlimitNproc, 1, "max user processes"},
+}, memoryUlimits...)
+
+// Rlimit returns the limit set with ulimit for a resource, or the shell's own
+// limit when there is none
+func (jm *JobManager) Rlimit(resource int) (syscall.Rlimit, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if limit, ok := jm.rlimits[resource]; ok {
+		return limit, nil
+	}
+	var limit syscall.Rlimit
+	err := syscall.Getrlimit(resource, &limit)
+	return limit, err
+}
+
+// SetRlimit sets the limit of a resource for commands started from now on.
+// The shell itself is not limited, so a low CPU or memory limit cannot take
+// it down.
+func (jm *JobManager) SetRlimit(resource int, limit syscall.Rlimit) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.rlimits[resource] = limit
+}
+
+// limitArgsLocked returns the arguments that make the limit helper set the
+// limits from ulimit and those of a job, or nil when there are none. The
+// caller must hold the lock.
+func (jm *JobManager) limitArgsLocked(limits *types.JobLimits) []string {
+	rlimits := make(map[int]syscall.Rlimit, len(jm.rlimits)+3)
+	for resource, limit := range jm.rlimits {
+		rlimits[resource] = limit
+	}
+
+	if limits != nil {
+		tighten := func(resource int, soft, hard uint64) {
+			limit, ok := rlimits[resource]
+			if !ok {
+				if err := syscall.Getrlimit(resource, &limit); err != nil {
+					return
+				}
+			}
+			max := min(rlimValue(limit.Max), hard)
+			setRlimValue(&limit.Max, max)
+			setRlimValue(&limit.Cur, min(rlimValue(limit.Cur), soft, max))
+			rlimits[resource] = limit
+		}
+		if limits.CPU > 0 {
+			// SIGXCPU at the limit, and SIGKILL a second later for a
+			// program that ignores it
+			seconds := uint64((limits.CPU + time.Second - 1) / time.Second)
+			tighten(syscall.RLIMIT_CPU, seconds, seconds+1)
+		}
+		if limits.FileSize > 0 {
+			tighten(syscall.RLIMIT_FSIZE, uint64(limits.FileSize), rlimInfinity)
+		}
+		if limits.OpenFiles > 0 {
+			tighten(syscall.RLIMIT_NOFILE, uint64(limits.OpenFiles), rlimInfinity)
+		}
+		if limits.Memory > 0 && memoryRlimit >= 0 {
+			tighten(memoryRlimit, uint64(limits.Memory), rlimInfinity)
+		}
+	}
+
+	resources := make([]int, 0, len(rlimits))
+	for resource := range rlimits {
+		resources = append(resources, resource)
+	}
+	// Memory limits last, so the helper cannot run out of memory while it
+	// sets the others, and otherwise in resource order
+	isMemory := func(resource int) bool {
+		for _, r := range memoryUlimits {
+			if r.resource == resource {
+				return true
+			}
+		}
+		return resource == memoryRlimit
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if mi, mj := isMemory(resources[i]), isMemory(resources[j]); mi != mj {
+			return mj
+		}
+		return resources[i] < resources[j]
+	})
+
+	var args []string
+	for _, resource := range resources {
+		limit := rlimits[resource]
+		args = append(args, fmt.Sprintf("%d=%d:%d", resource, limit.Cur, limit.Max))
+	}
+	return args
+}
+
+// RunLimitHelper sets the resource limits given as resource=soft:hard
+// arguments and executes the command that follows "--". It only returns
+// by exiting.
+func RunLimitHelper(args []string) {
+	fail := func(status int, format string, a ...any) {
+		fmt.Fprintf(os.Stderr, format+"\n", a...)
+		os.Exit(status)
+	}
+
+	for len(args) > 0 && args[0] != "--" {
+		var resource int
+		var limit syscall.Rlimit
+		if _, err := fmt.Sscanf(args[0], "%d=%d:%d", &resource, &limit.Cur, &limit.Max); err != nil {
+			fail(126, "limit: %s: invalid resource limit", args[0])
+		}
+		if err := syscall.Setrlimit(resource, &limit); err != nil {
+			fail(126, "limit: setting resource limit %s: %v", args[0], err)
+		}
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		fail(126, "limit: missing command")
+	}
+
+	path, err := exec.LookPath(args[1])
+	if err != nil {
+		fail(127, "%s: %v", args[1], err)
+	}
+	err = syscall.Exec(path, args[1:], os.Environ())
+	fail(126, "%s: %v", args[1], err)
+}
+
+// watchMemory kills a job whose processes together use more resident
+// memory than its limit. It reads /proc, so it is only used where
+// memoryRlimit is -1.
+func (jm *JobManager) watchMemory(job *types.Job, pid int, limit int64) {
+	ticker := time.NewTicker(memoryPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rss, _ := groupUsage(pid)
+
+		jm.mu.Lock()
+		if jm.procs[pid] != job {
+			jm.mu.Unlock()
+			return
+		}
+		if rss > limit {
+			job.OverLimit = "memory " + formatBytes(limit)
+			_ = syscall.Kill(-job.PGID, syscall.SIGKILL)
+			jm.mu.Unlock()
+			return
+		}
+		jm.mu.Unlock()
+	}
+}
+
+// groupUsage adds up the resident memory and CPU time of the processes in a
+// process group
+func groupUsage(pgid int) (rss int64, cpu time.Duration) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, 0
+	}
+
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		data, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces, so count fields from the
+		// closing parenthesis: pgrp is the third, utime and stime the
+		// twelfth and thirteenth, rss the twenty-second
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+		if len(fields) < 22 || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+		if pages, err := strconv.ParseInt(fields[21], 10, 64); err == nil {
+			rss += pages * int64(os.Getpagesize())
+		}
+		for _, field := range fields[11:13] {
+			if ticks, err := strconv.ParseInt(field, 10, 64); err == nil {
+				cpu += time.Duration(ticks) * time.Second / clockTicks
+			}
+		}
+	}
+	return rss, cpu
+}
+
+// checkLimitsLocked records which of its limits a job that just ended was
+// killed for exceeding. The caller must hold the lock.
+func checkLimitsLocked(job *types.Job) {
+	limits := job.Limits
+	if limits == nil || job.OverLimit != "" {
+		return
+	}
+
+	switch job.Signal {
+	case syscall.SIGXCPU:
+		if limits.CPU > 0 {
+			job.OverLimit = "CPU " + limits.CPU.String()
+		}
+	case syscall.SIGKILL:
+		if limits.CPU > 0 && job.Usage != nil && job.Usage.UserTime+job.Usage.SystemTime >= limits.CPU {
+			job.OverLimit = "CPU " + limits.CPU.String()
+		}
+	case syscall.SIGXFSZ:
+		if limits.FileSize > 0 {
+			job.OverLimit = "file size " + formatBytes(limits.FileSize)
+		}
+	}
+}
+
+// limitsText lists the limits of a job for 'jobs -l'
+func limitsText(limits *types.JobLimits) string {
+	var parts []string
+	if limits.Memory > 0 {
+		parts = append(parts, "mem "+formatBytes(limits.Memory))
+	}
+	if limits.CPU > 0 {
+		parts = append(parts, "cpu "+limits.CPU.String())
+	}
+	if limits.FileSize > 0 {
+		parts = append(parts, "fsize "+formatBytes(limits.FileSize))
+	}
+	if limits.OpenFiles > 0 {
+		parts = append(parts, fmt.Sprintf("nofile %d", limits.OpenFiles))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseSize reads a size in bytes with an optional K, M, G or T suffix
+// (powers of 1024)
+func parseSize(spec string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(spec), "B")
+	unit := int64(1)
+	if n := len(number); n > 0 {
+		if i := strings.IndexByte("KMGT", number[n-1]); i >= 0 {
+			unit = int64(1) << (10 * (i + 1))
+			number = number[:n-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("%s: invalid size", spec)
+	}
+	return int64(value * float64(unit)), nil
+}
+
+// ulimitFlags lists the resource options of ulimit, joined by sep
+func ulimitFlags(sep string) string {
+	flags := []string{"-a"}
+	for _, r := range ulimitResources {
+		flags = append(flags, "-"+string(r.flag))
+	}
+	return strings.Join(flags, sep)
+}
+
+func (ch *CommandHandler) handleUlimit(args []string) error {
+	usage := "Usage: ulimit [-SH] [" + ulimitFlags(" | ") + "] [limit | unlimited]"
+
+	soft, hard, all := false, false, false
+	var selected *ulimitResource
+	var value string
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") || len(arg) == 1 {
+			if value != "" {
+				return fmt.Errorf("ulimit: too many arguments\n%s", usage)
+			}
+			value = arg
+			continue
+		}
+		for _, flag := range []byte(arg[1:]) {
+			switch flag {
+			case 'S':
+				soft = true
+			case 'H':
+				hard = true
+			case 'a':
+				all = true
+			default:
+				found := false
+				for i := range ulimitResources {
+					if ulimitResources[i].flag == flag {
+						if selected != nil && selected.flag != flag {
+							return fmt.Errorf("ulimit: only one resource can be given\n%s", usage)
+						}
+						selected = &ulimitResources[i]
+						found = true
+					}
+				}
+				if !found {
+					return fmt.Errorf("ulimit: -%c: invalid option\n%s", flag, usage)
+				}
+			}
+		}
+	}
+	if selected == nil {
+		selected = &ulimitResources[0]
+	}
+
+	format := func(n, unit uint64) string {
+		if n == rlimInfinity {
+			return "unlimited"
+		}
+		return strconv.FormatUint(n/unit, 10)
+	}
+
+	if all {
+		if value != "" {
+			return fmt.Errorf("ulimit: -a does not take a limit\n%s", usage)
+		}
+		for _, r := range ulimitResources {
+			limit, err := ch.jobManager.Rlimit(r.resource)
+			if err != nil {
+				return fmt.Errorf("ulimit: %v", err)
+			}
+			n := rlimValue(limit.Cur)
+			if hard && !soft {
+				n = rlimValue(limit.Max)
+			}
+			fmt.Printf("%-26s (-%c) %s\n", r.name, r.flag, format(n, r.unit))
+		}
+		return nil
+	}
+
+	limit, err := ch.jobManager.Rlimit(selected.resource)
+	if err != nil {
+		return fmt.Errorf("ulimit: %v", err)
+	}
+	if value == "" {
+		n := rlimValue(limit.Cur)
+		if hard && !soft {
+			n = rlimValue(limit.Max)
+		}
+		fmt.Println(format(n, selected.unit))
+		return nil
+	}
+
+	n := rlimInfinity
+	if value != "unlimited" {
+		count, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ulimit: %s: invalid limit", value)
+		}
+		n = count * selected.unit
+	}
+
+	// Like bash, set both limits unless one of them is named
+	oldMax := rlimValue(limit.Max)
+	cur, max := rlimValue(limit.Cur), oldMax
+	if soft || !hard {
+		cur = n
+	}
+	if hard || !soft {
+		max = n
+	}
+	if cur > max {
+		return fmt.Errorf("ulimit: -%c: soft limit cannot exceed the hard limit (%s)", selected.flag, format(max, selected.unit))
+	}
+	if max > oldMax && os.Geteuid() != 0 {
+		return fmt.Errorf("ulimit: -%c: cannot raise the hard limit above %s", selected.flag, format(oldMax, selected.unit))
+	}
+	if selected.resource == syscall.RLIMIT_NOFILE {
+		// Even root cannot go past the kernel's per-process maximum
+		if data, err := os.ReadFile("/proc/sys/fs/nr_open"); err == nil {
+			if nrOpen, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil && max > nrOpen {
+				return fmt.Errorf("ulimit: -n: the system allows at most %d open files", nrOpen)
+			}
+		}
+	}
+
+	next := limit
+	setRlimValue(&next.Cur, cur)
+	setRlimValue(&next.Max, max)
+	ch.jobManager.SetRlimit(selected.resource, next)
+	return nil
+}
+
+func (ch *CommandHandler) handleLimit(args []string, background bool) error {
+	usage := "Usage: limit [--mem size] [--cpu duration] [--fsize size] [--nofile n] command [args...] [&]"
+
+	limits := &types.JobLimits{}
+	rest := args[1:]
+options:
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		if rest[0] == "--" {
+			rest = rest[1:]
+			break options
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("limit: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		var err error
+		switch rest[0] {
+		case "--mem", "-m":
+			limits.Memory, err = parseSize(rest[1])
+		case "--cpu", "-t":
+			limits.CPU, err = parseDuration(rest[1])
+			if err == nil && limits.CPU <= 0 {
+				err = fmt.Errorf("%s: must be positive", rest[1])
+			}
+		case "--fsize", "-f":
+			limits.FileSize, err = parseSize(rest[1])
+		case "--nofile", "-n":
+			limits.OpenFiles, err = parsePositive(rest[1])
+		default:
+			return fmt.Errorf("limit: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("limit: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	if len(rest) == 0 {
+		return fmt.Errorf("limit: missing command\n%s", usage)
+	}
+	if *limits == (types.JobLimits{}) {
+		return fmt.Errorf("limit: no limits given\n%s", usage)
+	}
+
+	job, err := ch.startPolicyJob("limit", rest, JobOptions{Background: background, Limits: limits})
+	if err != nil || job == nil {
+		return err
+	}
+	if job.OverLimit != "" {
+		return fmt.Errorf("limit: %s: killed for exceeding its limit (%s)", job.Args[0], job.OverLimit)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Su5ubedi/advanced-shell/internal/alloc"
+)
+
+// defaultHeapSize is the heap malloc-sim models unless told otherwise
+const defaultHeapSize = 1024
+
+func (ch *CommandHandler) handleMallocSim(args []string) error {
+	usage := "Usage: malloc-sim [-a strategy|all] [-size n] [-min n] [-compact] [-v] (-f script | name:size | free:name | compact ...)\n" +
+		"Strategies: first, next, best, worst, buddy"
+
+	strategies := []alloc.Strategy{alloc.FirstFit}
+	all := false
+	size := int64(defaultHeapSize)
+	opts := alloc.DefaultOptions
+	file := ""
+	verbose := false
+	rest := args[1:]
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		switch rest[0] {
+		case "-v":
+			verbose = true
+			rest = rest[1:]
+			continue
+		case "-compact":
+			opts.AutoCompact = true
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("malloc-sim: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		var err error
+		switch rest[0] {
+		case "-a":
+			if rest[1] == "all" {
+				strategies, all = alloc.Strategies, true
+				break
+			}
+			strategies = nil
+			for _, name := range strings.Split(rest[1], ",") {
+				s, err := alloc.ParseStrategy(name)
+				if err != nil {
+					return fmt.Errorf("malloc-sim: %v\n%s", err, usage)
+				}
+				strategies = append(strategies, s)
+			}
+		case "-size":
+			size, err = parseSize(rest[1])
+			if err == nil && (size <= 0 || size > 1<<30) {
+				err = fmt.Errorf("heap size must be between 1 and 1G")
+			}
+		case "-min":
+			opts.MinBlock, err = parsePositive(rest[1])
+		case "-f":
+			file = rest[1]
+		default:
+			return fmt.Errorf("malloc-sim: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("malloc-sim: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	var reqs []alloc.Request
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("malloc-sim: %v", err)
+		}
+		defer f.Close()
+		if reqs, err = alloc.ReadRequests(f); err != nil {
+			return fmt.Errorf("malloc-sim: %s: %v", file, err)
+		}
+	}
+	for _, spec := range rest {
+		req, err := alloc.ParseRequest(spec)
+		if err != nil {
+			return fmt.Errorf("malloc-sim: %v", err)
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		return fmt.Errorf("malloc-sim: no requests given\n%s", usage)
+	}
+
+	if all && size&(size-1) != 0 {
+		strategies = strategies[:len(strategies)-1]
+		fmt.Printf("Skipping the buddy system: %d is not a power of two\n\n", size)
+	}
+
+	results := make([]*alloc.Result, 0, len(strategies))
+	for _, s := range strategies {
+		result, err := alloc.Simulate(int(size), reqs, s, opts)
+		if err != nil {
+			return fmt.Errorf("malloc-sim: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	symbols := alloc.Symbols(reqs)
+	if len(results) == 1 || verbose {
+		for i, result := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			printAllocation(result, symbols, verbose)
+		}
+	}
+	if len(results) > 1 {
+		if verbose {
+			fmt.Println()
+		}
+		compareAllocations(results, symbols)
+	}
+	return nil
+}
+
+// printAllocation prints the outcome of each request, the final memory map
+// and its fragmentation
+func printAllocation(result *alloc.Result, symbols map[string]byte, verbose bool) {
+	title := fmt.Sprintf("%s, %d unit heap", result.Strategy.Title(), result.Size)
+	if result.Strategy == alloc.Buddy {
+		title += fmt.Sprintf(", %d unit minimum block", result.Options.MinBlock)
+	}
+	fmt.Printf("%s\n\n", title)
+
+	for i, event := range result.Events {
+		fmt.Printf("%3d  %-20s %s\n", i+1, event.Request, allocationOutcome(event))
+		if verbose {
+			fmt.Println(indent(alloc.Map(event.Blocks, result.Size, chartWidth-5, symbols), 5))
+		}
+	}
+
+	blocks := result.Blocks()
+	fmt.Println()
+	fmt.Println(alloc.Map(blocks, result.Size, chartWidth, symbols))
+	fmt.Println()
+
+	fmt.Printf("%-8s %8s %8s %8s %-10s %9s\n", "SYMBOL", "START", "END", "SIZE", "OWNER", "REQUESTED")
+	for _, b := range blocks {
+		if b.Hole() {
+			fmt.Printf("%-8s %8d %8d %8d %-10s %9s\n", "", b.Start, b.End()-1, b.Size, "(hole)", "")
+			continue
+		}
+		fmt.Printf("%-8c %8d %8d %8d %-10s %9d\n", symbols[b.Name], b.Start, b.End()-1, b.Size, b.Name, b.Requested)
+	}
+
+	f := alloc.Stats(blocks)
+	fmt.Printf("\nUsed %d, free %d in %d hole(s), largest hole %d\n", f.Used, f.Free, f.Holes, f.Largest)
+	internal := 0.0
+	if f.Used > 0 {
+		internal = float64(f.Internal) / float64(f.Used) * 100
+	}
+	fmt.Printf("Internal fragmentation %d (%.1f%% of allocated), external fragmentation %.1f%%\n",
+		f.Internal, internal, f.External()*100)
+	fmt.Printf("Failed requests: %d of %d\n", result.Failed, len(result.Events))
+}
+
+// allocationOutcome describes what became of one request
+func allocationOutcome(event alloc.Event) string {
+	var text string
+	if event.Compacted {
+		text = fmt.Sprintf("compacted, %d block(s) moved; ", event.Moved)
+	}
+	switch {
+	case event.Err != nil:
+		return text + "failed: " + event.Err.Error()
+	case event.Op == alloc.Compact:
+		return fmt.Sprintf("%d block(s) moved", event.Moved)
+	case event.Op == alloc.Free:
+		return fmt.Sprintf("freed %d at %d", event.Block.Size, event.Block.Start)
+	}
+	text += fmt.Sprintf("at %d", event.Block.Start)
+	if event.Block.Size != event.Block.Requested {
+		text += fmt.Sprintf(" in a %d unit block", event.Block.Size)
+	}
+	return text
+}
+
+// compareAllocations prints the final state of several simulations side by
+// side
+func compareAllocations(results []*alloc.Result, symbols map[string]byte) {
+	fmt.Printf("%-9s %6s %6s %6s %6s %8s %9s %9s\n",
+		"STRATEGY", "FAILED", "USED", "FREE", "HOLES", "LARGEST", "INTERNAL", "EXTERNAL")
+	best := results[0]
+	for _, result := range results {
+		f := alloc.Stats(result.Blocks())
+		fmt.Printf("%-9s %6d %6d %6d %6d %8d %9d %8.1f%%\n",
+			result.Strategy, result.Failed, f.Used, f.Free, f.Holes, f.Largest, f.Internal, f.External()*100)
+		if result.Failed < best.Failed {
+			best = result
+		}
+	}
+
+	fmt.Println()
+	for _, result := range results {
+		fmt.Printf("%-9s %s\n", result.Strategy, strings.SplitN(alloc.Map(result.Blocks(), result.Size, chartWidth-10, symbols), "\n", 2)[0])
+	}
+	fmt.Printf("\nFewest failed requests: %s\n", best.Strategy.Title())
+}
+
+// indent prefixes every line of text with n spaces
+func indent(text string, n int) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+}
@@ -0,0 +1,204 @@
+package shell
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/internal/paging"
+)
+
+func (ch *CommandHandler) handleMemsim(args []string) error {
+	usage := "Usage: memsim [-a algorithm|all] [-f frames] [-s page-size] [-v] (references... | -r N [-pages P] [-seed S])\n" +
+		"       memsim -belady [-a algorithm] [-f max-frames] [references...]\n" +
+		"Algorithms: fifo, lru, opt, clock, lfu"
+
+	algorithms := []paging.Algorithm{paging.FIFO}
+	frames, pageSize := 3, int64(0)
+	random, randomPages, seed := 0, 10, time.Now().UnixNano()
+	belady, verbose := false, false
+	rest := args[1:]
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		switch rest[0] {
+		case "-belady":
+			belady = true
+			rest = rest[1:]
+			continue
+		case "-v":
+			verbose = true
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("memsim: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		var err error
+		switch rest[0] {
+		case "-a":
+			if rest[1] == "all" {
+				algorithms = paging.Algorithms
+				break
+			}
+			algorithms = nil
+			for _, name := range strings.Split(rest[1], ",") {
+				alg, err := paging.ParseAlgorithm(name)
+				if err != nil {
+					return fmt.Errorf("memsim: %v\n%s", err, usage)
+				}
+				algorithms = append(algorithms, alg)
+			}
+		case "-f":
+			frames, err = parsePositive(rest[1])
+		case "-s":
+			pageSize, err = parseSize(rest[1])
+		case "-r":
+			random, err = parsePositive(rest[1])
+		case "-pages":
+			randomPages, err = parsePositive(rest[1])
+		case "-seed":
+			seed, err = strconv.ParseInt(rest[1], 10, 64)
+		default:
+			return fmt.Errorf("memsim: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("memsim: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	refs, err := memsimReferences(rest, pageSize)
+	if err != nil {
+		return fmt.Errorf("memsim: %v", err)
+	}
+	if random > 0 {
+		rng := rand.New(rand.NewSource(seed))
+		for i := 0; i < random; i++ {
+			refs = append(refs, rng.Intn(randomPages))
+		}
+		fmt.Printf("Random reference string (seed %d)\n", seed)
+	}
+
+	if belady {
+		if len(refs) == 0 {
+			refs = paging.BeladyReferences
+		}
+		return beladyDemo(refs, algorithms, frames)
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("memsim: no references given\n%s", usage)
+	}
+
+	results := make([]*paging.Result, 0, len(algorithms))
+	for _, alg := range algorithms {
+		result, err := paging.Simulate(refs, frames, alg)
+		if err != nil {
+			return fmt.Errorf("memsim: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 1 || verbose {
+		for i, result := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s, %d frames\n\n", result.Algorithm.Title(), result.Frames)
+			fmt.Println(paging.Table(result, chartWidth))
+			fmt.Printf("Page faults: %d of %d references, hit ratio %.1f%%\n",
+				result.Faults, len(result.Steps), result.HitRatio()*100)
+		}
+	}
+	if len(results) > 1 {
+		if verbose {
+			fmt.Println()
+		}
+		fmt.Printf("%-8s %7s %5s %10s\n", "ALGORITHM", "FAULTS", "HITS", "HIT RATIO")
+		for _, result := range results {
+			fmt.Printf("%-9s %7d %5d %9.1f%%\n", result.Algorithm, result.Faults,
+				len(result.Steps)-result.Faults, result.HitRatio()*100)
+		}
+	}
+	return nil
+}
+
+// memsimReferences parses a reference string given as separate arguments or
+// as one quoted, comma or space separated list. With a page size the
+// references are virtual addresses, which are translated to page numbers.
+func memsimReferences(args []string, pageSize int64) ([]int, error) {
+	var words []string
+	for _, arg := range args {
+		words = append(words, strings.FieldsFunc(arg, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})...)
+	}
+
+	refs := make([]int, 0, len(words))
+	if pageSize > 0 && len(words) > 0 {
+		fmt.Printf("Page size %s\n%-18s %8s %12s\n", formatBytes(pageSize), "ADDRESS", "PAGE", "OFFSET")
+	}
+	for _, word := range words {
+		n, err := strconv.ParseInt(word, 0, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s: expected a page number or address", word)
+		}
+		if pageSize > 0 {
+			page, offset := n/pageSize, n%pageSize
+			fmt.Printf("%-18s %8d %12s\n", fmt.Sprintf("%#x", n), page, fmt.Sprintf("%#x", offset))
+			n = page
+		}
+		refs = append(refs, int(n))
+	}
+	if pageSize > 0 && len(words) > 0 {
+		fmt.Println()
+	}
+	return refs, nil
+}
+
+// beladyDemo prints how the number of faults changes as frames are added.
+// FIFO can fault more with more frames; stack algorithms such as LRU and
+// Optimal never do.
+func beladyDemo(refs []int, algorithms []paging.Algorithm, maxFrames int) error {
+	distinct := make(map[int]bool)
+	for _, page := range refs {
+		distinct[page] = true
+	}
+	maxFrames = max(maxFrames, len(distinct))
+
+	words := make([]string, len(refs))
+	for i, page := range refs {
+		words[i] = strconv.Itoa(page)
+	}
+	fmt.Printf("Reference string: %s\n\n", strings.Join(words, " "))
+
+	fmt.Printf("%-8s", "FRAMES")
+	for n := 1; n <= maxFrames; n++ {
+		fmt.Printf(" %4d", n)
+	}
+	fmt.Println()
+
+	found := false
+	for _, alg := range algorithms {
+		curve, err := paging.Curve(refs, maxFrames, alg)
+		if err != nil {
+			return fmt.Errorf("memsim: %v", err)
+		}
+		fmt.Printf("%-8s", alg)
+		for _, faults := range curve {
+			fmt.Printf(" %4d", faults)
+		}
+		fmt.Println()
+
+		for _, n := range paging.Anomalies(curve) {
+			found = true
+			fmt.Printf("  Belady's anomaly: %s faults %d times with %d frames but %d times with %d\n",
+				alg, curve[n-2], n-1, curve[n-1], n)
+		}
+	}
+	if !found {
+		fmt.Println("\nNo anomaly: adding frames never caused more faults")
+	}
+	return nil
+}
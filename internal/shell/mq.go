@@ -0,0 +1,420 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/internal/acl"
+	"github.com/Su5ubedi/advanced-shell/internal/ipc"
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// defaultQueueCapacity is how many messages a queue holds unless told
+// otherwise
+const defaultQueueCapacity = 64
+
+func (ch *CommandHandler) handleMq(args []string, background bool) error {
+	usage := "Usage: mq [list]\n" +
+		"       mq create [-n capacity] name...\n" +
+		"       mq send [-t timeout] name message...\n" +
+		"       mq recv [-t timeout] [-v] name\n" +
+		"       mq run [-in name] [-out name] [-close] command [args...] [&]\n" +
+		"       mq close name... | mq rm name..."
+
+	if len(args) < 2 || args[1] == "list" {
+		ch.listQueues()
+		return nil
+	}
+	rest := args[2:]
+
+	switch args[1] {
+	case "create":
+		capacity := defaultQueueCapacity
+		if len(rest) >= 2 && rest[0] == "-n" {
+			n, err := parsePositive(rest[1])
+			if err != nil {
+				return fmt.Errorf("mq: -n: %v", err)
+			}
+			capacity, rest = n, rest[2:]
+		}
+		if len(rest) == 0 {
+			return fmt.Errorf("mq: create: missing queue name\n%s", usage)
+		}
+		for _, name := range rest {
+			if _, exists := ch.queues[name]; exists {
+				return fmt.Errorf("mq: %s: queue already exists", name)
+			}
+		}
+		if ch.queues == nil {
+			ch.queues = make(map[string]*ipc.Queue)
+		}
+		for _, name := range rest {
+			ch.queues[name] = ipc.NewQueue(capacity)
+		}
+		return nil
+
+	case "send":
+		timeout, rest, err := queueTimeout(rest)
+		if err != nil {
+			return err
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("mq: send: missing queue name or message\n%s", usage)
+		}
+		q, err := ch.queue(rest[0])
+		if err != nil {
+			return err
+		}
+		m := ipc.Message{Body: strings.Join(rest[1:], " "), From: "shell"}
+		return ch.blockOnQueue("send", rest[0], timeout, func(stop <-chan struct{}) error {
+			return q.Send(m, stop)
+		})
+
+	case "recv", "receive":
+		timeout, rest, err := queueTimeout(rest)
+		if err != nil {
+			return err
+		}
+		verbose := false
+		if len(rest) > 0 && rest[0] == "-v" {
+			verbose, rest = true, rest[1:]
+		}
+		if len(rest) != 1 {
+			return fmt.Errorf("mq: recv: expected one queue name\n%s", usage)
+		}
+		q, err := ch.queue(rest[0])
+		if err != nil {
+			return err
+		}
+		var m ipc.Message
+		err = ch.blockOnQueue("recv", rest[0], timeout, func(stop <-chan struct{}) error {
+			var err error
+			m, err = q.Receive(stop)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if verbose {
+			fmt.Printf("[%s from %s] ", m.Sent.Format("15:04:05"), m.From)
+		}
+		fmt.Println(m.Body)
+		return nil
+
+	case "run":
+		return ch.runWithQueues(rest, background, usage)
+
+	case "close", "rm":
+		if len(rest) == 0 {
+			return fmt.Errorf("mq: %s: missing queue name\n%s", args[1], usage)
+		}
+		for _, name := range rest {
+			q, err := ch.queue(name)
+			if err != nil {
+				return err
+			}
+			// Closing wakes anyone blocked on the queue, including the
+			// jobs attached to it
+			q.Close()
+			if args[1] == "rm" {
+				delete(ch.queues, name)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("mq: %s: unknown subcommand\n%s", args[1], usage)
+}
+
+// queue looks up a queue by name
+func (ch *CommandHandler) queue(name string) (*ipc.Queue, error) {
+	q, ok := ch.queues[name]
+	if !ok {
+		return nil, fmt.Errorf("mq: %s: no such queue (create it with mq create)", name)
+	}
+	return q, nil
+}
+
+// queueTimeout takes a leading -t timeout option
+func queueTimeout(args []string) (time.Duration, []string, error) {
+	if len(args) == 0 || args[0] != "-t" {
+		return 0, args, nil
+	}
+	if len(args) < 2 {
+		return 0, nil, fmt.Errorf("mq: -t: option requires an argument")
+	}
+	timeout, err := parseDuration(args[1])
+	if err != nil {
+		return 0, nil, fmt.Errorf("mq: -t: %v", err)
+	}
+	return timeout, args[2:], nil
+}
+
+// blockOnQueue runs a send or receive that may block, giving up after
+// timeout (if any) or on Ctrl-C
+func (ch *CommandHandler) blockOnQueue(op, name string, timeout time.Duration, do func(stop <-chan struct{}) error) error {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	ch.jobManager.clearInterrupt()
+	reason := ""
+	go func() {
+		select {
+		case <-expired:
+			reason = "timed out"
+		case <-ch.jobManager.interrupt:
+			reason = "interrupted"
+		case <-done:
+			return
+		}
+		close(stop)
+	}()
+
+	err := do(stop)
+	switch err {
+	case nil:
+		return nil
+	case ipc.ErrStopped:
+		return fmt.Errorf("mq: %s: %s %s", op, name, reason)
+	}
+	return fmt.Errorf("mq: %s: %s: %v", op, name, err)
+}
+
+// listQueues prints each queue with its traffic and the jobs attached to it
+func (ch *CommandHandler) listQueues() {
+	if len(ch.queues) == 0 {
+		fmt.Println("No message queues")
+		return
+	}
+
+	attached := make(map[string][]string)
+	for _, job := range ch.jobManager.GetAllJobs() {
+		for _, q := range job.Queues {
+			dir, name, _ := strings.Cut(q, ":")
+			attached[name] = append(attached[name], fmt.Sprintf("[%d] %s", job.ID, dir))
+		}
+	}
+
+	fmt.Printf("%-16s %9s %6s %6s %-10s %s\n", "QUEUE", "MESSAGES", "SENT", "RECV", "STATE", "JOBS")
+	for _, name := range sortedKeys(ch.queues) {
+		s := ch.queues[name].Stats()
+		state := "open"
+		switch {
+		case s.Closed:
+			state = "closed"
+		case s.Sending > 0:
+			state = fmt.Sprintf("%d sending", s.Sending)
+		case s.Receiving > 0:
+			state = fmt.Sprintf("%d waiting", s.Receiving)
+		}
+		jobs := strings.Join(attached[name], ", ")
+		if jobs == "" {
+			jobs = "-"
+		}
+		fmt.Printf("%-16s %9s %6d %6d %-10s %s\n", name, fmt.Sprintf("%d/%d", s.Length, s.Capacity),
+			s.Sent, s.Received, state, jobs)
+	}
+}
+
+// runWithQueues starts a command whose standard input is fed from one queue,
+// a message per line, and whose output lines are sent to another
+func (ch *CommandHandler) runWithQueues(args []string, background bool, usage string) error {
+	var in, out *ipc.Queue
+	var inName, outName string
+	closeOut := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if args[0] == "-close" {
+			closeOut, args = true, args[1:]
+			continue
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("mq: run: %s: option requires an argument\n%s", args[0], usage)
+		}
+		if args[0] != "-in" && args[0] != "-out" {
+			return fmt.Errorf("mq: run: %s: invalid option\n%s", args[0], usage)
+		}
+		q, err := ch.queue(args[1])
+		if err != nil {
+			return err
+		}
+		if args[0] == "-in" {
+			in, inName = q, args[1]
+		} else {
+			out, outName = q, args[1]
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("mq: run: missing command\n%s", usage)
+	}
+	if in == nil && out == nil {
+		return fmt.Errorf("mq: run: give a queue with -in or -out\n%s", usage)
+	}
+	if closeOut && out == nil {
+		return fmt.Errorf("mq: run: -close needs an -out queue")
+	}
+	if out != nil && out.Stats().Closed {
+		return fmt.Errorf("mq: run: %s: queue closed", outName)
+	}
+	if ch.parser.IsBuiltinCommand(args[0]) {
+		return fmt.Errorf("mq: run: %s: cannot be used with a built-in command", args[0])
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("mq: run: %s: command not found", args[0])
+	}
+
+	opts := JobOptions{Background: background}
+	var inWriter, outReader *os.File
+	if in != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("mq: run: %v", err)
+		}
+		defer r.Close()
+		opts.Stdin, inWriter = r, w
+		opts.Queues = append(opts.Queues, "in:"+inName)
+	}
+	if out != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			if inWriter != nil {
+				inWriter.Close()
+			}
+			return fmt.Errorf("mq: run: %v", err)
+		}
+		defer w.Close()
+		opts.Stdout, outReader = w, r
+		opts.Queues = append(opts.Queues, "out:"+outName)
+	}
+
+	jm := ch.jobManager
+	job, err := jm.startJob(args, opts)
+	if err != nil {
+		if inWriter != nil {
+			inWriter.Close()
+		}
+		if outReader != nil {
+			outReader.Close()
+		}
+		return fmt.Errorf("mq: run: %v", err)
+	}
+
+	// The feeder stops taking messages once the job is done, so none are
+	// lost to a reader that has gone
+	finished := make(chan struct{})
+	go func() {
+		jm.awaitChange(false, func() bool { return job.Status == types.JobStatusDone })
+		close(finished)
+	}()
+	if in != nil {
+		go feedJob(in, inWriter, finished)
+	}
+	drained := make(chan struct{})
+	if out != nil {
+		from := "job"
+		if job.ID > 0 {
+			from = fmt.Sprintf("job [%d]", job.ID)
+		}
+		go func() {
+			drainJob(outReader, out, from)
+			if closeOut {
+				out.Close()
+			}
+			close(drained)
+		}()
+	} else {
+		close(drained)
+	}
+
+	if !background {
+		jm.waitForeground(job)
+		// Let the last lines of output reach the queue before the prompt
+		select {
+		case <-drained:
+		case <-time.After(time.Second):
+		}
+	}
+	return nil
+}
+
+// feedJob writes messages from a queue to a job's input, one per line, until
+// the queue is closed or the job finishes. A message the job can no longer
+// read is put back for the next receiver.
+func feedJob(q *ipc.Queue, w *os.File, finished <-chan struct{}) {
+	defer w.Close()
+	for {
+		m, err := q.Receive(finished)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(w, m.Body+"\n"); err != nil {
+			q.PutBack(m)
+			return
+		}
+	}
+}
+
+// drainJob sends each line a job writes to a queue, blocking the job while
+// the queue is full. Lines may be of any length, and a last line without a
+// newline is sent too. If the queue is closed the rest of the output is
+// discarded so the job is not stuck writing.
+func drainJob(r *os.File, q *ipc.Queue, from string) {
+	defer r.Close()
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			body := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			if sendErr := q.Send(ipc.Message{Body: body, From: from}, nil); sendErr != nil {
+				io.Copy(io.Discard, reader)
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ch *CommandHandler) handleMkfifo(args []string) error {
+	usage := "Usage: mkfifo [-m mode] name..."
+	mode := uint32(0666)
+	rest := args[1:]
+	if len(rest) >= 1 && rest[0] == "-m" {
+		if len(rest) < 2 {
+			return fmt.Errorf("mkfifo: -m: option requires an argument\n%s", usage)
+		}
+		m, err := strconv.ParseUint(rest[1], 8, 32)
+		if err != nil || m > 0777 {
+			return fmt.Errorf("mkfifo: %s: invalid mode", rest[1])
+		}
+		mode, rest = uint32(m), rest[2:]
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("mkfifo: missing name\n%s", usage)
+	}
+
+	for _, name := range rest {
+		if err := ch.authorize("mkfifo", name, acl.Write, false); err != nil {
+			return err
+		}
+		if err := syscall.Mkfifo(name, mode); err != nil {
+			return fmt.Errorf("mkfifo: %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,400 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// haltMode says what parallel does once a job fails
+type haltMode int
+
+const (
+	haltNever haltMode = iota // run every item
+	haltSoon                  // start nothing new, let running jobs finish
+	haltNow                   // kill the running jobs too
+)
+
+// parallelTask is one item of a parallel run
+type parallelTask struct {
+	seq     int
+	item    string
+	args    []string
+	job     *types.Job // final state once finished
+	output  *os.File   // grouped output, nil when ungrouped
+	err     error      // why the command could not be started
+	printed bool
+}
+
+// finished reports whether the task has ended or could not be started
+func (t *parallelTask) finished() bool {
+	return t.err != nil || (t.job != nil && t.job.Status == types.JobStatusDone)
+}
+
+// failed reports whether the task did not finish successfully
+func (t *parallelTask) failed() bool {
+	return t.err != nil || t.job == nil || t.job.ExitCode != 0
+}
+
+// parallelOptions holds the parsed options of the parallel built-in
+type parallelOptions struct {
+	jobs      int
+	halt      haltMode
+	keepOrder bool
+	ungroup   bool
+	tag       bool
+	argFile   string
+}
+
+func (ch *CommandHandler) handleParallel(args []string, background bool) error {
+	usage := "Usage: parallel [-j N] [-k] [-u] [--tag] [--halt never|on-failure|now] [-a file] command [args...] [::: items...]"
+
+	if background {
+		return fmt.Errorf("parallel: cannot run in the background; it already runs its items as background jobs")
+	}
+
+	opts := parallelOptions{jobs: runtime.NumCPU()}
+	rest := args[1:]
+options:
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		arg := rest[0]
+		needsValue := func() (string, error) {
+			if len(rest) < 2 {
+				return "", fmt.Errorf("parallel: %s: option requires an argument\n%s", arg, usage)
+			}
+			rest = rest[1:]
+			return rest[0], nil
+		}
+
+		switch {
+		case arg == "--":
+			rest = rest[1:]
+			break options
+		case arg == "-j" || arg == "--jobs":
+			value, err := needsValue()
+			if err != nil {
+				return err
+			}
+			if opts.jobs, err = parsePositive(value); err != nil {
+				return fmt.Errorf("parallel: %s: %v", arg, err)
+			}
+		case strings.HasPrefix(arg, "-j"):
+			n, err := parsePositive(arg[2:])
+			if err != nil {
+				return fmt.Errorf("parallel: -j: %v", err)
+			}
+			opts.jobs = n
+		case arg == "--halt":
+			value, err := needsValue()
+			if err != nil {
+				return err
+			}
+			switch value {
+			case "never":
+				opts.halt = haltNever
+			case "on-failure", "soon", "soon,fail=1":
+				opts.halt = haltSoon
+			case "now", "now,fail=1":
+				opts.halt = haltNow
+			default:
+				return fmt.Errorf("parallel: --halt: %s: expected never, on-failure or now", value)
+			}
+		case arg == "-k" || arg == "--keep-order":
+			opts.keepOrder = true
+		case arg == "-u" || arg == "--ungroup":
+			opts.ungroup = true
+		case arg == "--tag":
+			opts.tag = true
+		case arg == "-a" || arg == "--arg-file":
+			value, err := needsValue()
+			if err != nil {
+				return err
+			}
+			opts.argFile = value
+		default:
+			return fmt.Errorf("parallel: %s: invalid option\n%s", arg, usage)
+		}
+		rest = rest[1:]
+	}
+
+	// Split the command template from the ::: item list
+	template := rest
+	var items []string
+	haveItems := false
+	for i, arg := range rest {
+		if arg == ":::" {
+			template = rest[:i]
+			items = rest[i+1:]
+			haveItems = true
+			break
+		}
+	}
+	for _, item := range items {
+		if item == ":::" {
+			return fmt.Errorf("parallel: only one ::: list is supported")
+		}
+	}
+
+	// A quoted template such as 'gzip -9 {}' holds the whole command line
+	if len(template) == 1 && strings.ContainsAny(template[0], " \t") {
+		template = ch.parser.tokenize(template[0])
+	}
+	if len(template) == 0 {
+		return fmt.Errorf("parallel: missing command\n%s", usage)
+	}
+	if ch.parser.IsBuiltinCommand(template[0]) {
+		return fmt.Errorf("parallel: %s: cannot be used with a built-in command", template[0])
+	}
+
+	if !haveItems {
+		var err error
+		if items, err = ch.readParallelItems(opts.argFile); err != nil {
+			return fmt.Errorf("parallel: %v", err)
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	tasks := make([]*parallelTask, len(items))
+	for i, item := range items {
+		tasks[i] = &parallelTask{seq: i + 1, item: item, args: expandTemplate(template, item, i+1)}
+	}
+
+	ch.runParallel(tasks, opts)
+	return reportParallel(tasks)
+}
+
+// readParallelItems reads one item per line from a file, or from the
+// shell's standard input when no file is given
+func (ch *CommandHandler) readParallelItems(argFile string) ([]string, error) {
+	var scanner *bufio.Scanner
+	if argFile != "" {
+		f, err := os.Open(argFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner = bufio.NewScanner(f)
+	} else {
+		if isTerminal(os.Stdin) {
+			fmt.Println("parallel: reading items from the terminal, one per line (Ctrl-D to finish)")
+			// A scanner stops for good at the end of input, but at a
+			// terminal Ctrl-D only ends the list, so the shell goes on
+			// with a fresh one
+			defer func() { ch.input = bufio.NewScanner(os.Stdin) }()
+		}
+		scanner = ch.stdin()
+	}
+
+	var items []string
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items, scanner.Err()
+}
+
+// expandTemplate fills in the replacement strings GNU parallel understands:
+// {} the item, {.} without extension, {/} base name, {//} directory and {#}
+// the sequence number. The item is appended when none of them is used.
+func expandTemplate(template []string, item string, seq int) []string {
+	replacer := strings.NewReplacer(
+		"{}", item,
+		"{.}", strings.TrimSuffix(item, filepath.Ext(item)),
+		"{//}", filepath.Dir(item),
+		"{/}", filepath.Base(item),
+		"{#}", strconv.Itoa(seq),
+	)
+
+	args := make([]string, len(template))
+	replaced := false
+	for i, word := range template {
+		args[i] = replacer.Replace(word)
+		replaced = replaced || args[i] != word
+	}
+	if !replaced {
+		args = append(args, item)
+	}
+	return args
+}
+
+// runParallel runs the tasks as background jobs, never more than opts.jobs
+// at once, printing each task's output as it finishes. Ctrl-C stops the run
+// and terminates the jobs still running; pressing it again kills them.
+func (ch *CommandHandler) runParallel(tasks []*parallelTask, opts parallelOptions) {
+	devNull, err := os.Open(os.DevNull)
+	if err == nil {
+		defer devNull.Close()
+	}
+
+	running := make(map[int]*parallelTask)
+	next := 0
+	stopping := false
+	interrupts := 0
+	flushed := 0
+
+	stopAll := func(sig syscall.Signal) {
+		for id := range running {
+			_ = ch.jobManager.SignalJob(id, sig)
+		}
+	}
+
+	for next < len(tasks) || len(running) > 0 {
+		for !stopping && len(running) < opts.jobs && next < len(tasks) {
+			task := tasks[next]
+			next++
+			ch.startParallelTask(task, opts, devNull)
+			if task.job != nil {
+				running[task.job.ID] = task
+				continue
+			}
+			// The command could not be started at all
+			if opts.halt != haltNever {
+				stopping = true
+			}
+		}
+		if len(running) == 0 {
+			break
+		}
+
+		waiting := make([]*types.Job, 0, len(running))
+		for _, task := range running {
+			waiting = append(waiting, task.job)
+		}
+
+		finished, err := ch.jobManager.WaitForAny(waiting)
+		if err != nil {
+			interrupts++
+			stopping = true
+			if interrupts == 1 {
+				fmt.Println("\nparallel: interrupted, terminating running jobs")
+				stopAll(syscall.SIGTERM)
+			} else {
+				stopAll(syscall.SIGKILL)
+			}
+			continue
+		}
+
+		task := running[finished.ID]
+		delete(running, finished.ID)
+		task.job = finished
+		_ = ch.jobManager.Disown(finished.ID)
+
+		if task.failed() && opts.halt != haltNever && !stopping {
+			stopping = true
+			fmt.Printf("parallel: %s failed, not starting further jobs\n", strings.Join(task.args, " "))
+			if opts.halt == haltNow {
+				stopAll(syscall.SIGTERM)
+			}
+		}
+
+		if opts.keepOrder {
+			for flushed < len(tasks) && tasks[flushed].finished() {
+				printParallelOutput(tasks[flushed], opts)
+				flushed++
+			}
+		} else {
+			printParallelOutput(task, opts)
+		}
+	}
+
+	// Print whatever is left, including tasks that could not be started
+	for _, task := range tasks {
+		printParallelOutput(task, opts)
+	}
+}
+
+// startParallelTask starts one task as a quiet background job
+func (ch *CommandHandler) startParallelTask(task *parallelTask, opts parallelOptions, devNull *os.File) {
+	jobOpts := JobOptions{Background: true, Quiet: true, Stdin: devNull, Stdout: os.Stdout, Stderr: os.Stderr}
+	if !opts.ungroup {
+		output, err := os.CreateTemp("", "parallel-*.out")
+		if err != nil {
+			task.err = err
+			return
+		}
+		task.output = output
+		jobOpts.Stdout = output
+		jobOpts.Stderr = output
+	}
+
+	job, err := ch.jobManager.StartJob(task.args, jobOpts)
+	if err != nil {
+		task.err = err
+		return
+	}
+	task.job = job
+}
+
+// printParallelOutput prints a finished task's grouped output once, prefixing
+// each line with the item when tagging
+func printParallelOutput(task *parallelTask, opts parallelOptions) {
+	if task.printed || !task.finished() {
+		return
+	}
+	task.printed = true
+
+	if task.err != nil {
+		fmt.Fprintf(os.Stderr, "parallel: %v\n", task.err)
+	}
+	if task.output == nil {
+		return
+	}
+	defer os.Remove(task.output.Name())
+	defer task.output.Close()
+
+	if _, err := task.output.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if !opts.tag {
+		io.Copy(os.Stdout, task.output)
+		return
+	}
+	scanner := bufio.NewScanner(task.output)
+	for scanner.Scan() {
+		fmt.Printf("%s\t%s\n", task.item, scanner.Text())
+	}
+}
+
+// reportParallel prints the exit status of every item and fails when any
+// item did
+func reportParallel(tasks []*parallelTask) error {
+	failed, skipped := 0, 0
+	fmt.Printf("\n%4s  %-22s %9s  %s\n", "#", "STATUS", "TIME", "ITEM")
+	for _, task := range tasks {
+		status, elapsed := "Not started", "-"
+		switch {
+		case task.err != nil:
+			status = "Failed to start"
+		case task.job != nil:
+			status = statusText(task.job, true)
+			if task.job.EndTime != nil {
+				elapsed = formatSeconds(task.job.EndTime.Sub(task.job.StartTime).Round(time.Millisecond), 3)
+			}
+		default:
+			skipped++
+		}
+		if task.job != nil || task.err != nil {
+			if task.failed() {
+				failed++
+			}
+		}
+		fmt.Printf("%4d  %-22s %9s  %s\n", task.seq, status, elapsed, task.item)
+	}
+
+	if failed > 0 || skipped > 0 {
+		return fmt.Errorf("parallel: %d of %d jobs failed, %d not started", failed, len(tasks), skipped)
+	}
+	return nil
+}
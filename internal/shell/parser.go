@@ -91,22 +91,57 @@ func (cp *CommandParser) tokenize(input string) []string {
 // IsBuiltinCommand checks if a command is a built-in command
 func (cp *CommandParser) IsBuiltinCommand(command string) bool {
 	builtins := map[string]bool{
-		"cd":    true,
-		"pwd":   true,
-		"exit":  true,
-		"echo":  true,
-		"clear": true,
-		"ls":    true,
-		"cat":   true,
-		"mkdir": true,
-		"rmdir": true,
-		"rm":    true,
-		"touch": true,
-		"kill":  true,
-		"jobs":  true,
-		"fg":    true,
-		"bg":    true,
-		"help":  true,
+		"cd":         true,
+		"pwd":        true,
+		"exit":       true,
+		"echo":       true,
+		"clear":      true,
+		"ls":         true,
+		"cat":        true,
+		"mkdir":      true,
+		"rmdir":      true,
+		"rm":         true,
+		"touch":      true,
+		"kill":       true,
+		"jobs":       true,
+		"fg":         true,
+		"bg":         true,
+		"wait":       true,
+		"disown":     true,
+		"nohup":      true,
+		"time":       true,
+		"joblog":     true,
+		"timeout":    true,
+		"retry":      true,
+		"after":      true,
+		"run":        true,
+		"parallel":   true,
+		"at":         true,
+		"every":      true,
+		"crontab":    true,
+		"ulimit":     true,
+		"limit":      true,
+		"schedule":   true,
+		"memsim":     true,
+		"malloc-sim": true,
+		"sync":       true,
+		"deadlock":   true,
+		"disksim":    true,
+		"sched":      true,
+		"nice":       true,
+		"renice":     true,
+		"login":      true,
+		"logout":     true,
+		"whoami":     true,
+		"passwd":     true,
+		"useradd":    true,
+		"userdel":    true,
+		"mq":         true,
+		"mkfifo":     true,
+		"acl":        true,
+		"acl-chmod":  true,
+		"acl-chown":  true,
+		"help":       true,
 	}
 
 	return builtins[command]
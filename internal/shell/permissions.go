@@ -0,0 +1,326 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Su5ubedi/advanced-shell/internal/acl"
+	"github.com/Su5ubedi/advanced-shell/internal/auth"
+)
+
+// aclEnv names the environment variable holding the path of the permission
+// policy; it defaults to ~/.advanced-shell/acl.json
+const aclEnv = "ASH_ACL"
+
+// aclPolicy opens the permission policy the first time it is needed
+func (ch *CommandHandler) aclPolicy() (*acl.Policy, error) {
+	if ch.acl != nil {
+		return ch.acl, nil
+	}
+	path := os.Getenv(aclEnv)
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find home directory: %v", err)
+		}
+		path = filepath.Join(homeDir, ".advanced-shell", "acl.json")
+	}
+	policy, err := acl.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ch.acl = policy
+	return policy, nil
+}
+
+// subject is who file commands act as: the logged in user, or a guest once
+// accounts exist. Without any accounts the policy is not enforced, which is
+// also the case when there is no home directory to keep them in. A user
+// database that exists but cannot be read is an error, so that damaging the
+// file cannot turn the policy off.
+func (ch *CommandHandler) subject() (name, role string, enforce bool, err error) {
+	if ch.session != nil {
+		return ch.session.user.Name, ch.session.user.Role, true, nil
+	}
+	db, err := ch.userDB()
+	var users []auth.User
+	if err == nil {
+		users, err = db.Users()
+	}
+	switch {
+	case errors.Is(err, errNoHome):
+		if !ch.usersWarned {
+			fmt.Fprintf(os.Stderr, "warning: %v; permissions are not enforced\n", err)
+			ch.usersWarned = true
+		}
+		return "", auth.RoleGuest, false, nil
+	case err != nil:
+		return "", auth.RoleGuest, true, fmt.Errorf("cannot read the user database: %v", err)
+	}
+	return "", auth.RoleGuest, len(users) > 0, nil
+}
+
+// maxSymlinks bounds how many symbolic links resolvePath follows, as the
+// kernel does, so that a loop of links ends in an error
+const maxSymlinks = 40
+
+// resolvePath turns path into the absolute form without symbolic links that
+// the policy is matched against, so a link cannot lead into a directory its
+// own location would not allow. Parts that do not exist yet, such as a file
+// about to be created, are kept as given, but dangling links are still
+// followed to where they would lead.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	links := 0
+	return resolveLinks(abs, &links)
+}
+
+// resolveLinks implements resolvePath for an absolute path
+func resolveLinks(abs string, links *int) (string, error) {
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err == nil || !os.IsNotExist(err) {
+		return resolved, err
+	}
+
+	// Something along the path is missing: resolve its parent, then
+	// follow the last part if it is a dangling link
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return abs, nil
+	}
+	dir, err := resolveLinks(parent, links)
+	if err != nil {
+		return "", err
+	}
+	joined := filepath.Join(dir, filepath.Base(abs))
+	target, err := os.Readlink(joined)
+	if err != nil {
+		return joined, nil
+	}
+	if *links++; *links > maxSymlinks {
+		return "", fmt.Errorf("too many levels of symbolic links")
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return resolveLinks(target, links)
+}
+
+// authorize checks the policy before a command touches path. With tree set,
+// rules for paths below it must allow the access too, as for rm -r.
+func (ch *CommandHandler) authorize(command, path string, want acl.Perm, tree bool) error {
+	name, role, enforce, err := ch.subject()
+	if err != nil {
+		return fmt.Errorf("%s: %s: permission denied (%v)", command, path, err)
+	}
+	if !enforce {
+		return nil
+	}
+	policy, err := ch.aclPolicy()
+	if err != nil {
+		return fmt.Errorf("%s: %v", command, err)
+	}
+	abs, err := resolvePath(path)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %v", command, path, err)
+	}
+	if _, err := policy.Check(name, role, abs, want, tree); err != nil {
+		return fmt.Errorf("%s: %s: permission denied by policy (%v)", command, path, err)
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleACL(args []string) error {
+	usage := "Usage: acl [list] | acl check [-u user] paths... | acl rm paths..."
+	policy, err := ch.aclPolicy()
+	if err != nil {
+		return fmt.Errorf("acl: %v", err)
+	}
+
+	sub := "list"
+	if len(args) > 1 {
+		sub = args[1]
+	}
+	switch sub {
+	case "list":
+		entries, err := policy.Entries()
+		if err != nil {
+			return fmt.Errorf("acl: %v", err)
+		}
+		printACL(entries)
+		return nil
+	case "check":
+		return ch.checkACL(policy, args[2:])
+	case "rm":
+		if len(args) < 3 {
+			return fmt.Errorf("acl: rm: missing path\n%s", usage)
+		}
+		for _, path := range args[2:] {
+			abs, err := ch.mayChangeACL("acl", policy, path)
+			if err != nil {
+				return err
+			}
+			if err := policy.Remove(abs); err != nil {
+				return fmt.Errorf("acl: %v", err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("acl: %s: unknown subcommand\n%s", sub, usage)
+}
+
+// printACL lists the policy's entries, starting with the default that
+// applies where none of them do
+func printACL(entries []acl.Entry) {
+	fmt.Printf("%-30s %-12s %-5s %-5s %s\n", "PREFIX", "OWNER", "OWNER", "USER", "GUEST")
+	if len(entries) == 0 || entries[0].Prefix != "/" {
+		entries = append([]acl.Entry{acl.Default}, entries...)
+		entries[0].Prefix = "/ (default)"
+	}
+	for _, e := range entries {
+		owner := e.Owner
+		if owner == "" {
+			owner = "-"
+		}
+		fmt.Printf("%-30s %-12s %-5s %-5s %s\n", e.Prefix, owner,
+			e.Perms[acl.ClassOwner], e.Perms[acl.ClassUser], e.Perms[acl.ClassGuest])
+	}
+	fmt.Println("Administrators may do anything.")
+}
+
+// checkACL shows what a user may do with each path and which entry says so
+func (ch *CommandHandler) checkACL(policy *acl.Policy, args []string) error {
+	name, role, _, _ := ch.subject()
+	if len(args) >= 2 && args[0] == "-u" {
+		db, err := ch.userDB()
+		if err != nil {
+			return fmt.Errorf("acl: %v", err)
+		}
+		user, err := db.Lookup(args[1])
+		if err != nil {
+			return fmt.Errorf("acl: %v", err)
+		}
+		name, role = user.Name, user.Role
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("acl: check: missing path")
+	}
+
+	who := role
+	if name != "" {
+		who = fmt.Sprintf("%s (%s)", name, role)
+	}
+	for _, path := range args {
+		abs, err := resolvePath(path)
+		if err != nil {
+			return fmt.Errorf("acl: %s: %v", path, err)
+		}
+		e, err := policy.Match(abs)
+		if err != nil {
+			return fmt.Errorf("acl: %v", err)
+		}
+		fmt.Printf("%s: %s may %s (entry %s", path, who, e.For(name, role), e.Prefix)
+		if e.Owner != "" {
+			fmt.Printf(", owner %s", e.Owner)
+		}
+		fmt.Println(")")
+	}
+	return nil
+}
+
+// mayChangeACL checks that the logged in user may change the entry governing
+// path: administrators may change any, owners their own. It returns the
+// absolute path.
+func (ch *CommandHandler) mayChangeACL(command string, policy *acl.Policy, path string) (string, error) {
+	abs, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %v", command, path, err)
+	}
+	if ch.isAdmin() {
+		return abs, nil
+	}
+	e, err := policy.Match(abs)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", command, err)
+	}
+	if ch.session == nil || e.Owner != ch.currentUser() {
+		return "", fmt.Errorf("%s: %s: permission denied by policy (only an administrator or the owner may change it)", command, path)
+	}
+	return abs, nil
+}
+
+func (ch *CommandHandler) handleACLChmod(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("acl-chmod: missing operand\nUsage: acl-chmod mode paths...\n" +
+			"Modes: three octal digits for owner, user and guest (e.g. 750), or clauses like guest-w,user=rx")
+	}
+	policy, err := ch.aclPolicy()
+	if err != nil {
+		return fmt.Errorf("acl-chmod: %v", err)
+	}
+	// Check the mode before changing anything
+	if err := acl.ApplyMode(map[string]acl.Perm{}, args[1]); err != nil {
+		return fmt.Errorf("acl-chmod: %v", err)
+	}
+
+	for _, path := range args[2:] {
+		abs, err := ch.mayChangeACL("acl-chmod", policy, path)
+		if err != nil {
+			return err
+		}
+		e, err := policy.Chmod(abs, args[1])
+		if err != nil {
+			return fmt.Errorf("acl-chmod: %v", err)
+		}
+		fmt.Printf("%s: owner %s, user %s, guest %s\n", e.Prefix,
+			e.Perms[acl.ClassOwner], e.Perms[acl.ClassUser], e.Perms[acl.ClassGuest])
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleACLChown(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("acl-chown: missing operand\nUsage: acl-chown user paths...")
+	}
+	if !ch.isAdmin() {
+		return fmt.Errorf("acl-chown: permission denied by policy (only an administrator may change owners)")
+	}
+	owner := args[1]
+	if owner != "-" {
+		db, err := ch.userDB()
+		if err != nil {
+			return fmt.Errorf("acl-chown: %v", err)
+		}
+		if _, err := db.Lookup(owner); err != nil {
+			return fmt.Errorf("acl-chown: %v", err)
+		}
+	}
+	policy, err := ch.aclPolicy()
+	if err != nil {
+		return fmt.Errorf("acl-chown: %v", err)
+	}
+
+	for _, path := range args[2:] {
+		abs, err := resolvePath(path)
+		if err != nil {
+			return fmt.Errorf("acl-chown: %s: %v", path, err)
+		}
+		e, err := policy.Chown(abs, strings.TrimPrefix(owner, "-"))
+		if err != nil {
+			return fmt.Errorf("acl-chown: %v", err)
+		}
+		if e.Owner == "" {
+			fmt.Printf("%s: no owner\n", e.Prefix)
+		} else {
+			fmt.Printf("%s: owned by %s\n", e.Prefix, e.Owner)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"open", "secret"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"open/door":   "../secret",         // a directory elsewhere
+		"open/note":   "../secret/new.txt", // a dangling link
+		"open/loop-a": "loop-b",
+		"open/loop-b": "loop-a",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"open", "open"},
+		{"open/door", "secret"},
+		{"open/door/key", "secret/key"},
+		{"open/missing/deeper", "open/missing/deeper"},
+		{"open/note", "secret/new.txt"},
+		{"open/../open/door/x", "secret/x"},
+	}
+	for _, tt := range tests {
+		got, err := resolvePath(filepath.Join(root, tt.path))
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("%s resolved to %s, want %s", tt.path, got, want)
+		}
+	}
+
+	if _, err := resolvePath(filepath.Join(root, "open/loop-a")); err == nil {
+		t.Error("a loop of links resolved")
+	}
+}
@@ -0,0 +1,429 @@
+package shell
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// Defaults of the sched built-in
+const (
+	defaultQuantum = 500 * time.Millisecond
+	minQuantum     = 10 * time.Millisecond
+	defaultNice    = 10
+)
+
+// SchedPolicy decides which background jobs get the CPU
+type SchedPolicy string
+
+const (
+	PolicyRoundRobin SchedPolicy = "rr"       // take turns, one quantum each
+	PolicyPriority   SchedPolicy = "priority" // lowest niceness first, taking turns on a tie
+	PolicyFairShare  SchedPolicy = "fair"     // least weighted run time first
+)
+
+// jobScheduler time-slices background jobs by stopping and continuing them,
+// so that at most slots of them run at once
+type jobScheduler struct {
+	policy   SchedPolicy
+	quantum  time.Duration
+	slots    int
+	queue    []*types.Job           // jobs in turn order
+	paused   map[*types.Job]bool    // jobs the scheduler has stopped
+	vruntime map[*types.Job]float64 // fair share: run time weighted by niceness, in seconds
+	timer    *time.Timer
+}
+
+// weight is how much faster a job's fair share run time grows than that of
+// a job with niceness 0; as in Linux, each step of niceness is about 25%
+func weight(nice int) float64 {
+	return math.Pow(1.25, float64(nice))
+}
+
+// SetSchedPolicy starts time-slicing background jobs, or stops when policy
+// is empty and lets every job it had stopped run again
+func (jm *JobManager) SetSchedPolicy(policy SchedPolicy, quantum time.Duration, slots int) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if s := jm.sched; s != nil {
+		s.timer.Stop()
+		for job := range s.paused {
+			jm.resumeLocked(job)
+		}
+		jm.sched = nil
+	}
+	if policy == "" {
+		return
+	}
+
+	s := &jobScheduler{
+		policy:   policy,
+		quantum:  quantum,
+		slots:    slots,
+		paused:   make(map[*types.Job]bool),
+		vruntime: make(map[*types.Job]float64),
+	}
+	jm.sched = s
+	s.timer = time.AfterFunc(quantum, func() { jm.tick(s) })
+	jm.balanceLocked()
+}
+
+// managedLocked reports whether the scheduler is in charge of a job: a
+// background job in the table with a process the user has not stopped. The
+// caller must hold the lock.
+func (jm *JobManager) managedLocked(job *types.Job) bool {
+	return job.Background && jm.jobs[job.ID] == job && job.PID != 0 && jm.procs[job.PID] == job &&
+		(job.Status == types.JobStatusRunning || job.Status == types.JobStatusReady)
+}
+
+// balanceLocked stops and continues background jobs so that the ones the
+// policy picks are running and the rest wait their turn. The caller must
+// hold the lock.
+func (jm *JobManager) balanceLocked() {
+	s := jm.sched
+	if s == nil {
+		return
+	}
+
+	// Keep the turn order of the jobs still managed and add new ones at the
+	// back, with the fair share of the least served job so far
+	queued := make(map[*types.Job]bool, len(s.queue))
+	queue := s.queue[:0]
+	for _, job := range s.queue {
+		if jm.managedLocked(job) {
+			queue = append(queue, job)
+			queued[job] = true
+		}
+	}
+	var fresh []*types.Job
+	for _, job := range jm.jobs {
+		if !queued[job] && jm.managedLocked(job) {
+			fresh = append(fresh, job)
+		}
+	}
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].ID < fresh[j].ID })
+	least := math.Inf(1)
+	for _, job := range queue {
+		least = math.Min(least, s.vruntime[job])
+	}
+	if math.IsInf(least, 1) {
+		least = 0
+	}
+	for _, job := range fresh {
+		s.vruntime[job] = least
+		queue = append(queue, job)
+	}
+	s.queue = queue
+
+	// Forget jobs that finished, were stopped by the user or left the
+	// background. One still stopped by the scheduler is let go.
+	for job := range s.paused {
+		if !jm.managedLocked(job) {
+			jm.resumeLocked(job)
+		}
+	}
+	for job := range s.vruntime {
+		if !jm.managedLocked(job) {
+			delete(s.vruntime, job)
+		}
+	}
+
+	order := append([]*types.Job(nil), s.queue...)
+	switch s.policy {
+	case PolicyPriority:
+		sort.SliceStable(order, func(i, j int) bool { return order[i].Nice < order[j].Nice })
+	case PolicyFairShare:
+		sort.SliceStable(order, func(i, j int) bool { return s.vruntime[order[i]] < s.vruntime[order[j]] })
+	}
+
+	for i, job := range order {
+		switch {
+		case i < s.slots && s.paused[job]:
+			jm.resumeLocked(job)
+		case i >= s.slots && !s.paused[job]:
+			s.paused[job] = true
+			_ = syscall.Kill(-job.PGID, syscall.SIGSTOP)
+		}
+	}
+}
+
+// resumeLocked continues a job the scheduler had stopped. The caller must
+// hold the lock.
+func (jm *JobManager) resumeLocked(job *types.Job) {
+	delete(jm.sched.paused, job)
+	if job.Status != types.JobStatusDone && job.PID != 0 {
+		_ = syscall.Kill(-job.PGID, syscall.SIGCONT)
+	}
+}
+
+// tick ends a quantum: the jobs that ran are charged for it and go to the
+// back of the queue, and the next ones get their turn
+func (jm *JobManager) tick(s *jobScheduler) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if jm.sched != s {
+		return
+	}
+
+	var ran, waited []*types.Job
+	for _, job := range s.queue {
+		if jm.managedLocked(job) && !s.paused[job] {
+			s.vruntime[job] += s.quantum.Seconds() * weight(job.Nice)
+			ran = append(ran, job)
+		} else {
+			waited = append(waited, job)
+		}
+	}
+	s.queue = append(waited, ran...)
+
+	jm.balanceLocked()
+	s.timer = time.AfterFunc(s.quantum, func() { jm.tick(s) })
+}
+
+// pausedLocked reports whether the scheduler stopped a job. The caller must
+// hold the lock.
+func (jm *JobManager) pausedLocked(job *types.Job) bool {
+	return jm.sched != nil && jm.sched.paused[job]
+}
+
+// releaseLocked takes a job the user stopped, continued or brought to the
+// foreground out of the scheduler's hands. The caller must hold the lock.
+func (jm *JobManager) releaseLocked(job *types.Job) {
+	if jm.sched != nil {
+		delete(jm.sched.paused, job)
+	}
+}
+
+// Renice changes the niceness of a job's processes and returns the old one
+func (jm *JobManager) Renice(jobID, nice int) (int, error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job, exists := jm.jobs[jobID]
+	if !exists {
+		return 0, fmt.Errorf("job %d not found", jobID)
+	}
+	if job.Status == types.JobStatusDone {
+		return 0, fmt.Errorf("job %d has already completed", jobID)
+	}
+
+	old := job.Nice
+	// A job waiting to run takes its niceness when it is launched
+	if job.PID != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PGRP, job.PGID, nice); err != nil {
+			return old, fmt.Errorf("job %d: %v", jobID, err)
+		}
+	}
+	job.Nice = nice
+	jm.balanceLocked()
+	return old, nil
+}
+
+// niceOf returns the niceness of a process
+func niceOf(pid int) (int, error) {
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, pid)
+	if err != nil {
+		return 0, err
+	}
+	return niceFromPriority(prio), nil
+}
+
+// parseNice reads a niceness and checks that it may be used
+func parseNice(spec string, current int) (int, error) {
+	nice, err := strconv.Atoi(spec)
+	if err != nil || nice < -20 || nice > 19 {
+		return 0, fmt.Errorf("%s: niceness must be a number from -20 to 19", spec)
+	}
+	if nice < current && os.Geteuid() != 0 {
+		return 0, fmt.Errorf("%d: only root can lower niceness", nice)
+	}
+	return nice, nil
+}
+
+func (ch *CommandHandler) handleSched(args []string) error {
+	usage := "Usage: sched [off | rr | priority | fair] [-q quantum] [-n jobs]"
+
+	if len(args) == 1 {
+		return ch.printSched()
+	}
+
+	policy := SchedPolicy(args[1])
+	switch policy {
+	case "off":
+		ch.jobManager.SetSchedPolicy("", 0, 0)
+		fmt.Println("sched: background jobs run freely")
+		return nil
+	case PolicyRoundRobin, PolicyPriority, PolicyFairShare:
+	default:
+		return fmt.Errorf("sched: %s: unknown policy\n%s", args[1], usage)
+	}
+
+	quantum, slots := defaultQuantum, runtime.NumCPU()
+	rest := args[2:]
+	for len(rest) > 0 {
+		if len(rest) < 2 {
+			return fmt.Errorf("sched: %s: option requires an argument\n%s", rest[0], usage)
+		}
+		var err error
+		switch rest[0] {
+		case "-q":
+			quantum, err = parseDuration(rest[1])
+			if err == nil && quantum < minQuantum {
+				err = fmt.Errorf("%s: quantum must be at least %v", rest[1], minQuantum)
+			}
+		case "-n":
+			slots, err = parsePositive(rest[1])
+		default:
+			return fmt.Errorf("sched: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("sched: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	ch.jobManager.SetSchedPolicy(policy, quantum, slots)
+	fmt.Printf("sched: %s, quantum %v, %d job(s) at a time\n", policy, quantum, slots)
+	return nil
+}
+
+// printSched shows the policy and the jobs it manages
+func (ch *CommandHandler) printSched() error {
+	policy, quantum, slots, jobs := ch.jobManager.SchedState()
+	if policy == "" {
+		fmt.Println("sched: off (background jobs run freely)")
+		return nil
+	}
+	fmt.Printf("sched: %s, quantum %v, %d job(s) at a time\n", policy, quantum, slots)
+	for _, job := range jobs {
+		_, cpu := groupUsage(job.PGID)
+		fmt.Printf("[%d] %-8s nice %3d  cpu %8s  %s\n", job.ID, job.Status, job.Nice, formatSeconds(cpu, 2), job.Command)
+	}
+	return nil
+}
+
+// SchedState returns the scheduling policy and the jobs it manages, in
+// turn order
+func (jm *JobManager) SchedState() (SchedPolicy, time.Duration, int, []*types.Job) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	s := jm.sched
+	if s == nil {
+		return "", 0, 0, nil
+	}
+	jobs := make([]*types.Job, len(s.queue))
+	for i, job := range s.queue {
+		jobs[i] = snapshot(job)
+	}
+	return s.policy, s.quantum, s.slots, jobs
+}
+
+func (ch *CommandHandler) handleNice(args []string, background bool) error {
+	usage := "Usage: nice [-n adjustment] command [args...] [&]"
+
+	current, err := niceOf(0)
+	if err != nil {
+		return fmt.Errorf("nice: %v", err)
+	}
+	if len(args) == 1 {
+		fmt.Println(current)
+		return nil
+	}
+
+	adjustment := strconv.Itoa(defaultNice)
+	rest := args[1:]
+	switch {
+	case rest[0] == "-n":
+		if len(rest) < 2 {
+			return fmt.Errorf("nice: -n: option requires an argument\n%s", usage)
+		}
+		adjustment, rest = rest[1], rest[2:]
+	case strings.HasPrefix(rest[0], "-") && len(rest[0]) > 1:
+		// The traditional form, nice -5 command
+		adjustment, rest = rest[0][1:], rest[1:]
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("nice: missing command\n%s", usage)
+	}
+
+	n, err := strconv.Atoi(adjustment)
+	if err != nil {
+		return fmt.Errorf("nice: %s: invalid adjustment", adjustment)
+	}
+	nice, err := parseNice(strconv.Itoa(max(-20, min(19, current+n))), current)
+	if err != nil {
+		return fmt.Errorf("nice: %v", err)
+	}
+
+	_, err = ch.startPolicyJob("nice", rest, JobOptions{Background: background, Nice: nice})
+	return err
+}
+
+func (ch *CommandHandler) handleRenice(args []string) error {
+	usage := "Usage: renice [-n] priority %job|pid..."
+
+	rest := args[1:]
+	if len(rest) > 0 && rest[0] == "-n" {
+		rest = rest[1:]
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("renice: missing priority or job\n%s", usage)
+	}
+
+	var failed []string
+	for _, target := range rest[1:] {
+		if err := ch.renice(rest[0], target); err != nil {
+			fmt.Fprintf(os.Stderr, "renice: %v\n", err)
+			failed = append(failed, target)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("renice: failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// renice sets the niceness of a job, or of any process given by PID
+func (ch *CommandHandler) renice(spec, target string) error {
+	job, err := ch.resolveJobOrPID(target)
+	if err != nil {
+		pid, convErr := strconv.Atoi(target)
+		if convErr != nil {
+			return err
+		}
+		current, err := niceOf(pid)
+		if err != nil {
+			return fmt.Errorf("%d: %v", pid, err)
+		}
+		nice, err := parseNice(spec, current)
+		if err != nil {
+			return err
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice); err != nil {
+			return fmt.Errorf("%d: %v", pid, err)
+		}
+		fmt.Printf("%d (process ID) old priority %d, new priority %d\n", pid, current, nice)
+		return nil
+	}
+
+	nice, err := parseNice(spec, job.Nice)
+	if err != nil {
+		return err
+	}
+	old, err := ch.jobManager.Renice(job.ID, nice)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[%d] old priority %d, new priority %d\n", job.ID, old, nice)
+	return nil
+}
@@ -0,0 +1,345 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// Defaults for the timeout and retry built-ins
+const (
+	defaultKillAfter = 5 * time.Second
+	defaultAttempts  = 3
+	defaultBackoff   = time.Second
+	maxBackoff       = 10 * time.Minute
+)
+
+// jobControl holds how a job is launched and its timeout and retry policy
+type jobControl struct {
+	opts      JobOptions
+	started   time.Time   // start of the current attempt
+	timer     *time.Timer // pending timeout, kill or relaunch
+	cancelled bool        // the user killed the job, so do not retry it
+}
+
+// armLocked starts the timeout of the attempt that was just launched. The
+// caller must hold the lock.
+func (jm *JobManager) armLocked(job *types.Job, control *jobControl) {
+	control.started = time.Now()
+	job.TimedOut = false
+	job.Deadline = nil
+	if control.opts.Timeout <= 0 {
+		return
+	}
+
+	pid := job.PID
+	deadline := control.started.Add(control.opts.Timeout)
+	job.Deadline = &deadline
+	control.timer = time.AfterFunc(control.opts.Timeout, func() { jm.expire(job, pid) })
+}
+
+// expire signals an attempt that outlived its deadline and, if it is still
+// around once the grace period is over, kills it
+func (jm *JobManager) expire(job *types.Job, pid int) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	control := jm.controls[job]
+	if control == nil || jm.procs[pid] != job {
+		return
+	}
+
+	sig := control.opts.TimeoutSignal
+	if sig == 0 {
+		sig = syscall.SIGTERM
+	}
+	job.TimedOut = true
+	_ = syscall.Kill(-job.PGID, sig)
+	if job.Status == types.JobStatusStopped || job.Status == types.JobStatusReady {
+		_ = syscall.Kill(-job.PGID, syscall.SIGCONT)
+	}
+
+	if control.opts.KillAfter > 0 {
+		control.timer = time.AfterFunc(control.opts.KillAfter, func() {
+			jm.mu.Lock()
+			defer jm.mu.Unlock()
+			if jm.procs[pid] == job {
+				_ = syscall.Kill(-job.PGID, syscall.SIGKILL)
+			}
+		})
+	}
+}
+
+// retryLocked records the attempt that just ended and, if it failed and
+// attempts are left, schedules the next one. It reports whether the job
+// will run again. The caller must hold the lock.
+func (jm *JobManager) retryLocked(job *types.Job) bool {
+	control := jm.controls[job]
+	if control == nil {
+		return false
+	}
+	if control.timer != nil {
+		control.timer.Stop()
+	}
+	job.Deadline = nil
+
+	if control.opts.Attempts <= 1 {
+		return false
+	}
+	job.Attempts = append(job.Attempts, attemptOf(job, control))
+
+	attempt := len(job.Attempts)
+	if job.ExitCode == 0 || control.cancelled || attempt >= control.opts.Attempts {
+		return false
+	}
+
+	delay := control.opts.Backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	if jm.foreground.Load() == job {
+		jm.terminal.reclaim()
+		fmt.Printf("retry: attempt %d/%d failed (%s); retrying in %v\n", attempt, control.opts.Attempts,
+			outcomeText(job.ExitCode, job.Signal, job.TimedOut, false), delay)
+	}
+
+	jm.waitUntilLocked(job, control, time.Now().Add(delay))
+	return true
+}
+
+// attemptOf records the run of a job that just ended
+func attemptOf(job *types.Job, control *jobControl) types.JobAttempt {
+	return types.JobAttempt{
+		PID:       job.PID,
+		StartTime: control.started,
+		EndTime:   time.Now(),
+		ExitCode:  job.ExitCode,
+		Signal:    job.Signal,
+		TimedOut:  job.TimedOut,
+	}
+}
+
+// waitUntilLocked parks a job without a process until it is relaunched at
+// next. The caller must hold the lock.
+func (jm *JobManager) waitUntilLocked(job *types.Job, control *jobControl, next time.Time) {
+	job.Status = types.JobStatusWaiting
+	job.NextRun = &next
+	job.PID = 0
+	control.timer = time.AfterFunc(time.Until(next), func() { jm.relaunch(job) })
+}
+
+// relaunch starts the next run of a job that is waiting to be retried or
+// for its scheduled time
+func (jm *JobManager) relaunch(job *types.Job) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	// The job may have been cancelled while it waited
+	control := jm.controls[job]
+	if control == nil || job.Status != types.JobStatusWaiting {
+		return
+	}
+
+	job.ExitCode = 0
+	job.Signal = 0
+	if err := jm.spawnLocked(job, control.opts); err != nil {
+		fmt.Fprintf(os.Stderr, "[%d] %v\n", job.ID, err)
+		job.ExitCode = 127
+		jm.finishLocked(job)
+	}
+	jm.notifyLocked()
+}
+
+// cancelLocked gives up on a job that is waiting to run, as if sig had
+// killed it. The caller must hold the lock.
+func (jm *JobManager) cancelLocked(job *types.Job, sig syscall.Signal) {
+	if control := jm.controls[job]; control != nil && control.timer != nil {
+		control.timer.Stop()
+	}
+	job.Signal = sig
+	job.ExitCode = 128 + int(sig)
+	job.TimedOut = false
+	jm.finishLocked(job)
+	jm.notifyLocked()
+}
+
+// isTerminating reports whether a signal sent by the user means the job
+// should not be run again
+func isTerminating(sig syscall.Signal) bool {
+	switch sig {
+	case syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM:
+		return true
+	}
+	return false
+}
+
+// parseDuration accepts Go durations (1m30s) as well as the forms timeout(1)
+// takes: a number of seconds with an optional s, m, h or d suffix
+func parseDuration(spec string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"": time.Second, "s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour,
+	}
+	number := strings.TrimRight(spec, "smhd")
+	if unit, ok := units[spec[len(number):]]; ok {
+		if n, err := strconv.ParseFloat(number, 64); err == nil && n >= 0 {
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(spec)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: invalid duration", spec)
+	}
+	return d, nil
+}
+
+func (ch *CommandHandler) handleTimeout(args []string, background bool) error {
+	usage := "Usage: timeout [-s signal] [-k duration] duration command [args...] [&]"
+
+	opts := JobOptions{Background: background, KillAfter: defaultKillAfter}
+	rest := args[1:]
+options:
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		switch rest[0] {
+		case "-s", "-k":
+			if len(rest) < 2 {
+				return fmt.Errorf("timeout: %s: option requires an argument\n%s", rest[0], usage)
+			}
+			if rest[0] == "-s" {
+				sig, err := ParseSignal(rest[1])
+				if err != nil || sig == 0 {
+					return fmt.Errorf("timeout: %s: invalid signal", rest[1])
+				}
+				opts.TimeoutSignal = sig
+			} else {
+				d, err := parseDuration(rest[1])
+				if err != nil {
+					return fmt.Errorf("timeout: -k: %v", err)
+				}
+				opts.KillAfter = d
+			}
+			rest = rest[2:]
+		case "--":
+			rest = rest[1:]
+			break options
+		default:
+			return fmt.Errorf("timeout: %s: invalid option\n%s", rest[0], usage)
+		}
+	}
+
+	if len(rest) < 2 {
+		return fmt.Errorf("timeout: missing duration or command\n%s", usage)
+	}
+	timeout, err := parseDuration(rest[0])
+	if err != nil {
+		return fmt.Errorf("timeout: %v", err)
+	}
+	opts.Timeout = timeout
+
+	job, err := ch.startPolicyJob("timeout", rest[1:], opts)
+	if err != nil || job == nil {
+		return err
+	}
+	if job.TimedOut {
+		return fmt.Errorf("timeout: %s: timed out after %v", job.Args[0], timeout)
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleRetry(args []string, background bool) error {
+	usage := "Usage: retry [-n attempts] [-backoff duration] [-timeout duration] command [args...] [&]"
+
+	opts := JobOptions{
+		Background: background,
+		Attempts:   defaultAttempts,
+		Backoff:    defaultBackoff,
+		KillAfter:  defaultKillAfter,
+	}
+	rest := args[1:]
+options:
+	for len(rest) > 0 && strings.HasPrefix(rest[0], "-") {
+		if rest[0] == "--" {
+			rest = rest[1:]
+			break options
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("retry: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		var err error
+		switch rest[0] {
+		case "-n":
+			opts.Attempts, err = parsePositive(rest[1])
+		case "-backoff":
+			opts.Backoff, err = parseDuration(rest[1])
+		case "-timeout":
+			opts.Timeout, err = parseDuration(rest[1])
+		default:
+			return fmt.Errorf("retry: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("retry: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	if len(rest) == 0 {
+		return fmt.Errorf("retry: missing command\n%s", usage)
+	}
+
+	job, err := ch.startPolicyJob("retry", rest, opts)
+	if err != nil || job == nil {
+		return err
+	}
+	if job.Status != types.JobStatusDone {
+		return nil
+	}
+
+	attempts := len(job.Attempts)
+	if attempts == 0 {
+		attempts = 1
+	}
+	if job.ExitCode != 0 {
+		return fmt.Errorf("retry: %s: giving up after %d attempt(s), last status: %s",
+			job.Args[0], attempts, statusText(job, true))
+	}
+	if attempts > 1 {
+		fmt.Printf("retry: %s succeeded on attempt %d/%d\n", job.Args[0], attempts, opts.Attempts)
+	}
+	return nil
+}
+
+// startPolicyJob runs a command under a timeout, retry or dependency policy. Background
+// jobs are started and left to the job manager; foreground jobs are waited
+// for and their final state returned.
+func (ch *CommandHandler) startPolicyJob(name string, command []string, opts JobOptions) (*types.Job, error) {
+	if ch.parser.IsBuiltinCommand(command[0]) {
+		return nil, fmt.Errorf("%s: %s: cannot be used with a built-in command", name, command[0])
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return nil, fmt.Errorf("%s: %s: command not found", name, command[0])
+	}
+
+	if opts.Background {
+		if _, err := ch.jobManager.StartJob(command, opts); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return nil, nil
+	}
+
+	job, err := ch.jobManager.RunForeground(command, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return job, nil
+}
@@ -0,0 +1,14 @@
+//go:build darwin || dragonfly || freebsd || netbsd
+
+package shell
+
+import "syscall"
+
+// memoryUlimits are the memory limits ulimit manages
+var memoryUlimits = []ulimitResource{
+	{'v', syscall.RLIMIT_AS, 1024, "virtual memory (kbytes)"},
+}
+
+// memoryRlimit is the resource limit that enforces limit --mem. There is no
+// /proc to watch the job's resident size in, so --mem limits the address space.
+const memoryRlimit = syscall.RLIMIT_AS
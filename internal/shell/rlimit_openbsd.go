@@ -0,0 +1,14 @@
+package shell
+
+import "syscall"
+
+// memoryUlimits are the memory limits ulimit manages. OpenBSD has no
+// address space limit, but its data size limit covers anonymous mappings
+// as well as the heap.
+var memoryUlimits = []ulimitResource{
+	{'d', syscall.RLIMIT_DATA, 1024, "data seg size (kbytes)"},
+}
+
+// memoryRlimit is the resource limit that enforces limit --mem. There is no
+// /proc to watch the job's resident size in, so --mem limits the data size.
+const memoryRlimit = syscall.RLIMIT_DATA
@@ -0,0 +1,175 @@
+package shell
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// maxRunHistory bounds how many past runs a recurring job remembers
+const maxRunHistory = 50
+
+// Schedule decides when a scheduled job runs
+type Schedule interface {
+	// Next returns the first run time after t, or the zero time when the
+	// job should not run again
+	Next(t time.Time) time.Time
+
+	// String describes the schedule for job listings
+	String() string
+}
+
+// onceSchedule runs a job a single time
+type onceSchedule struct {
+	at time.Time
+}
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if s.at.After(t) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+func (s onceSchedule) String() string {
+	now := time.Now()
+	if s.at.Year() == now.Year() && s.at.YearDay() == now.YearDay() {
+		return "at " + s.at.Format("15:04:05")
+	}
+	return "at " + s.at.Format("2006-01-02 15:04")
+}
+
+// everySchedule runs a job repeatedly at a fixed interval
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+func (s everySchedule) String() string {
+	return "every " + s.interval.String()
+}
+
+// scheduleLocked adds a background job that waits for its first scheduled
+// run. The caller must hold the lock.
+func (jm *JobManager) scheduleLocked(job *types.Job, opts JobOptions) error {
+	next := opts.Schedule.Next(time.Now())
+	if next.IsZero() {
+		return fmt.Errorf("%s: time has already passed", opts.Schedule)
+	}
+
+	opts.Background = true
+	control := &jobControl{opts: opts}
+	jm.controls[job] = control
+	job.Background = true
+	job.Schedule = opts.Schedule.String()
+	jm.addJob(job)
+	jm.waitUntilLocked(job, control, next)
+
+	if !opts.Quiet {
+		fmt.Printf("[%d] %s, next run %s\n", job.ID, job.Schedule, next.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// rescheduleLocked records the run of a scheduled job that just ended and
+// parks the job until its next run. It reports whether there is one. The
+// caller must hold the lock.
+func (jm *JobManager) rescheduleLocked(job *types.Job) bool {
+	control := jm.controls[job]
+	if control == nil || control.opts.Schedule == nil {
+		return false
+	}
+
+	job.Attempts = append(job.Attempts, attemptOf(job, control))
+	if len(job.Attempts) > maxRunHistory {
+		job.Attempts = job.Attempts[len(job.Attempts)-maxRunHistory:]
+	}
+
+	if control.cancelled {
+		return false
+	}
+	next := control.opts.Schedule.Next(time.Now())
+	if next.IsZero() {
+		return false
+	}
+	jm.waitUntilLocked(job, control, next)
+	return true
+}
+
+// parseClock reads the time given to at: a time of day (the next time the
+// clock shows it) or a date with an optional time
+func parseClock(spec string) (time.Time, error) {
+	now := time.Now()
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.ParseInLocation(layout, spec, time.Local); err == nil {
+			at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+			if !at.After(now) {
+				at = at.AddDate(0, 0, 1)
+			}
+			return at, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, spec, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s: expected a time (14:30) or a date (2006-01-02[T14:30])", spec)
+}
+
+// startScheduled checks a scheduled command and hands it to the job manager
+func (ch *CommandHandler) startScheduled(name string, command []string, schedule Schedule) error {
+	if len(command) == 0 {
+		return fmt.Errorf("%s: missing command", name)
+	}
+	if ch.parser.IsBuiltinCommand(command[0]) {
+		return fmt.Errorf("%s: %s: cannot be used with a built-in command", name, command[0])
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return fmt.Errorf("%s: %s: command not found", name, command[0])
+	}
+
+	if _, err := ch.jobManager.StartJob(command, JobOptions{Schedule: schedule}); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleAt(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("at: missing time or command\nUsage: at HH:MM[:SS] | YYYY-MM-DD[THH:MM] command [args...]")
+	}
+	at, err := parseClock(args[1])
+	if err != nil {
+		return fmt.Errorf("at: %v", err)
+	}
+	return ch.startScheduled("at", args[2:], onceSchedule{at: at})
+}
+
+func (ch *CommandHandler) handleEvery(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("every: missing interval or command\nUsage: every interval command [args...]")
+	}
+	interval, err := parseDuration(args[1])
+	if err != nil {
+		return fmt.Errorf("every: %v", err)
+	}
+	if interval < time.Second {
+		return fmt.Errorf("every: %s: interval must be at least a second", args[1])
+	}
+	return ch.startScheduled("every", args[2:], everySchedule{interval: interval})
+}
+
+// handleDelayed implements 'after duration command': run once, that long from now
+func (ch *CommandHandler) handleDelayed(args []string) error {
+	delay, err := parseDuration(args[1])
+	if err != nil {
+		return fmt.Errorf("after: expected job specs or a delay: %v", err)
+	}
+	return ch.startScheduled("after", args[2:], onceSchedule{at: time.Now().Add(delay)})
+}
@@ -1,7 +1,6 @@
 package shell
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +10,8 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
 )
 
 // Shell represents the main shell instance
@@ -25,7 +26,15 @@ type Shell struct {
 // NewShell creates a new shell instance
 func NewShell() *Shell {
 	jobManager := NewJobManager()
+	if spec := os.Getenv(jobHistoryEnv); spec != "" && spec != "off" {
+		if path, err := jobStorePath(spec); err == nil {
+			jobManager.SetHistory(path)
+		} else {
+			fmt.Fprintf(os.Stderr, "job history: %v\n", err)
+		}
+	}
 	commandHandler := NewCommandHandler(jobManager)
+	commandHandler.loginRequired = loginEnabled(os.Getenv(loginEnv))
 	parser := NewCommandParser()
 
 	return &Shell{
@@ -37,16 +46,33 @@ func NewShell() *Shell {
 	}
 }
 
+// RequireLogin makes the shell ask for a login before running commands, and
+// again after each logout
+func (s *Shell) RequireLogin() {
+	s.commandHandler.loginRequired = true
+}
+
 // Run starts the main shell loop
 func (s *Shell) Run() {
 	s.setupSignalHandlers()
 	s.printWelcome()
 
-	scanner := bufio.NewScanner(os.Stdin)
+	if s.commandHandler.loginRequired && !s.commandHandler.promptLogin() {
+		s.shutdown()
+		return
+	}
+	s.jobManager.Reattach()
 
 	for s.running {
+		if s.commandHandler.loginRequired && s.commandHandler.session == nil && !s.commandHandler.promptLogin() {
+			break
+		}
+		s.jobManager.NotifyCompletedJobs()
 		s.displayPrompt()
 
+		// Built-ins such as parallel read stdin too and may replace the
+		// scanner, so it is fetched afresh for each command
+		scanner := s.commandHandler.stdin()
 		if !scanner.Scan() {
 			break
 		}
@@ -65,7 +91,7 @@ func (s *Shell) Run() {
 		}
 	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
+	if err := s.commandHandler.stdin().Err(); err != nil && err != io.EOF {
 		fmt.Printf("\033[31mError reading input:\033[0m %v\n", err)
 	}
 
@@ -95,18 +121,35 @@ func (s *Shell) processInput(input string) error {
 		return fmt.Errorf("%s: command not found", parsed.Command)
 	}
 
-	return fmt.Errorf("%s: command not found (only built-in commands are supported)", parsed.Command)
+	if parsed.Background {
+		_, err := s.jobManager.StartJob(parsed.Args, JobOptions{Background: true})
+		return err
+	}
+	_, err := s.jobManager.RunForeground(parsed.Args, JobOptions{})
+	return err
 }
 
-// setupSignalHandlers sets up signal handlers for graceful shutdown
+// setupSignalHandlers sets up signal handlers for graceful shutdown.
+// Keyboard signals are forwarded to the foreground job's process group;
+// the shell itself never exits on them.
 func (s *Shell) setupSignalHandlers() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGQUIT, syscall.SIGTSTP, syscall.SIGTERM)
 
 	go func() {
-		<-c
-		fmt.Println("\nReceived interrupt signal. Use 'exit' to quit the shell.")
-		// Don't exit immediately, let user decide
+		for sig := range c {
+			if sig != syscall.SIGTERM && s.jobManager.SignalForeground(sig.(syscall.Signal)) {
+				continue
+			}
+			if sig == syscall.SIGQUIT || sig == syscall.SIGTSTP {
+				continue
+			}
+			if sig == syscall.SIGINT {
+				s.jobManager.Interrupt()
+			}
+			fmt.Println("\nReceived interrupt signal. Use 'exit' to quit the shell.")
+			// Don't exit immediately, let user decide
+		}
 	}()
 }
 
@@ -128,6 +171,10 @@ func (s *Shell) displayPrompt() {
 	now := time.Now()
 	timeStr := now.Format("15:04:05")
 
+	if user := s.commandHandler.currentUser(); user != "" {
+		fmt.Printf("[%s@shell:%s %s]$ ", user, dir, timeStr)
+		return
+	}
 	fmt.Printf("[shell:%s %s]$ ", dir, timeStr)
 }
 
@@ -159,15 +206,25 @@ func (s *Shell) shutdown() {
 		fmt.Printf("Terminating %d active job(s)...\n", len(jobs))
 
 		for _, job := range jobs {
-			if job.Status != "Done" {
+			if job.Status != types.JobStatusDone && !job.NoHangup {
 				fmt.Printf("Killing job [%d]: %s\n", job.ID, job.Command)
 				s.jobManager.KillJob(job.ID)
 			}
 		}
 
-		// Give processes time to terminate
+		// Give processes time to terminate, then force any that ignored SIGTERM
 		time.Sleep(100 * time.Millisecond)
+		for _, job := range s.jobManager.GetAllJobs() {
+			if job.Status != types.JobStatusDone && !job.NoHangup {
+				s.jobManager.SignalJob(job.ID, syscall.SIGKILL)
+			}
+		}
+	}
+
+	if saved := s.jobManager.SaveDetached(); saved > 0 {
+		fmt.Printf("Saved %d running job(s); they will be reattached next time\n", saved)
 	}
+	s.jobManager.ClearJobLogs(true)
 
 	fmt.Println("Goodbye!")
 }
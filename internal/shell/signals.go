@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signalNames maps signal names, without the SIG prefix, to signals
+var signalNames = map[string]syscall.Signal{
+	"HUP":    syscall.SIGHUP,
+	"INT":    syscall.SIGINT,
+	"QUIT":   syscall.SIGQUIT,
+	"ILL":    syscall.SIGILL,
+	"TRAP":   syscall.SIGTRAP,
+	"ABRT":   syscall.SIGABRT,
+	"BUS":    syscall.SIGBUS,
+	"FPE":    syscall.SIGFPE,
+	"KILL":   syscall.SIGKILL,
+	"USR1":   syscall.SIGUSR1,
+	"SEGV":   syscall.SIGSEGV,
+	"USR2":   syscall.SIGUSR2,
+	"PIPE":   syscall.SIGPIPE,
+	"ALRM":   syscall.SIGALRM,
+	"TERM":   syscall.SIGTERM,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"STOP":   syscall.SIGSTOP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+	"VTALRM": syscall.SIGVTALRM,
+	"PROF":   syscall.SIGPROF,
+	"WINCH":  syscall.SIGWINCH,
+	"IO":     syscall.SIGIO,
+	"SYS":    syscall.SIGSYS,
+}
+
+// ParseSignal converts a signal name (TERM, SIGTERM, term) or number into a
+// signal. Signal 0 is accepted since it only checks that a process exists.
+func ParseSignal(spec string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n == 0 {
+			return 0, nil
+		}
+		if _, ok := SignalName(syscall.Signal(n)); !ok {
+			return 0, fmt.Errorf("%s: invalid signal specification", spec)
+		}
+		return syscall.Signal(n), nil
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	sig, ok := signalNames[name]
+	if !ok {
+		return 0, fmt.Errorf("%s: invalid signal specification", spec)
+	}
+	return sig, nil
+}
+
+// SignalName returns the SIG-prefixed name of a signal
+func SignalName(sig syscall.Signal) (string, bool) {
+	for name, s := range signalNames {
+		if s == sig {
+			return "SIG" + name, true
+		}
+	}
+	return fmt.Sprintf("signal %d", int(sig)), false
+}
+
+// ListSignals prints all known signals in number order, as kill -l does
+func ListSignals() {
+	sigs := make([]syscall.Signal, 0, len(signalNames))
+	for _, sig := range signalNames {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i] < sigs[j] })
+
+	for i, sig := range sigs {
+		name, _ := SignalName(sig)
+		fmt.Printf("%2d) %-10s", int(sig), name)
+		if (i+1)%5 == 0 || i == len(sigs)-1 {
+			fmt.Println()
+		}
+	}
+}
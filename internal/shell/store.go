@@ -0,0 +1,559 @@
+package shell
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// jobHistoryEnv names the environment variable that turns on the job history
+// store at startup. It holds a file path, or "on" for the default location.
+const jobHistoryEnv = "ASH_JOB_HISTORY"
+
+// reattachPollInterval is how often a reattached job is checked for exit,
+// since only its parent can wait for it
+const reattachPollInterval = 500 * time.Millisecond
+
+// jobStore appends job records to a JSON lines file. Finished jobs are
+// queued and written by a goroutine of its own so that the job table is
+// never held up by the disk.
+type jobStore struct {
+	path string
+
+	mu      sync.Mutex
+	idle    *sync.Cond        // signalled when the queue has been written
+	queued  []types.JobRecord // records waiting to be written
+	writing bool
+}
+
+func newJobStore(path string) *jobStore {
+	s := &jobStore{path: path}
+	s.idle = sync.NewCond(&s.mu)
+	return s
+}
+
+// jobStorePath resolves the value of ASH_JOB_HISTORY or a --persist argument
+// to a file path
+func jobStorePath(spec string) (string, error) {
+	switch strings.ToLower(spec) {
+	case "", "on", "1", "yes", "true":
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot find home directory: %v", err)
+		}
+		return filepath.Join(homeDir, ".advanced-shell", "jobs.jsonl"), nil
+	}
+
+	if strings.HasPrefix(spec, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot find home directory: %v", err)
+		}
+		spec = filepath.Join(homeDir, spec[2:])
+	}
+	return filepath.Abs(spec)
+}
+
+// append writes records to the end of the store
+func (s *jobStore) append(records ...types.JobRecord) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queue schedules a record to be appended without waiting for the write
+func (s *jobStore) queue(record types.JobRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued = append(s.queued, record)
+	if !s.writing {
+		s.writing = true
+		go s.writeQueued()
+	}
+}
+
+// writeQueued appends queued records until none are left
+func (s *jobStore) writeQueued() {
+	for {
+		s.mu.Lock()
+		records := s.queued
+		s.queued = nil
+		if len(records) == 0 {
+			s.writing = false
+			s.idle.Broadcast()
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		if err := s.append(records...); err != nil {
+			fmt.Fprintf(os.Stderr, "job history: %v\n", err)
+		}
+	}
+}
+
+// flush waits until every queued record has been written
+func (s *jobStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.writing {
+		s.idle.Wait()
+	}
+}
+
+// load reads every record in the store, keeping only the latest record of
+// each process. Lines that cannot be parsed are skipped.
+func (s *jobStore) load() ([]types.JobRecord, error) {
+	s.flush()
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []types.JobRecord
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record types.JobRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%d@%d", record.PID, record.StartTime.UnixNano())
+		if i, seen := index[key]; seen {
+			records[i] = record
+			continue
+		}
+		index[key] = len(records)
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// recordOf converts a job to its stored form
+func recordOf(job *types.Job) types.JobRecord {
+	return types.JobRecord{
+		PID:       job.PID,
+		Command:   job.Command,
+		Args:      job.Args,
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Status:    job.Status,
+		ExitCode:  job.ExitCode,
+		Signal:    job.Signal,
+		TimedOut:  job.TimedOut,
+		Cancelled: job.Cancelled,
+		OverLimit: job.OverLimit,
+		Usage:     job.Usage,
+	}
+}
+
+// jobOf turns a stored record back into a job so it can be described with
+// the same helpers as live jobs
+func jobOf(record types.JobRecord) *types.Job {
+	return &types.Job{
+		PID:       record.PID,
+		PGID:      record.PID,
+		Command:   record.Command,
+		Args:      record.Args,
+		Status:    record.Status,
+		StartTime: record.StartTime,
+		EndTime:   record.EndTime,
+		ExitCode:  record.ExitCode,
+		Signal:    record.Signal,
+		TimedOut:  record.TimedOut,
+		Cancelled: record.Cancelled,
+		OverLimit: record.OverLimit,
+		Usage:     record.Usage,
+	}
+}
+
+// SetHistory starts saving finished jobs to the store at path, or stops when
+// path is empty
+func (jm *JobManager) SetHistory(path string) {
+	jm.mu.Lock()
+	previous := jm.store
+	jm.store = nil
+	if path != "" {
+		jm.store = newJobStore(path)
+	}
+	jm.mu.Unlock()
+
+	// Finish writing to the old store before anything reads the new one
+	if previous != nil {
+		previous.flush()
+	}
+}
+
+// HistoryPath returns the path of the job history store, or "" when job
+// history is off
+func (jm *JobManager) HistoryPath() string {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if jm.store == nil {
+		return ""
+	}
+	return jm.store.path
+}
+
+// recordLocked queues a finished job to be saved to the history store. The
+// caller must hold the lock.
+func (jm *JobManager) recordLocked(job *types.Job) {
+	if jm.store == nil {
+		return
+	}
+	jm.store.queue(recordOf(job))
+}
+
+// SaveDetached records the jobs that are left running as the shell exits,
+// so the next session can reattach to them. It returns how many were saved.
+func (jm *JobManager) SaveDetached() int {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if jm.store == nil {
+		return 0
+	}
+	// The shell is about to exit, so jobs that finished must be saved first
+	jm.store.flush()
+
+	var records []types.JobRecord
+	for pid, job := range jm.procs {
+		// Only disowned jobs and those told to ignore hangups outlive the shell
+		if jm.jobs[job.ID] == job && !job.NoHangup {
+			continue
+		}
+		if job.Status == types.JobStatusDone || processExited(pid) {
+			continue
+		}
+		record := recordOf(job)
+		record.Detached = true
+		records = append(records, record)
+	}
+	if err := jm.store.append(records...); err != nil {
+		fmt.Fprintf(os.Stderr, "job history: %v\n", err)
+		return 0
+	}
+	return len(records)
+}
+
+// Reattach adds the jobs an earlier session left running back to the job
+// table. Jobs that have exited since are recorded as finished with an
+// unknown status.
+func (jm *JobManager) Reattach() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if jm.store == nil {
+		return
+	}
+	records, err := jm.store.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "job history: %v\n", err)
+		return
+	}
+
+	for _, record := range records {
+		if !record.Detached || record.Status == types.JobStatusDone {
+			continue
+		}
+
+		job := jobOf(record)
+		if !sameProcess(record.PID, record.Args) {
+			job.Status = types.JobStatusDone
+			job.ExitCode = -1
+			jm.recordLocked(job)
+			continue
+		}
+
+		if pgid, err := syscall.Getpgid(job.PID); err == nil {
+			job.PGID = pgid
+		}
+		job.Background = true
+		job.NoHangup = true
+		job.Reattached = true
+		jm.procs[job.PID] = job
+		jm.addJob(job)
+		fmt.Printf("[%d] %d reattached: %s\n", job.ID, job.PID, job.Command)
+		go jm.poll(job.PID)
+	}
+}
+
+// poll waits for a process this shell did not start to exit. It cannot
+// collect the exit status, so the job finishes with an unknown one.
+func (jm *JobManager) poll(pid int) {
+	for !processExited(pid) {
+		time.Sleep(reattachPollInterval)
+	}
+	jm.events <- jobEvent{pid: pid, err: syscall.ECHILD}
+}
+
+// processExited reports whether a process is gone or only a zombie waiting
+// for its parent to collect it
+func processExited(pid int) bool {
+	if syscall.Kill(pid, 0) == syscall.ESRCH {
+		return true
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesised command name, which may contain spaces
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// sameProcess reports whether pid is still running the given command, so a
+// reused PID is not mistaken for a saved job. Without /proc the PID is trusted.
+func sameProcess(pid int, args []string) bool {
+	if processExited(pid) {
+		return false
+	}
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return !os.IsNotExist(err) || !procAvailable()
+	}
+	return strings.TrimSuffix(string(cmdline), "\x00") == strings.Join(args, "\x00")
+}
+
+// procAvailable reports whether the system has a Linux-style /proc
+func procAvailable() bool {
+	_, err := os.Stat("/proc/self/cmdline")
+	return err == nil
+}
+
+// History returns the job records in the history store, oldest first
+func (jm *JobManager) History() ([]types.JobRecord, error) {
+	jm.mu.Lock()
+	store := jm.store
+	jm.mu.Unlock()
+
+	if store == nil {
+		path, err := jobStorePath("")
+		if err != nil {
+			return nil, err
+		}
+		store = newJobStore(path)
+	}
+
+	records, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].StartTime.Before(records[j].StartTime) })
+	return records, nil
+}
+
+// historyFilter selects records for jobs --history
+type historyFilter struct {
+	since, until time.Time
+	status       string
+	pattern      string
+	limit        int
+}
+
+// matches reports whether a record passes the filter
+func (f historyFilter) matches(record types.JobRecord) bool {
+	if !f.since.IsZero() && record.StartTime.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && record.StartTime.After(f.until) {
+		return false
+	}
+	if f.pattern != "" {
+		if strings.ContainsAny(f.pattern, "*?[") {
+			if ok, _ := filepath.Match(f.pattern, record.Command); !ok {
+				return false
+			}
+		} else if !strings.Contains(record.Command, f.pattern) {
+			return false
+		}
+	}
+
+	done := record.Status == types.JobStatusDone
+	switch f.status {
+	case "":
+		return true
+	case "running":
+		return !done
+	case "done", "ok":
+		return done && record.ExitCode == 0 && record.Cancelled == ""
+	case "failed":
+		return done && record.ExitCode != 0
+	case "killed":
+		return record.Signal != 0
+	case "timedout":
+		return record.TimedOut
+	case "cancelled":
+		return record.Cancelled != ""
+	}
+	return false
+}
+
+// historyStatuses lists the values jobs --history --status accepts
+var historyStatuses = []string{"running", "done", "ok", "failed", "killed", "timedout", "cancelled"}
+
+// parseTimeSpec reads a point in time given as a date, a date and time, a
+// time of day today, or a duration meaning that long ago
+func parseTimeSpec(spec string) (time.Time, error) {
+	now := time.Now()
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, spec, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.ParseInLocation(layout, spec, time.Local); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	if d, err := parseDuration(spec); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%s: expected a date (2006-01-02[T15:04]), a time (15:04) or a duration (2h)", spec)
+}
+
+func (ch *CommandHandler) handlePersist(args []string) error {
+	if len(args) == 0 {
+		if path := ch.jobManager.HistoryPath(); path != "" {
+			fmt.Printf("Job history is saved to %s\n", path)
+		} else {
+			fmt.Printf("Job history is off (enable with 'jobs --persist on' or %s=on)\n", jobHistoryEnv)
+		}
+		return nil
+	}
+	if len(args) > 2 {
+		return fmt.Errorf("jobs: --persist: too many arguments\nUsage: jobs --persist [on [file] | off]")
+	}
+
+	switch args[0] {
+	case "off":
+		ch.jobManager.SetHistory("")
+	case "on":
+		spec := ""
+		if len(args) == 2 {
+			spec = args[1]
+		}
+		path, err := jobStorePath(spec)
+		if err != nil {
+			return fmt.Errorf("jobs: --persist: %v", err)
+		}
+		ch.jobManager.SetHistory(path)
+		fmt.Printf("Finished jobs will be saved to %s\n", path)
+	default:
+		return fmt.Errorf("jobs: --persist: expected on or off\nUsage: jobs --persist [on [file] | off]")
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleJobHistory(args []string) error {
+	usage := "Usage: jobs --history [--since when] [--until when] [--status state] [--grep pattern] [-n count] [-v]"
+
+	var filter historyFilter
+	verbose := false
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-v" {
+			verbose = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return fmt.Errorf("jobs: %s: invalid option or missing argument\n%s", args[i], usage)
+		}
+
+		value := args[i+1]
+		var err error
+		switch args[i] {
+		case "--since":
+			filter.since, err = parseTimeSpec(value)
+		case "--until":
+			filter.until, err = parseTimeSpec(value)
+		case "--status":
+			filter.status = strings.ToLower(value)
+			err = fmt.Errorf("%s: unknown status (expected one of %s)", value, strings.Join(historyStatuses, ", "))
+			for _, status := range historyStatuses {
+				if filter.status == status {
+					err = nil
+				}
+			}
+		case "--grep":
+			filter.pattern = value
+		case "-n":
+			filter.limit, err = parsePositive(value)
+		default:
+			return fmt.Errorf("jobs: %s: invalid option\n%s", args[i], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("jobs: %s: %v", args[i], err)
+		}
+		i++
+	}
+
+	records, err := ch.jobManager.History()
+	if err != nil {
+		return fmt.Errorf("jobs: --history: %v", err)
+	}
+
+	var matched []types.JobRecord
+	for _, record := range records {
+		if filter.matches(record) {
+			matched = append(matched, record)
+		}
+	}
+	if filter.limit > 0 && len(matched) > filter.limit {
+		matched = matched[len(matched)-filter.limit:]
+	}
+
+	if len(matched) == 0 {
+		fmt.Println("No matching jobs in history")
+		return nil
+	}
+
+	fmt.Printf("%-19s  %9s  %-22s %-7s %s\n", "STARTED", "DURATION", "STATUS", "PID", "COMMAND")
+	for _, record := range matched {
+		job := jobOf(record)
+		duration := "-"
+		if record.EndTime != nil {
+			duration = formatSeconds(record.EndTime.Sub(record.StartTime), 3)
+		}
+		status := statusText(job, true)
+		if record.Detached && record.Status != types.JobStatusDone {
+			status = "Running (detached)"
+		}
+		fmt.Printf("%-19s  %9s  %-22s %-7d %s\n",
+			record.StartTime.Format("2006-01-02 15:04:05"), duration, status, record.PID, record.Command)
+
+		if verbose {
+			if record.Usage != nil {
+				fmt.Printf("      %s\n", usageText(job))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,466 @@
+package shell
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Su5ubedi/advanced-shell/internal/syncsim"
+	"github.com/Su5ubedi/advanced-shell/pkg/types"
+)
+
+// syncSummariseOver is how many actors of one role the report lists one by
+// one before summing them up in a single row
+const syncSummariseOver = 8
+
+// shellOwner owns the mutexes locked from the command line
+const shellOwner = "shell"
+
+func (ch *CommandHandler) handleSync(args []string) error {
+	usage := "Usage: sync problem [-t duration] [-step duration] [-starve duration] [-seed n] [-q] [-v] [options]\n" +
+		"       sync sem [list | create name [value] | wait name [timeout] | trywait name | post name | run name command... | delete name]\n" +
+		"       sync mutex [list | create name | lock name [timeout] | trylock name | unlock name | run name command... | delete name]\n" +
+		"Problems: producer-consumer [-p n] [-c n] [-b size] [-items n]\n" +
+		"          readers-writers [-r n] [-w n] [-prefer readers|writers|fair]\n" +
+		"          philosophers [-n n] [-strategy naive|ordered|waiter]\n" +
+		"          barber [-barbers n] [-chairs n] [-customers n]"
+
+	if len(args) < 2 {
+		return fmt.Errorf("sync: missing problem or primitive\n%s", usage)
+	}
+	switch args[1] {
+	case "sem", "semaphore":
+		return ch.handleSemaphore(args[2:])
+	case "mutex":
+		return ch.handleMutex(args[2:])
+	}
+
+	problem, err := syncsim.ParseProblem(args[1])
+	if err != nil {
+		return fmt.Errorf("sync: %v\n%s", err, usage)
+	}
+	cfg := syncsim.Config{
+		Problem:  problem,
+		Duration: 5 * time.Second,
+		Step:     100 * time.Millisecond,
+		Seed:     time.Now().UnixNano(),
+	}
+	quiet, verbose := false, false
+
+	rest := args[2:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case "-q":
+			quiet = true
+			rest = rest[1:]
+			continue
+		case "-v":
+			verbose = true
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return fmt.Errorf("sync: %s: option requires an argument\n%s", rest[0], usage)
+		}
+
+		value := rest[1]
+		count := func(n *int) {
+			*n, err = parsePositive(value)
+		}
+		switch rest[0] {
+		case "-t":
+			cfg.Duration, err = parseDuration(value)
+		case "-step":
+			cfg.Step, err = parseDuration(value)
+		case "-starve":
+			cfg.StarveAfter, err = parseDuration(value)
+		case "-seed":
+			cfg.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "-p":
+			count(&cfg.Producers)
+		case "-c":
+			count(&cfg.Consumers)
+		case "-b":
+			count(&cfg.BufferSize)
+		case "-items":
+			count(&cfg.Items)
+		case "-r":
+			count(&cfg.Readers)
+		case "-w":
+			count(&cfg.Writers)
+		case "-prefer":
+			cfg.Prefer = value
+		case "-n":
+			count(&cfg.Philosophers)
+		case "-strategy":
+			cfg.Strategy = value
+		case "-barbers":
+			count(&cfg.Barbers)
+		case "-chairs":
+			count(&cfg.Chairs)
+		case "-customers":
+			count(&cfg.Customers)
+		default:
+			return fmt.Errorf("sync: %s: invalid option\n%s", rest[0], usage)
+		}
+		if err != nil {
+			return fmt.Errorf("sync: %s: %v", rest[0], err)
+		}
+		rest = rest[2:]
+	}
+
+	if !quiet {
+		cfg.Log = func(e syncsim.Event) {
+			mark := " "
+			if e.Starving {
+				mark = "!"
+			}
+			fmt.Printf("%7.2fs %s %-8s %s\n", e.At.Seconds(), mark, e.Actor, e.Text)
+		}
+	}
+	ch.jobManager.clearInterrupt()
+	cfg.Interrupt = ch.jobManager.interrupt
+
+	title := problem.Title()
+	if variant := cfg.Variant(); variant != "" {
+		title += " (" + variant + ")"
+	}
+	fmt.Printf("%s, running for %s (Ctrl-C stops early)\n", title, cfg.Duration)
+	if !quiet {
+		fmt.Println()
+	}
+	report, err := syncsim.Run(cfg)
+	if err != nil {
+		return fmt.Errorf("sync: %v", err)
+	}
+	printSyncReport(report, verbose)
+	return nil
+}
+
+// printSyncReport prints what each actor got done and how long it waited,
+// followed by any deadlock or starvation
+func printSyncReport(report *syncsim.Report, verbose bool) {
+	fmt.Println()
+	switch {
+	case report.Interrupted:
+		fmt.Printf("Interrupted after %s\n\n", report.Elapsed.Round(time.Millisecond))
+	case report.Deadlock != "":
+		fmt.Printf("DEADLOCK after %s: %s\n\n", report.Elapsed.Round(time.Millisecond), report.Deadlock)
+	}
+
+	roles := make(map[string][]*syncsim.Actor)
+	var order []string
+	for _, a := range report.Actors {
+		if _, ok := roles[a.Role]; !ok {
+			order = append(order, a.Role)
+		}
+		roles[a.Role] = append(roles[a.Role], a)
+	}
+
+	fmt.Printf("%-14s %-12s %5s %6s %9s %9s\n", "ACTOR", "ROLE", "DONE", "WAITS", "AVG WAIT", "MAX WAIT")
+	row := func(name, role string, done, waits int, total, longest time.Duration, starved bool) {
+		avg := time.Duration(0)
+		if waits > 0 {
+			avg = total / time.Duration(waits)
+		}
+		flag := ""
+		if starved {
+			flag = "  starved"
+		}
+		fmt.Printf("%-14s %-12s %5d %6d %9s %9s%s\n", name, role, done, waits,
+			avg.Round(time.Millisecond), longest.Round(time.Millisecond), flag)
+	}
+	for _, role := range order {
+		actors := roles[role]
+		if verbose || len(actors) <= syncSummariseOver {
+			for _, a := range actors {
+				row(a.Name, a.Role, a.Done, a.Waits, a.Total, a.Longest, a.Starved)
+			}
+			continue
+		}
+
+		var done, waits, starved int
+		var total, longest time.Duration
+		for _, a := range actors {
+			done += a.Done
+			waits += a.Waits
+			total += a.Total
+			longest = max(longest, a.Longest)
+			if a.Starved {
+				starved++
+			}
+		}
+		name := fmt.Sprintf("%d %ss", len(actors), role)
+		row(name, role, done, waits, total, longest, false)
+		if starved > 0 {
+			fmt.Printf("%-14s %d of them starved\n", "", starved)
+		}
+	}
+
+	fmt.Println()
+	for _, note := range report.Notes {
+		fmt.Println(note)
+	}
+	starved := report.Starved()
+	if len(starved) == 0 {
+		fmt.Printf("No starvation: nobody was blocked for %s or more\n", report.Config.StarveAfter)
+		return
+	}
+	names := make([]string, len(starved))
+	for i, a := range starved {
+		names[i] = a.Name
+	}
+	fmt.Printf("Starvation: %s blocked for %s or more\n", strings.Join(names, ", "), report.Config.StarveAfter)
+}
+
+// semaphoreState is a semaphore created from the command line
+type semaphoreState struct {
+	sem     *syncsim.Semaphore
+	initial int
+}
+
+func (ch *CommandHandler) handleSemaphore(args []string) error {
+	usage := "Usage: sync sem [list | create name [value] | wait name [timeout] | trywait name | post name | run name command... | delete name]"
+
+	if len(args) == 0 || args[0] == "list" {
+		if len(ch.semaphores) == 0 {
+			fmt.Println("No semaphores")
+			return nil
+		}
+		fmt.Printf("%-16s %6s %8s %8s\n", "NAME", "VALUE", "INITIAL", "WAITING")
+		for _, name := range sortedKeys(ch.semaphores) {
+			s := ch.semaphores[name]
+			fmt.Printf("%-16s %6d %8d %8d\n", name, s.sem.Value(), s.initial, s.sem.Waiting())
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("sync: sem %s: missing name\n%s", args[0], usage)
+	}
+
+	op, name := args[0], args[1]
+	if op == "create" {
+		if _, exists := ch.semaphores[name]; exists {
+			return fmt.Errorf("sync: sem %s: already exists", name)
+		}
+		value := 1
+		if len(args) > 2 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < 0 {
+				return fmt.Errorf("sync: sem %s: %s: invalid value", name, args[2])
+			}
+			value = n
+		}
+		if ch.semaphores == nil {
+			ch.semaphores = make(map[string]*semaphoreState)
+		}
+		ch.semaphores[name] = &semaphoreState{sem: syncsim.NewSemaphore(value), initial: value}
+		return nil
+	}
+
+	s, exists := ch.semaphores[name]
+	if !exists {
+		return fmt.Errorf("sync: sem %s: no such semaphore", name)
+	}
+	switch op {
+	case "wait":
+		timeout, err := optionalTimeout(args[2:])
+		if err != nil {
+			return fmt.Errorf("sync: sem %s: %v", name, err)
+		}
+		if err := ch.blockOn(timeout, s.sem.Wait); err != nil {
+			return fmt.Errorf("sync: sem %s: %v", name, err)
+		}
+	case "trywait":
+		if !s.sem.TryWait() {
+			return fmt.Errorf("sync: sem %s: would block", name)
+		}
+	case "post":
+		s.sem.Post()
+	case "run":
+		return ch.runHolding("sem "+name, args[2:], s.sem.TryWait, s.sem.Wait, s.sem.Post)
+	case "delete":
+		if n := s.sem.Waiting(); n > 0 {
+			return fmt.Errorf("sync: sem %s: %d waiting", name, n)
+		}
+		delete(ch.semaphores, name)
+	default:
+		return fmt.Errorf("sync: sem: %s: invalid operation\n%s", op, usage)
+	}
+	return nil
+}
+
+func (ch *CommandHandler) handleMutex(args []string) error {
+	usage := "Usage: sync mutex [list | create name | lock name [timeout] | trylock name | unlock name | run name command... | delete name]"
+
+	if len(args) == 0 || args[0] == "list" {
+		if len(ch.mutexes) == 0 {
+			fmt.Println("No mutexes")
+			return nil
+		}
+		fmt.Printf("%-16s %-24s %8s\n", "NAME", "OWNER", "WAITING")
+		for _, name := range sortedKeys(ch.mutexes) {
+			m := ch.mutexes[name]
+			owner := m.Owner()
+			if owner == "" {
+				owner = "-"
+			}
+			fmt.Printf("%-16s %-24s %8d\n", name, owner, m.Waiting())
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("sync: mutex %s: missing name\n%s", args[0], usage)
+	}
+
+	op, name := args[0], args[1]
+	if op == "create" {
+		if _, exists := ch.mutexes[name]; exists {
+			return fmt.Errorf("sync: mutex %s: already exists", name)
+		}
+		if ch.mutexes == nil {
+			ch.mutexes = make(map[string]*syncsim.Mutex)
+		}
+		ch.mutexes[name] = syncsim.NewMutex()
+		return nil
+	}
+
+	m, exists := ch.mutexes[name]
+	if !exists {
+		return fmt.Errorf("sync: mutex %s: no such mutex", name)
+	}
+	switch op {
+	case "lock":
+		timeout, err := optionalTimeout(args[2:])
+		if err != nil {
+			return fmt.Errorf("sync: mutex %s: %v", name, err)
+		}
+		lock := func(stop <-chan struct{}) bool { return m.Lock(shellOwner, stop) }
+		if err := ch.blockOn(timeout, lock); err != nil {
+			return fmt.Errorf("sync: mutex %s: %v", name, err)
+		}
+	case "trylock":
+		if !m.TryLock(shellOwner) {
+			return fmt.Errorf("sync: mutex %s: locked by %s", name, m.Owner())
+		}
+	case "unlock":
+		if err := m.Unlock(shellOwner); err != nil {
+			return fmt.Errorf("sync: mutex %s: %v", name, err)
+		}
+	case "run":
+		owner := "run " + strings.Join(args[2:], " ")
+		return ch.runHolding("mutex "+name, args[2:],
+			func() bool { return m.TryLock(owner) },
+			func(stop <-chan struct{}) bool { return m.Lock(owner, stop) },
+			func() { m.Unlock(owner) })
+	case "delete":
+		if owner := m.Owner(); owner != "" {
+			return fmt.Errorf("sync: mutex %s: locked by %s", name, owner)
+		}
+		delete(ch.mutexes, name)
+	default:
+		return fmt.Errorf("sync: mutex: %s: invalid operation\n%s", op, usage)
+	}
+	return nil
+}
+
+// blockOn waits with wait until it succeeds, the timeout (if any) expires
+// or the user hits Ctrl-C
+func (ch *CommandHandler) blockOn(timeout time.Duration, wait func(stop <-chan struct{}) bool) error {
+	stop := make(chan struct{})
+	result := make(chan bool, 1)
+	go func() { result <- wait(stop) }()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	ch.jobManager.clearInterrupt()
+	var err error
+	select {
+	case <-result:
+		return nil
+	case <-expired:
+		err = fmt.Errorf("timed out")
+	case <-ch.jobManager.interrupt:
+		err = fmt.Errorf("interrupted")
+	}
+	close(stop)
+	if <-result {
+		return nil // got it just as we gave up
+	}
+	return err
+}
+
+// optionalTimeout parses the timeout a blocking operation may be given
+func optionalTimeout(args []string) (time.Duration, error) {
+	switch len(args) {
+	case 0:
+		return 0, nil
+	case 1:
+		return parseDuration(args[0])
+	}
+	return 0, fmt.Errorf("too many arguments")
+}
+
+// runHolding runs command in the background while holding a semaphore unit
+// or mutex, which is released when the job finishes. If it is not free the
+// command waits for it without blocking the shell.
+func (ch *CommandHandler) runHolding(what string, command []string, try func() bool,
+	wait func(stop <-chan struct{}) bool, release func()) error {
+	if len(command) == 0 {
+		return fmt.Errorf("sync: %s: missing command", what)
+	}
+	if ch.parser.IsBuiltinCommand(command[0]) {
+		return fmt.Errorf("sync: %s: %s: cannot be used with a built-in command", what, command[0])
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return fmt.Errorf("sync: %s: %s: command not found", what, command[0])
+	}
+
+	jm := ch.jobManager
+	run := func() error {
+		job, err := jm.startJob(command, JobOptions{Background: true})
+		if err != nil {
+			release()
+			return err
+		}
+		go func() {
+			jm.awaitChange(false, func() bool { return job.Status == types.JobStatusDone })
+			release()
+		}()
+		return nil
+	}
+
+	if try() {
+		if err := run(); err != nil {
+			return fmt.Errorf("sync: %s: %v", what, err)
+		}
+		return nil
+	}
+
+	fmt.Printf("%s waits for %s\n", strings.Join(command, " "), what)
+	go func() {
+		wait(nil)
+		if err := run(); err != nil {
+			fmt.Printf("sync: %s: %v\n", what, err)
+		}
+	}()
+	return nil
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
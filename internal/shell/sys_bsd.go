@@ -0,0 +1,45 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package shell
+
+import (
+	"math"
+	"syscall"
+)
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+
+	// maxRSSUnit is the size in bytes of the unit rusage reports Maxrss in
+	maxRSSUnit = 1
+
+	// rlimitNproc is RLIMIT_NPROC, which package syscall does not define
+	rlimitNproc = 7
+
+	// bsdRlimInfinity is RLIM_INFINITY on the BSDs, where rlim_t is signed
+	// on some systems and unsigned on others
+	bsdRlimInfinity = math.MaxInt64
+)
+
+// rlimValue reads an rlim_t, mapping RLIM_INFINITY to rlimInfinity
+func rlimValue[T int64 | uint64](v T) uint64 {
+	if v < 0 || uint64(v) >= bsdRlimInfinity {
+		return rlimInfinity
+	}
+	return uint64(v)
+}
+
+// setRlimValue stores a limit, with rlimInfinity meaning no limit
+func setRlimValue[T int64 | uint64](dst *T, v uint64) {
+	if v >= bsdRlimInfinity {
+		v = bsdRlimInfinity
+	}
+	*dst = T(v)
+}
+
+// niceFromPriority converts what getpriority returns to a niceness, which
+// the BSDs return as is
+func niceFromPriority(prio int) int {
+	return prio
+}
@@ -0,0 +1,45 @@
+package shell
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+
+	// maxRSSUnit is the size in bytes of the unit rusage reports Maxrss in
+	maxRSSUnit = 1024
+
+	// rlimitNproc is RLIMIT_NPROC, which package syscall does not define
+	rlimitNproc = 6
+
+	// wcontinued is WCONTINUED, which makes wait4 report continued children
+	wcontinued = syscall.WCONTINUED
+
+	// memoryRlimit is the resource limit that enforces limit --mem, or -1
+	// when the shell watches the job's resident size in /proc instead.
+	// Linux ignores RLIMIT_RSS, and an address space limit would also
+	// count memory that is only reserved.
+	memoryRlimit = -1
+)
+
+// rlimValue reads an rlim_t, which Linux keeps unsigned with RLIM_INFINITY
+// as all ones
+func rlimValue(v uint64) uint64 {
+	return v
+}
+
+// setRlimValue stores a limit, with rlimInfinity meaning no limit
+func setRlimValue(dst *uint64, v uint64) {
+	*dst = v
+}
+
+// niceFromPriority converts what getpriority returns to a niceness. The raw
+// Linux system call returns 20 - nice so that the result is never negative.
+func niceFromPriority(prio int) int {
+	return 20 - prio
+}
+
+// memoryUlimits are the memory limits ulimit manages
+var memoryUlimits = []ulimitResource{
+	{'v', syscall.RLIMIT_AS, 1024, "virtual memory (kbytes)"},
+}
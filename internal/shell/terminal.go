@@ -0,0 +1,127 @@
+package shell
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// terminal tracks the controlling terminal that the shell hands over to
+// foreground jobs and takes back once they finish
+type terminal struct {
+	fd        int
+	shellPgid int
+	modes     *syscall.Termios
+}
+
+// newTerminal prepares job control on stdin. It returns nil when stdin is not
+// a terminal, in which case jobs simply run without terminal handoff.
+func newTerminal() *terminal {
+	fd := int(os.Stdin.Fd())
+	if _, err := tcgetpgrp(fd); err != nil {
+		return nil
+	}
+
+	// Put the shell in its own process group so that keyboard signals sent
+	// to foreground jobs never reach it. This fails harmlessly when the
+	// shell is already a session or group leader.
+	_ = syscall.Setpgid(0, 0)
+
+	t := &terminal{
+		fd:        fd,
+		shellPgid: syscall.Getpgrp(),
+	}
+	if err := tcsetpgrp(fd, t.shellPgid); err != nil {
+		return nil
+	}
+	t.modes, _ = tcgetattr(fd)
+	return t
+}
+
+// give hands the terminal to the given process group
+func (t *terminal) give(pgid int) error {
+	if t == nil {
+		return nil
+	}
+	return tcsetpgrp(t.fd, pgid)
+}
+
+// reclaim takes the terminal back for the shell and restores its modes,
+// returning the modes the job left behind so they can be reapplied on fg
+func (t *terminal) reclaim() *syscall.Termios {
+	if t == nil {
+		return nil
+	}
+	jobModes, _ := tcgetattr(t.fd)
+	_ = tcsetpgrp(t.fd, t.shellPgid)
+	if t.modes != nil {
+		_ = tcsetattr(t.fd, t.modes)
+	}
+	return jobModes
+}
+
+// restore reapplies terminal modes previously saved for a job
+func (t *terminal) restore(modes *syscall.Termios) {
+	if t == nil || modes == nil {
+		return
+	}
+	_ = tcsetattr(t.fd, modes)
+}
+
+func tcgetpgrp(fd int) (int, error) {
+	var pgid int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgid)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgid), nil
+}
+
+// tcsetpgrp makes pgid the foreground process group of the terminal. When the
+// shell is in the background this raises SIGTTOU, so the signal is ignored for
+// the duration of the call. ForkLock keeps the ignored disposition from
+// leaking into a child started concurrently.
+func tcsetpgrp(fd int, pgid int) error {
+	syscall.ForkLock.Lock()
+	defer syscall.ForkLock.Unlock()
+
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	pg := int32(pgid)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&pg)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func tcgetattr(fd int) (*syscall.Termios, error) {
+	var modes syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlGetTermios, uintptr(unsafe.Pointer(&modes)))
+	if errno != 0 {
+		return nil, errno
+	}
+	return &modes, nil
+}
+
+func tcsetattr(fd int, modes *syscall.Termios) error {
+	syscall.ForkLock.Lock()
+	defer syscall.ForkLock.Unlock()
+
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlSetTermios, uintptr(unsafe.Pointer(modes)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether f refers to a terminal
+func isTerminal(f *os.File) bool {
+	_, err := tcgetattr(int(f.Fd()))
+	return err == nil
+}
@@ -0,0 +1,203 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Report formats used by the time built-in, in bash TIMEFORMAT syntax
+const (
+	defaultTimeFormat = "\nreal\t%3lR\nuser\t%3lU\nsys\t%3lS"
+	posixTimeFormat   = "real %2R\nuser %2U\nsys %2S"
+)
+
+func (ch *CommandHandler) handleTime(args []string, background bool) error {
+	format := os.Getenv("TIMEFORMAT")
+	if format == "" {
+		format = defaultTimeFormat
+	}
+
+	// Parse options
+	command := args[1:]
+options:
+	for len(command) > 0 && strings.HasPrefix(command[0], "-") {
+		switch command[0] {
+		case "-p":
+			format = posixTimeFormat
+			command = command[1:]
+		case "-f":
+			if len(command) < 2 {
+				return fmt.Errorf("time: -f: option requires an argument")
+			}
+			format = command[1]
+			command = command[2:]
+		case "--":
+			command = command[1:]
+			break options
+		default:
+			return fmt.Errorf("time: %s: invalid option\nUsage: time [-p] [-f format] command [args...]", command[0])
+		}
+	}
+
+	if background {
+		return fmt.Errorf("time: cannot time a background job; use 'jobs -v' once it finishes")
+	}
+
+	// With nothing to run, bash reports the shell's own times
+	if len(command) == 0 {
+		var self syscall.Rusage
+		if err := syscall.Getrusage(syscall.RUSAGE_SELF, &self); err != nil {
+			return fmt.Errorf("time: %v", err)
+		}
+		fmt.Println(formatTimes(format, 0, time.Duration(self.Utime.Nano()), time.Duration(self.Stime.Nano())))
+		return nil
+	}
+
+	if ch.parser.IsBuiltinCommand(command[0]) {
+		return ch.timeBuiltin(format, command)
+	}
+
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return fmt.Errorf("time: %s: command not found", command[0])
+	}
+
+	job, err := ch.jobManager.RunForeground(command, JobOptions{})
+	if err != nil {
+		return fmt.Errorf("time: %v", err)
+	}
+
+	// A stopped job has not finished yet, so there is nothing to report
+	if job.Usage == nil || job.EndTime == nil {
+		return nil
+	}
+
+	elapsed := job.EndTime.Sub(job.StartTime)
+	fmt.Println(formatTimes(format, elapsed, job.Usage.UserTime, job.Usage.SystemTime))
+	return nil
+}
+
+// timeBuiltin runs a built-in command and reports the CPU time the shell
+// itself spent on it
+func (ch *CommandHandler) timeBuiltin(format string, command []string) error {
+	var before, after syscall.Rusage
+	_ = syscall.Getrusage(syscall.RUSAGE_SELF, &before)
+	start := time.Now()
+
+	cmdErr := ch.HandleCommand(&ParsedCommand{
+		Command: command[0],
+		Args:    command,
+		Pipes:   [][]string{command},
+	})
+
+	elapsed := time.Since(start)
+	_ = syscall.Getrusage(syscall.RUSAGE_SELF, &after)
+
+	user := time.Duration(after.Utime.Nano() - before.Utime.Nano())
+	sys := time.Duration(after.Stime.Nano() - before.Stime.Nano())
+	fmt.Println(formatTimes(format, elapsed, user, sys))
+	return cmdErr
+}
+
+// formatTimes expands a bash TIMEFORMAT string. It understands %%, and
+// %[p][l]R, %[p][l]U, %[p][l]S for real, user and system time where p is
+// the number of decimals (0-3) and l selects the MMmSS.FFFs form, and %P
+// for the CPU percentage. \n and \t escapes are expanded too.
+func formatTimes(format string, elapsed, user, sys time.Duration) string {
+	format = strings.ReplaceAll(format, "\\n", "\n")
+	format = strings.ReplaceAll(format, "\\t", "\t")
+
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		j := i + 1
+		precision := 3
+		if format[j] >= '0' && format[j] <= '9' {
+			precision = int(format[j] - '0')
+			if precision > 3 {
+				precision = 3
+			}
+			j++
+		}
+		long := false
+		if j < len(format) && format[j] == 'l' {
+			long = true
+			j++
+		}
+		if j >= len(format) {
+			out.WriteString(format[i:])
+			break
+		}
+
+		var value time.Duration
+		switch format[j] {
+		case '%':
+			out.WriteByte('%')
+			i = j
+			continue
+		case 'P':
+			percent := 0.0
+			if elapsed > 0 {
+				percent = float64(user+sys) / float64(elapsed) * 100
+			}
+			out.WriteString(fmt.Sprintf("%.*f", precision, percent))
+			i = j
+			continue
+		case 'R':
+			value = elapsed
+		case 'U':
+			value = user
+		case 'S':
+			value = sys
+		default:
+			// Unknown directives are copied through unchanged
+			out.WriteString(format[i : j+1])
+			i = j
+			continue
+		}
+
+		// As in bash, only the long form carries units
+		if long {
+			out.WriteString(formatMinutes(value, precision))
+		} else {
+			out.WriteString(fmt.Sprintf("%.*f", precision, value.Seconds()))
+		}
+		i = j
+	}
+	return out.String()
+}
+
+// formatSeconds renders a duration as seconds with the given decimals
+func formatSeconds(d time.Duration, precision int) string {
+	return fmt.Sprintf("%.*fs", precision, d.Seconds())
+}
+
+// formatMinutes renders a duration in bash's long MmS.FFFs form
+func formatMinutes(d time.Duration, precision int) string {
+	minutes := int(d / time.Minute)
+	seconds := (d - time.Duration(minutes)*time.Minute).Seconds()
+	return fmt.Sprintf("%dm%.*fs", minutes, precision, seconds)
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n)
+	suffixes := []string{"K", "M", "G", "T"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", value, suffixes[i])
+}
@@ -0,0 +1,8 @@
+//go:build darwin || dragonfly || freebsd || openbsd
+
+package shell
+
+import "syscall"
+
+// wcontinued is WCONTINUED, which makes wait4 report continued children
+const wcontinued = syscall.WCONTINUED
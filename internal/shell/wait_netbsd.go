@@ -0,0 +1,4 @@
+package shell
+
+// wcontinued is WCONTINUED, which package syscall does not define on NetBSD
+const wcontinued = 0x10
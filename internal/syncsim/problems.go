@@ -0,0 +1,376 @@
+package syncsim
+
+import (
+	"fmt"
+	"sync"
+)
+
+// orDefault returns n, or def when n is zero
+func orDefault(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
+
+// producerConsumer shares a bounded buffer between producers and consumers,
+// with a semaphore counting empty slots, one counting full slots and a mutex
+// guarding the buffer itself
+func (w *world) producerConsumer() error {
+	producers := orDefault(w.cfg.Producers, 2)
+	consumers := orDefault(w.cfg.Consumers, 2)
+	size := orDefault(w.cfg.BufferSize, 5)
+	if producers < 1 || consumers < 1 || size < 1 {
+		return fmt.Errorf("producer-consumer needs at least one producer, one consumer and a buffer slot")
+	}
+
+	empty, full, mutex := NewSemaphore(size), NewSemaphore(0), NewMutex()
+	var buffer []int
+	produced, consumed := 0, 0
+
+	for i := 1; i <= producers; i++ {
+		w.actor(fmt.Sprintf("P%d", i), "producer", func(a *Actor) {
+			for w.pause(1, 4) {
+				if !w.acquire(a, empty, "buffer full") || !w.lock(a, mutex, "buffer in use") {
+					return
+				}
+				produced++
+				buffer = append(buffer, produced)
+				w.log(a, "produced item %d   [buffer %d/%d]", produced, len(buffer), size)
+				mutex.Unlock(a.Name)
+				full.Post()
+				w.did(a)
+			}
+		})
+	}
+
+	for i := 1; i <= consumers; i++ {
+		w.actor(fmt.Sprintf("C%d", i), "consumer", func(a *Actor) {
+			for {
+				if !w.acquire(a, full, "buffer empty") || !w.lock(a, mutex, "buffer in use") {
+					return
+				}
+				item := buffer[0]
+				buffer = buffer[1:]
+				consumed++
+				n := consumed
+				w.log(a, "consumed item %d   [buffer %d/%d]", item, len(buffer), size)
+				mutex.Unlock(a.Name)
+				empty.Post()
+				w.did(a)
+
+				if w.cfg.Items > 0 && n >= w.cfg.Items {
+					w.finish(fmt.Sprintf("all %d items consumed", w.cfg.Items))
+					return
+				}
+				if !w.pause(1, 4) {
+					return
+				}
+			}
+		})
+	}
+
+	w.wrapUp = func() {
+		w.note("%d items produced, %d consumed, %d left in the buffer", produced, consumed, len(buffer))
+	}
+	return nil
+}
+
+// readersWriters lets any number of readers share a resource that writers
+// need to themselves. Preferring readers can starve writers and preferring
+// writers can starve readers; the fair variant queues both in arrival order.
+func (w *world) readersWriters() error {
+	readers := orDefault(w.cfg.Readers, 4)
+	writers := orDefault(w.cfg.Writers, 2)
+	prefer := w.cfg.Prefer
+	if prefer == "" {
+		prefer = "readers"
+	}
+	if prefer != "readers" && prefer != "writers" && prefer != "fair" {
+		return fmt.Errorf("%s: preference must be readers, writers or fair", prefer)
+	}
+	if readers < 0 || writers < 0 || readers+writers == 0 {
+		return fmt.Errorf("readers-writers needs at least one reader or writer")
+	}
+
+	resource := NewSemaphore(1) // held by the writer, or by readers as a group
+	readTry := NewSemaphore(1)  // writers hold it to keep new readers out
+	queue := NewSemaphore(1)    // the fair variant's line
+	readMutex, writeMutex := NewMutex(), NewMutex()
+	reading, writing := 0, 0
+
+	for i := 1; i <= readers; i++ {
+		w.actor(fmt.Sprintf("R%d", i), "reader", func(a *Actor) {
+			for w.pause(0, 2) {
+				var gate *Semaphore
+				why := ""
+				switch prefer {
+				case "writers":
+					gate, why = readTry, "writer waiting"
+				case "fair":
+					gate, why = queue, "in line"
+				}
+				if gate != nil && !w.acquire(a, gate, why) {
+					return
+				}
+				if !w.lock(a, readMutex, "") {
+					return
+				}
+				reading++
+				if reading == 1 && !w.acquire(a, resource, "writer active") {
+					return
+				}
+				w.log(a, "starts reading   [%d reading]", reading)
+				readMutex.Unlock(a.Name)
+				if gate != nil {
+					gate.Post()
+				}
+
+				w.did(a)
+				ok := w.pause(2, 5)
+
+				if !w.lock(a, readMutex, "") {
+					return
+				}
+				reading--
+				if reading == 0 {
+					resource.Post()
+				}
+				readMutex.Unlock(a.Name)
+				if !ok {
+					return
+				}
+			}
+		})
+	}
+
+	for i := 1; i <= writers; i++ {
+		w.actor(fmt.Sprintf("W%d", i), "writer", func(a *Actor) {
+			for w.pause(1, 4) {
+				switch prefer {
+				case "writers":
+					if !w.lock(a, writeMutex, "") {
+						return
+					}
+					writing++
+					if writing == 1 && !w.acquire(a, readTry, "readers active") {
+						return
+					}
+					writeMutex.Unlock(a.Name)
+				case "fair":
+					if !w.acquire(a, queue, "in line") {
+						return
+					}
+				}
+				if !w.acquire(a, resource, "readers or writer active") {
+					return
+				}
+				if prefer == "fair" {
+					queue.Post()
+				}
+
+				w.log(a, "starts writing")
+				w.did(a)
+				ok := w.pause(1, 2)
+				resource.Post()
+
+				if prefer == "writers" {
+					if !w.lock(a, writeMutex, "") {
+						return
+					}
+					writing--
+					if writing == 0 {
+						readTry.Post()
+					}
+					writeMutex.Unlock(a.Name)
+				}
+				if !ok {
+					return
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// philosophers seats philosophers around a table with a fork between each
+// pair. Picking up the left fork and then the right can deadlock; taking the
+// lower numbered fork first, or letting a waiter admit one fewer
+// philosopher than there are forks, cannot.
+func (w *world) philosophers() error {
+	n := orDefault(w.cfg.Philosophers, 5)
+	strategy := w.cfg.Strategy
+	if strategy == "" {
+		strategy = "naive"
+	}
+	if strategy != "naive" && strategy != "ordered" && strategy != "waiter" {
+		return fmt.Errorf("%s: strategy must be naive, ordered or waiter", strategy)
+	}
+	if n < 2 {
+		return fmt.Errorf("dining philosophers needs at least two philosophers")
+	}
+
+	forks := make([]*Mutex, n)
+	for i := range forks {
+		forks[i] = NewMutex()
+	}
+	room := NewSemaphore(n - 1)
+	holdingOne := make([]bool, n) // holds its first fork and waits for the second
+
+	w.blocked = func() string {
+		for _, waiting := range holdingOne {
+			if !waiting {
+				return ""
+			}
+		}
+		return "every philosopher holds one fork and waits for the next"
+	}
+
+	for i := 0; i < n; i++ {
+		i := i
+		left, right := i, (i+1)%n
+		first, second := left, right
+		if strategy == "ordered" && first > second {
+			first, second = second, first
+		}
+
+		w.actor(fmt.Sprintf("Phil%d", i+1), "philosopher", func(a *Actor) {
+			for w.pause(1, 3) {
+				if strategy == "waiter" && !w.acquire(a, room, "table full") {
+					return
+				}
+				if !w.lock(a, forks[first], fmt.Sprintf("fork %d in use", first)) {
+					return
+				}
+				w.log(a, "picks up fork %d", first)
+
+				w.mu.Lock()
+				holdingOne[i] = true
+				w.mu.Unlock()
+				if !w.pause(1, 2) || !w.lock(a, forks[second], fmt.Sprintf("fork %d in use", second)) {
+					return
+				}
+				w.mu.Lock()
+				holdingOne[i] = false
+				w.mu.Unlock()
+
+				w.log(a, "picks up fork %d and eats", second)
+				w.did(a)
+				ok := w.pause(2, 4)
+				forks[second].Unlock(a.Name)
+				forks[first].Unlock(a.Name)
+				if strategy == "waiter" {
+					room.Post()
+				}
+				if !ok {
+					return
+				}
+				w.log(a, "puts down forks %d and %d and thinks", first, second)
+			}
+		})
+	}
+	return nil
+}
+
+// barber runs a barbershop with a waiting room of a few chairs. Sleeping
+// barbers are woken by a semaphore counting waiting customers, and
+// customers who find every chair taken leave.
+func (w *world) barber() error {
+	barbers := orDefault(w.cfg.Barbers, 1)
+	chairs := orDefault(w.cfg.Chairs, 3)
+	if barbers < 1 || chairs < 0 {
+		return fmt.Errorf("sleeping barber needs at least one barber")
+	}
+
+	// Each waiting customer is woken by their own semaphore when a barber
+	// calls them
+	type seat struct {
+		name   string
+		called *Semaphore
+	}
+	customers := NewSemaphore(0) // customers waiting
+	seats := NewMutex()
+	var waiting []seat
+	served, turnedAway := 0, 0
+
+	for i := 1; i <= barbers; i++ {
+		w.actor(fmt.Sprintf("Barber%d", i), "barber", func(a *Actor) {
+			for {
+				if !customers.TryWait() {
+					w.log(a, "sleeps")
+					if !customers.Wait(w.stop) {
+						return
+					}
+					w.log(a, "is woken up")
+				}
+				if !w.lock(a, seats, "") {
+					return
+				}
+				next := waiting[0]
+				waiting = waiting[1:]
+				served++
+				seats.Unlock(a.Name)
+				next.called.Post()
+
+				w.log(a, "cuts %s's hair", next.name)
+				w.did(a)
+				if !w.pause(2, 4) {
+					return
+				}
+			}
+		})
+	}
+
+	var mu sync.Mutex // guards arrived
+	arrived := 0
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		var inShop sync.WaitGroup
+		for w.pause(1, 3) {
+			mu.Lock()
+			arrived++
+			n := arrived
+			mu.Unlock()
+			if w.cfg.Customers > 0 && n > w.cfg.Customers {
+				break
+			}
+
+			inShop.Add(1)
+			w.actor(fmt.Sprintf("Cust%d", n), "customer", func(a *Actor) {
+				defer inShop.Done()
+				if !w.lock(a, seats, "") {
+					return
+				}
+				if len(waiting) >= chairs {
+					turnedAway++
+					seats.Unlock(a.Name)
+					w.log(a, "leaves: every chair is taken")
+					return
+				}
+				called := NewSemaphore(0)
+				waiting = append(waiting, seat{a.Name, called})
+				w.log(a, "sits down   [%d of %d chairs taken]", len(waiting), chairs)
+				seats.Unlock(a.Name)
+				customers.Post()
+
+				if w.acquire(a, called, "") {
+					w.did(a)
+				}
+			})
+		}
+		inShop.Wait()
+		if w.cfg.Customers > 0 {
+			// Let the last haircut finish
+			if w.pause(4, 4) {
+				w.finish(fmt.Sprintf("all %d customers have come and gone", w.cfg.Customers))
+			}
+		}
+	}()
+
+	w.wrapUp = func() {
+		w.note("%d customers served, %d turned away, %d still waiting",
+			served, turnedAway, len(waiting))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package syncsim
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Semaphore is a counting semaphore. Waiters are woken in the order they
+// arrived, so no waiter is passed over indefinitely.
+type Semaphore struct {
+	mu      sync.Mutex
+	value   int
+	waiters []chan struct{}
+}
+
+// NewSemaphore returns a semaphore with value units available
+func NewSemaphore(value int) *Semaphore {
+	return &Semaphore{value: value}
+}
+
+// Wait takes a unit, blocking until one is available. It gives up and
+// returns false when stop is closed first.
+func (s *Semaphore) Wait(stop <-chan struct{}) bool {
+	s.mu.Lock()
+	if s.value > 0 && len(s.waiters) == 0 {
+		s.value--
+		s.mu.Unlock()
+		return true
+	}
+	wake := make(chan struct{})
+	s.waiters = append(s.waiters, wake)
+	s.mu.Unlock()
+
+	select {
+	case <-wake:
+		return true
+	case <-stop:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.waiters {
+		if w == wake {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return false
+		}
+	}
+	// Post handed us a unit just as we gave up; pass it on
+	s.postLocked()
+	return false
+}
+
+// TryWait takes a unit if one is available without blocking
+func (s *Semaphore) TryWait() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value > 0 && len(s.waiters) == 0 {
+		s.value--
+		return true
+	}
+	return false
+}
+
+// Post returns a unit, waking the longest waiter if there is one
+func (s *Semaphore) Post() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.postLocked()
+}
+
+func (s *Semaphore) postLocked() {
+	if len(s.waiters) > 0 {
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+		return
+	}
+	s.value++
+}
+
+// Value is the number of units available
+func (s *Semaphore) Value() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
+}
+
+// Waiting is the number of callers blocked in Wait
+func (s *Semaphore) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiters)
+}
+
+// Mutex is a binary semaphore that remembers its owner, so that only the
+// owner may unlock it
+type Mutex struct {
+	sem   *Semaphore
+	mu    sync.Mutex
+	owner string
+}
+
+// NewMutex returns an unlocked mutex
+func NewMutex() *Mutex {
+	return &Mutex{sem: NewSemaphore(1)}
+}
+
+// Lock blocks until the mutex is free and takes it for owner. It returns
+// false when stop is closed first.
+func (m *Mutex) Lock(owner string, stop <-chan struct{}) bool {
+	if !m.sem.Wait(stop) {
+		return false
+	}
+	m.setOwner(owner)
+	return true
+}
+
+// TryLock takes the mutex for owner if it is free
+func (m *Mutex) TryLock(owner string) bool {
+	if !m.sem.TryWait() {
+		return false
+	}
+	m.setOwner(owner)
+	return true
+}
+
+// Unlock releases the mutex, which owner must hold
+func (m *Mutex) Unlock(owner string) error {
+	m.mu.Lock()
+	if m.owner != owner {
+		holder := m.owner
+		m.mu.Unlock()
+		if holder == "" {
+			return fmt.Errorf("not locked")
+		}
+		return fmt.Errorf("locked by %s", holder)
+	}
+	m.owner = ""
+	m.mu.Unlock()
+	m.sem.Post()
+	return nil
+}
+
+// Owner is who holds the mutex, or "" when it is free
+func (m *Mutex) Owner() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.owner
+}
+
+// Waiting is the number of callers blocked in Lock
+func (m *Mutex) Waiting() int {
+	return m.sem.Waiting()
+}
+
+func (m *Mutex) setOwner(owner string) {
+	m.mu.Lock()
+	m.owner = owner
+	m.mu.Unlock()
+}
@@ -0,0 +1,162 @@
+package syncsim
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls until cond holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSemaphoreCounting(t *testing.T) {
+	tests := []struct {
+		name  string
+		value int
+		ops   string // w for TryWait, p for Post
+		took  []bool // result of each TryWait
+		after int
+	}{
+		{"binary", 1, "ww", []bool{true, false}, 0},
+		{"counting", 3, "www", []bool{true, true, true}, 0},
+		{"post then take", 0, "wpw", []bool{false, true}, 0},
+		{"posts add up", 0, "ppp", nil, 3},
+	}
+	for _, tt := range tests {
+		s := NewSemaphore(tt.value)
+		var took []bool
+		for _, op := range tt.ops {
+			if op == 'w' {
+				took = append(took, s.TryWait())
+			} else {
+				s.Post()
+			}
+		}
+		if len(took) != len(tt.took) {
+			t.Fatalf("%s: %d results, want %d", tt.name, len(took), len(tt.took))
+		}
+		for i := range took {
+			if took[i] != tt.took[i] {
+				t.Errorf("%s: TryWait %d = %v, want %v", tt.name, i+1, took[i], tt.took[i])
+			}
+		}
+		if got := s.Value(); got != tt.after {
+			t.Errorf("%s: value %d, want %d", tt.name, got, tt.after)
+		}
+	}
+}
+
+func TestSemaphoreWakesInOrder(t *testing.T) {
+	s := NewSemaphore(0)
+	order := make(chan int, 3)
+	for i := 1; i <= 3; i++ {
+		i := i
+		go func() {
+			s.Wait(nil)
+			order <- i
+		}()
+		waitFor(t, "waiter to block", func() bool { return s.Waiting() == i })
+	}
+
+	// Each unit goes to the longest waiter, never to TryWait
+	for want := 1; want <= 3; want++ {
+		s.Post()
+		if s.TryWait() {
+			t.Error("TryWait took a unit ahead of a waiter")
+		}
+		if got := <-order; got != want {
+			t.Errorf("waiter %d woke in place %d", got, want)
+		}
+	}
+	if s.Value() != 0 || s.Waiting() != 0 {
+		t.Errorf("value %d with %d waiting, want 0 and 0", s.Value(), s.Waiting())
+	}
+}
+
+func TestSemaphoreStop(t *testing.T) {
+	s := NewSemaphore(0)
+	stop := make(chan struct{})
+	done := make(chan bool)
+	go func() { done <- s.Wait(stop) }()
+	waitFor(t, "waiter to block", func() bool { return s.Waiting() == 1 })
+
+	close(stop)
+	if <-done {
+		t.Error("Wait returned true after being stopped")
+	}
+	if s.Waiting() != 0 {
+		t.Errorf("%d still waiting", s.Waiting())
+	}
+	s.Post()
+	if s.Value() != 1 {
+		t.Errorf("value %d after Post, want 1", s.Value())
+	}
+}
+
+func TestMutexOwnership(t *testing.T) {
+	m := NewMutex()
+	if err := m.Unlock("a"); err == nil {
+		t.Error("unlocking a free mutex succeeded")
+	}
+	if !m.TryLock("a") {
+		t.Fatal("TryLock of a free mutex failed")
+	}
+	if m.TryLock("b") {
+		t.Error("TryLock of a held mutex succeeded")
+	}
+	if err := m.Unlock("b"); err == nil {
+		t.Error("b unlocked a's mutex")
+	}
+	if m.Owner() != "a" {
+		t.Errorf("owner %q, want a", m.Owner())
+	}
+	if err := m.Unlock("a"); err != nil {
+		t.Errorf("owner could not unlock: %v", err)
+	}
+	if m.Owner() != "" {
+		t.Errorf("owner %q after unlock", m.Owner())
+	}
+}
+
+func TestMutexExclusion(t *testing.T) {
+	m := NewMutex()
+	var wg sync.WaitGroup
+	inside, most := 0, 0
+	var count sync.Mutex
+
+	for i := 0; i < 8; i++ {
+		name := string(rune('a' + i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				m.Lock(name, nil)
+				count.Lock()
+				inside++
+				most = max(most, inside)
+				count.Unlock()
+
+				count.Lock()
+				inside--
+				count.Unlock()
+				if err := m.Unlock(name); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if most != 1 {
+		t.Errorf("%d holders at once", most)
+	}
+}
@@ -0,0 +1,399 @@
+package syncsim
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Problem is a classic synchronization problem
+type Problem string
+
+const (
+	ProducerConsumer Problem = "producer-consumer"
+	ReadersWriters   Problem = "readers-writers"
+	Philosophers     Problem = "philosophers"
+	Barber           Problem = "barber"
+)
+
+// Problems lists every problem
+var Problems = []Problem{ProducerConsumer, ReadersWriters, Philosophers, Barber}
+
+// ParseProblem accepts a problem's name or a common alias
+func ParseProblem(name string) (Problem, error) {
+	switch strings.ToLower(name) {
+	case "producer-consumer", "prodcons", "pc", "bounded-buffer":
+		return ProducerConsumer, nil
+	case "readers-writers", "rw":
+		return ReadersWriters, nil
+	case "philosophers", "dining-philosophers", "dp":
+		return Philosophers, nil
+	case "barber", "sleeping-barber":
+		return Barber, nil
+	}
+	return "", fmt.Errorf("%s: unknown problem", name)
+}
+
+// Title names a problem
+func (p Problem) Title() string {
+	switch p {
+	case ProducerConsumer:
+		return "Producer-consumer (bounded buffer)"
+	case ReadersWriters:
+		return "Readers-writers"
+	case Philosophers:
+		return "Dining philosophers"
+	case Barber:
+		return "Sleeping barber"
+	}
+	return string(p)
+}
+
+// Config describes a simulation. Counts that are zero take the problem's
+// usual defaults.
+type Config struct {
+	Problem Problem
+
+	Producers, Consumers int
+	BufferSize           int
+	Items                int // stop once this many items were consumed, 0 for no limit
+
+	Readers, Writers int
+	Prefer           string // readers, writers or fair
+
+	Philosophers int
+	Strategy     string // naive, ordered or waiter
+
+	Barbers, Chairs, Customers int
+
+	Duration    time.Duration // how long to run
+	Step        time.Duration // the time unit that work and pauses are measured in
+	StarveAfter time.Duration // a wait this long counts as starvation
+	Seed        int64
+
+	// Log receives each event as it happens, from one goroutine at a time
+	Log func(Event)
+
+	// Interrupt stops the simulation early when it is closed or sent on
+	Interrupt <-chan struct{}
+}
+
+// Variant names the solution a simulation uses, if the problem has several
+func (c Config) Variant() string {
+	switch c.Problem {
+	case ReadersWriters:
+		if c.Prefer == "fair" {
+			return "fair"
+		}
+		if c.Prefer == "" {
+			return "readers preferred"
+		}
+		return c.Prefer + " preferred"
+	case Philosophers:
+		if c.Strategy == "" {
+			return "naive"
+		}
+		return c.Strategy
+	}
+	return ""
+}
+
+// Event is a line of the event log
+type Event struct {
+	At       time.Duration
+	Actor    string
+	Text     string
+	Starving bool // the actor has waited longer than StarveAfter
+}
+
+// Actor is a goroutine playing a part in a simulation, with what it got done
+type Actor struct {
+	Name    string
+	Role    string
+	Done    int // items produced or consumed, reads, writes, meals or haircuts
+	Waits   int
+	Total   time.Duration // time spent blocked
+	Longest time.Duration
+	Starved bool
+
+	waitingSince time.Time
+	warned       bool
+}
+
+// AverageWait is the mean time the actor spent blocked per wait
+func (a *Actor) AverageWait() time.Duration {
+	if a.Waits == 0 {
+		return 0
+	}
+	return a.Total / time.Duration(a.Waits)
+}
+
+// Report is the outcome of a simulation
+type Report struct {
+	Config      Config
+	Elapsed     time.Duration
+	Actors      []*Actor
+	Deadlock    string // why the simulation deadlocked, if it did
+	Interrupted bool
+	Notes       []string
+}
+
+// Starved lists the actors that starved
+func (r *Report) Starved() []*Actor {
+	var starved []*Actor
+	for _, a := range r.Actors {
+		if a.Starved {
+			starved = append(starved, a)
+		}
+	}
+	return starved
+}
+
+// Run runs a simulation until its duration is up, it deadlocks, it runs out
+// of work or it is interrupted
+func Run(cfg Config) (*Report, error) {
+	if cfg.Step <= 0 {
+		return nil, fmt.Errorf("the time step must be positive")
+	}
+	if cfg.Duration <= 0 {
+		return nil, fmt.Errorf("the duration must be positive")
+	}
+	if cfg.StarveAfter <= 0 {
+		cfg.StarveAfter = 20 * cfg.Step
+	}
+
+	w := &world{
+		cfg:   cfg,
+		rng:   rand.New(rand.NewSource(cfg.Seed)),
+		stop:  make(chan struct{}),
+		done:  make(chan string, 1),
+		start: time.Now(),
+	}
+
+	var err error
+	switch cfg.Problem {
+	case ProducerConsumer:
+		err = w.producerConsumer()
+	case ReadersWriters:
+		err = w.readersWriters()
+	case Philosophers:
+		err = w.philosophers()
+	case Barber:
+		err = w.barber()
+	default:
+		err = fmt.Errorf("%s: unknown problem", cfg.Problem)
+	}
+	if err != nil {
+		close(w.stop)
+		w.wg.Wait()
+		return nil, err
+	}
+
+	report := &Report{Config: cfg}
+	ticker := time.NewTicker(cfg.Step)
+	defer ticker.Stop()
+	deadline := time.After(cfg.Duration)
+wait:
+	for {
+		select {
+		case <-deadline:
+			break wait
+		case <-cfg.Interrupt:
+			report.Interrupted = true
+			break wait
+		case reason := <-w.done:
+			if strings.HasPrefix(reason, "deadlock") {
+				report.Deadlock = strings.TrimPrefix(reason, "deadlock: ")
+			} else {
+				report.Notes = append(report.Notes, reason)
+			}
+			break wait
+		case <-ticker.C:
+			w.watch()
+		}
+	}
+	close(w.stop)
+	w.wg.Wait()
+	if w.wrapUp != nil {
+		w.wrapUp()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	report.Elapsed = time.Since(w.start)
+	report.Notes = append(report.Notes, w.notes...)
+	for _, a := range w.actors {
+		// Blocked when the simulation ended
+		if !a.waitingSince.IsZero() {
+			w.endWaitLocked(a)
+		}
+		if a.Done == 0 && a.Total >= cfg.StarveAfter {
+			a.Starved = true
+		}
+		report.Actors = append(report.Actors, a)
+	}
+	sort.SliceStable(report.Actors, func(i, j int) bool { return report.Actors[i].Role < report.Actors[j].Role })
+	return report, nil
+}
+
+// world is the shared state of a running simulation
+type world struct {
+	cfg   Config
+	wg    sync.WaitGroup
+	stop  chan struct{}
+	done  chan string // ends the simulation early, with the reason
+	start time.Time
+
+	// wrapUp adds the problem's own figures to the report once every
+	// actor has stopped
+	wrapUp func()
+
+	mu      sync.Mutex // guards the fields below
+	rng     *rand.Rand
+	actors  []*Actor
+	notes   []string
+	blocked func() string // reports a deadlock, when the problem can have one
+}
+
+// actor registers an actor and runs body in its own goroutine
+func (w *world) actor(name, role string, body func(a *Actor)) {
+	a := &Actor{Name: name, Role: role}
+	w.mu.Lock()
+	w.actors = append(w.actors, a)
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		body(a)
+	}()
+}
+
+// log records an event
+func (w *world) log(a *Actor, format string, args ...any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.logLocked(Event{Actor: a.Name, Text: fmt.Sprintf(format, args...)})
+}
+
+func (w *world) logLocked(e Event) {
+	select {
+	case <-w.stop:
+		return // nothing is logged once the simulation is over
+	default:
+	}
+	e.At = time.Since(w.start)
+	if w.cfg.Log != nil {
+		w.cfg.Log(e)
+	}
+}
+
+// note adds a line to the report
+func (w *world) note(format string, args ...any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.notes = append(w.notes, fmt.Sprintf(format, args...))
+}
+
+// finish ends the simulation early
+func (w *world) finish(reason string) {
+	select {
+	case w.done <- reason:
+	default:
+	}
+}
+
+// pause sleeps for between lo and hi steps. It returns false once the
+// simulation is over.
+func (w *world) pause(lo, hi int) bool {
+	w.mu.Lock()
+	steps := lo + w.rng.Intn(hi-lo+1)
+	w.mu.Unlock()
+
+	select {
+	case <-time.After(time.Duration(steps) * w.cfg.Step):
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
+// acquire waits on s for a, timing the wait and logging why when it has
+// to block
+func (w *world) acquire(a *Actor, s *Semaphore, why string) bool {
+	if s.TryWait() {
+		return true
+	}
+	w.beginWait(a, why)
+	ok := s.Wait(w.stop)
+	w.endWait(a)
+	return ok
+}
+
+// lock locks m for a, timing the wait and logging why when it has to block
+func (w *world) lock(a *Actor, m *Mutex, why string) bool {
+	if m.TryLock(a.Name) {
+		return true
+	}
+	w.beginWait(a, why)
+	ok := m.Lock(a.Name, w.stop)
+	w.endWait(a)
+	return ok
+}
+
+func (w *world) beginWait(a *Actor, why string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	a.waitingSince = time.Now()
+	a.warned = false
+	if why != "" {
+		w.logLocked(Event{Actor: a.Name, Text: "waits: " + why})
+	}
+}
+
+func (w *world) endWait(a *Actor) {
+	w.mu.Lock()
+	w.endWaitLocked(a)
+	w.mu.Unlock()
+}
+
+func (w *world) endWaitLocked(a *Actor) {
+	waited := time.Since(a.waitingSince)
+	a.waitingSince = time.Time{}
+	a.Waits++
+	a.Total += waited
+	a.Longest = max(a.Longest, waited)
+}
+
+// did counts a finished piece of work for a
+func (w *world) did(a *Actor) {
+	w.mu.Lock()
+	a.Done++
+	w.mu.Unlock()
+}
+
+// watch runs every step to flag starving actors and detect deadlock
+func (w *world) watch() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, a := range w.actors {
+		if a.waitingSince.IsZero() || a.warned {
+			continue
+		}
+		if waited := time.Since(a.waitingSince); waited >= w.cfg.StarveAfter {
+			a.warned, a.Starved = true, true
+			w.logLocked(Event{Actor: a.Name, Starving: true,
+				Text: fmt.Sprintf("STARVING: blocked for %s", waited.Round(w.cfg.Step))})
+		}
+	}
+
+	if w.blocked != nil {
+		if reason := w.blocked(); reason != "" {
+			w.finish("deadlock: " + reason)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"os/exec"
+	"syscall"
 	"time"
 )
 
@@ -12,12 +13,21 @@ const (
 	JobStatusRunning JobStatus = "Running"
 	JobStatusStopped JobStatus = "Stopped"
 	JobStatusDone    JobStatus = "Done"
+
+	// JobStatusWaiting marks a job that has no process right now because
+	// it is waiting to be launched, for example between retry attempts
+	JobStatusWaiting JobStatus = "Waiting"
+
+	// JobStatusReady marks a background job the job scheduler has stopped
+	// until its next turn on the CPU
+	JobStatusReady JobStatus = "Ready"
 )
 
 // Job represents a background job
 type Job struct {
 	ID         int
 	PID        int
+	PGID       int
 	Command    string
 	Args       []string
 	Status     JobStatus
@@ -25,4 +35,66 @@ type Job struct {
 	StartTime  time.Time
 	EndTime    *time.Time
 	Background bool
+	ExitCode   int
+	Signal     syscall.Signal // signal that terminated the job, if any
+	NoHangup   bool
+	Usage      *ResourceUsage // set once the job has finished
+	LogFile    string         // captured output, when capture is enabled
+	Deadline   *time.Time     // when the running attempt will be timed out
+	TimedOut   bool           // the last attempt was killed for exceeding its deadline
+	NextRun    *time.Time     // when a waiting job will be launched
+	Attempts   []JobAttempt   // finished attempts of a retried job, or recent runs of a recurring one
+	DependsOn  []int          // IDs of the jobs that must succeed before this one starts
+	Cancelled  string         // why the job was cancelled before it could run
+	Reattached bool           // started by an earlier shell session
+	Schedule   string         // when a scheduled job runs, such as "every 5m0s"
+	Limits     *JobLimits     // resource limits of this job, on top of the shell's
+	OverLimit  string         // the limit the job was killed for exceeding, such as "memory 512.0M"
+	Nice       int            // scheduling niceness, from nice or renice
+	Queues     []string       // message queues attached to the job, such as "in:jobs" or "out:results"
+}
+
+// JobLimits holds the resource limits a single job runs under. Zero means
+// no limit.
+type JobLimits struct {
+	Memory    int64         // resident memory in bytes, enforced by the shell
+	CPU       time.Duration // CPU time, enforced by the kernel
+	FileSize  int64         // largest file the job may write, in bytes
+	OpenFiles int           // open file descriptors
+}
+
+// JobAttempt records the outcome of one run of a retried or recurring job
+type JobAttempt struct {
+	PID       int
+	StartTime time.Time
+	EndTime   time.Time
+	ExitCode  int
+	Signal    syscall.Signal
+	TimedOut  bool
+}
+
+// ResourceUsage holds the resources a finished job consumed, as reported by wait4
+type ResourceUsage struct {
+	UserTime               time.Duration `json:"user_ns"`
+	SystemTime             time.Duration `json:"sys_ns"`
+	MaxRSS                 int64         `json:"maxrss"` // peak resident set size in bytes
+	VoluntaryCtxSwitches   int64         `json:"nvcsw"`
+	InvoluntaryCtxSwitches int64         `json:"nivcsw"`
+}
+
+// JobRecord is a job as saved in the job history store
+type JobRecord struct {
+	PID       int            `json:"pid"`
+	Command   string         `json:"command"`
+	Args      []string       `json:"args"`
+	StartTime time.Time      `json:"start"`
+	EndTime   *time.Time     `json:"end,omitempty"`
+	Status    JobStatus      `json:"status"`
+	ExitCode  int            `json:"exit_code"`
+	Signal    syscall.Signal `json:"signal,omitempty"`
+	TimedOut  bool           `json:"timed_out,omitempty"`
+	Cancelled string         `json:"cancelled,omitempty"`
+	OverLimit string         `json:"over_limit,omitempty"`
+	Usage     *ResourceUsage `json:"usage,omitempty"`
+	Detached  bool           `json:"detached,omitempty"` // left running when the shell exited
 }